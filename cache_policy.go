@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/options"
+)
+
+// cachePolicy describes the caching directives of a single response
+type cachePolicy struct {
+	ttl int
+
+	// Set when the origin Cache-Control header should be sent as is
+	passthrough string
+
+	sMaxAge              int
+	staleWhileRevalidate int
+	staleIfError         int
+	immutable            bool
+}
+
+// resolveCachePolicy chooses the caching directives for the response.
+// The rules are applied in the following order:
+//   - fallback images are cached for IMGPROXY_FALLBACK_IMAGE_TTL if it's set;
+//   - non-200 responses use the TTL configured for their status;
+//   - the `expires` option caps the TTL;
+//   - the origin headers are used if IMGPROXY_CACHE_CONTROL_PASSTHROUGH is enabled;
+//   - the `cache_control` option (or the config defaults) is used otherwise.
+//
+// Extended directives are sent only for regular successful responses,
+// fallback images never get them
+func resolveCachePolicy(po *options.ProcessingOptions, statusCode int, originHeaders map[string]string) cachePolicy {
+	ttl := -1
+	regular := true
+
+	// Fallback images must not be pinned at the CDN even if they're sent with 200
+	if _, ok := originHeaders["Fallback-Image"]; ok {
+		regular = false
+
+		if config.FallbackImageTTL > 0 {
+			ttl = config.FallbackImageTTL
+		}
+	}
+
+	if statusTTL, ok := config.CacheControlStatusTTLs[statusCode]; ok && ttl < 0 {
+		ttl = statusTTL
+	}
+
+	if statusCode != http.StatusOK {
+		regular = false
+	}
+
+	maxTTL := po.CacheControl.TTL
+	if ttl >= 0 {
+		maxTTL = ttl
+	}
+
+	if force := po.Expires; force != nil && (ttl < 0 || force.Before(time.Now().Add(time.Duration(ttl)*time.Second))) {
+		ttl = imath.Min(maxTTL, imath.Max(0, int(time.Until(*force).Seconds())))
+		regular = false
+	}
+
+	if config.CacheControlPassthrough && ttl < 0 && originHeaders != nil {
+		if val, ok := originHeaders["Cache-Control"]; ok && len(val) > 0 {
+			return cachePolicy{passthrough: val}
+		}
+
+		if val, ok := originHeaders["Expires"]; ok && len(val) > 0 {
+			if t, err := time.Parse(http.TimeFormat, val); err == nil {
+				ttl = imath.Max(0, int(time.Until(t).Seconds()))
+				regular = false
+			}
+		}
+	}
+
+	if ttl < 0 {
+		ttl = po.CacheControl.TTL
+	}
+
+	cp := cachePolicy{ttl: ttl}
+
+	if regular && ttl > 0 {
+		cp.sMaxAge = po.CacheControl.SMaxAge
+		cp.staleWhileRevalidate = po.CacheControl.StaleWhileRevalidate
+		cp.staleIfError = po.CacheControl.StaleIfError
+		cp.immutable = po.CacheControl.Immutable
+	}
+
+	return cp
+}
+
+func (cp cachePolicy) header() string {
+	if len(cp.passthrough) > 0 {
+		return cp.passthrough
+	}
+
+	if cp.ttl <= 0 {
+		return "no-cache"
+	}
+
+	directives := []string{fmt.Sprintf("max-age=%d", cp.ttl), "public"}
+
+	if cp.sMaxAge > 0 {
+		directives = append(directives, fmt.Sprintf("s-maxage=%d", cp.sMaxAge))
+	}
+	if cp.staleWhileRevalidate > 0 {
+		directives = append(directives, fmt.Sprintf("stale-while-revalidate=%d", cp.staleWhileRevalidate))
+	}
+	if cp.staleIfError > 0 {
+		directives = append(directives, fmt.Sprintf("stale-if-error=%d", cp.staleIfError))
+	}
+	if cp.immutable {
+		directives = append(directives, "immutable")
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// cdnHeader returns the value of the CDN-Cache-Control header.
+// CDNs use s-maxage as their TTL, so it's sent as max-age here
+func (cp cachePolicy) cdnHeader() string {
+	if len(cp.passthrough) > 0 || cp.sMaxAge <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("max-age=%d", cp.sMaxAge)
+}
+
+func setCacheControl(rw http.ResponseWriter, po *options.ProcessingOptions, statusCode int, originHeaders map[string]string) {
+	cp := resolveCachePolicy(po, statusCode, originHeaders)
+
+	rw.Header().Set("Cache-Control", cp.header())
+
+	if config.CDNCacheControl {
+		if val := cp.cdnHeader(); len(val) > 0 {
+			rw.Header().Set("CDN-Cache-Control", val)
+		}
+	}
+}
+
+// setErrorCacheControl sets Cache-Control for error responses.
+// Errors are not cached unless a TTL is configured for their status
+func setErrorCacheControl(rw http.ResponseWriter, statusCode int) {
+	if ttl, ok := config.CacheControlStatusTTLs[statusCode]; ok && ttl > 0 {
+		rw.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public", ttl))
+	} else {
+		rw.Header().Set("Cache-Control", "no-cache")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/options"
+)
+
+func TestResolveCachePolicyFallbackImage(t *testing.T) {
+	config.Reset()
+	defer config.Reset()
+
+	po := options.NewProcessingOptions()
+	po.CacheControl.SMaxAge = 3600
+	po.CacheControl.StaleIfError = 600
+	po.CacheControl.Immutable = true
+
+	fallback := map[string]string{"Fallback-Image": "1"}
+
+	cp := resolveCachePolicy(po, 200, fallback)
+	require.Equal(t, po.CacheControl.TTL, cp.ttl)
+	require.Equal(t, fmt.Sprintf("max-age=%d, public", po.CacheControl.TTL), cp.header())
+	require.Empty(t, cp.cdnHeader())
+
+	config.FallbackImageTTL = 60
+
+	cp = resolveCachePolicy(po, 200, fallback)
+	require.Equal(t, "max-age=60, public", cp.header())
+
+	cp = resolveCachePolicy(po, 200, nil)
+	require.Equal(t, fmt.Sprintf("max-age=%d, public, s-maxage=3600, stale-if-error=600, immutable", po.CacheControl.TTL), cp.header())
+}
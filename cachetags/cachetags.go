@@ -0,0 +1,124 @@
+package cachetags
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// Length of the hex-encoded hashes used in tags. Object keys may contain
+// characters that CDNs don't allow in tags, so they are hashed
+const hashLen = 16
+
+func hash(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])[:hashLen]
+}
+
+func Enabled() bool {
+	return len(config.CacheTagHeaders) > 0
+}
+
+// ObjectTag returns the tag shared by every derivative of the source object.
+// Purging it invalidates all sizes, presets, and watermarks at once
+func ObjectTag(imageURL string) string {
+	return config.CacheTagPrefix + "obj-" + hash(imageURL)
+}
+
+// PresetTag returns the tag of the responses rendered with the preset
+func PresetTag(preset string) string {
+	return config.CacheTagPrefix + "pr-" + preset
+}
+
+// WatermarkTag returns the tag of the responses having the watermark
+func WatermarkTag(watermark string) string {
+	return config.CacheTagPrefix + "wm-" + watermark
+}
+
+// VersionTag returns the tag of the responses rendered from the specific
+// master version
+func VersionTag(imageURL, masterETag string) string {
+	return config.CacheTagPrefix + "ver-" + hash(imageURL, masterETag)
+}
+
+// Tags builds the tags of the response
+func Tags(imageURL string, presets []string, watermark, masterETag string) []string {
+	tags := make([]string, 0, len(presets)+3)
+
+	tags = append(tags, ObjectTag(imageURL))
+
+	for _, p := range presets {
+		tags = append(tags, PresetTag(p))
+	}
+
+	if len(watermark) > 0 {
+		tags = append(tags, WatermarkTag(watermark))
+	}
+
+	if len(masterETag) > 0 {
+		tags = append(tags, VersionTag(imageURL, masterETag))
+	}
+
+	return tags
+}
+
+// SetHeaders sets the configured tag headers.
+// Cache-Tag style headers are comma-separated, Surrogate-Key style headers are space-separated
+func SetHeaders(header http.Header, tags []string) {
+	for _, name := range config.CacheTagHeaders {
+		sep := " "
+		if strings.HasSuffix(strings.ToLower(name), "cache-tag") {
+			sep = ","
+		}
+
+		header.Set(name, strings.Join(tags, sep))
+	}
+}
+
+// Purge asks the CDN to invalidate everything tagged with any of the tags.
+// The tags are sent as a JSON body: {"tags": [...]}
+func Purge(ctx context.Context, tags ...string) error {
+	if len(config.CDNPurgeURL) == 0 || len(tags) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(struct {
+		Tags []string `json:"tags"`
+	}{tags})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.CDNPurgeTimeout)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.CDNPurgeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(config.CDNPurgeAuthorization) > 0 {
+		req.Header.Set("Authorization", config.CDNPurgeAuthorization)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Can't purge CDN cache: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("Can't purge CDN cache: status %d", res.StatusCode)
+	}
+
+	return nil
+}
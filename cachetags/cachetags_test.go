@@ -0,0 +1,52 @@
+package cachetags
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+func TestSetHeaders(t *testing.T) {
+	config.Reset()
+	config.CacheTagHeaders = []string{"Surrogate-Key", "Cache-Tag"}
+	config.CacheTagPrefix = "img-"
+
+	header := make(http.Header)
+	SetHeaders(header, Tags("cw/ec/1.jpg", []string{"card"}, "1", `"abc"`))
+
+	obj := ObjectTag("cw/ec/1.jpg")
+	ver := VersionTag("cw/ec/1.jpg", `"abc"`)
+
+	require.Equal(t, obj+" img-pr-card img-wm-1 "+ver, header.Get("Surrogate-Key"))
+	require.Equal(t, obj+",img-pr-card,img-wm-1,"+ver, header.Get("Cache-Tag"))
+	require.NotEqual(t, ObjectTag("cw/ec/2.jpg"), obj)
+}
+
+func TestPurge(t *testing.T) {
+	var (
+		auth string
+		body struct {
+			Tags []string `json:"tags"`
+		}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer server.Close()
+
+	config.Reset()
+	config.CDNPurgeURL = server.URL
+	config.CDNPurgeAuthorization = "Bearer token"
+
+	require.NoError(t, Purge(context.Background(), "a", "b"))
+	require.Equal(t, "Bearer token", auth)
+	require.Equal(t, []string{"a", "b"}, body.Tags)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/errorreport"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/metrics"
+	"github.com/imgproxy/imgproxy/v3/metrics/stats"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+type collageRequest struct {
+	sources []string
+	// Gravity arguments of the cells, nil keeps the default gravity
+	gravities [][]string
+
+	layout processing.CollageLayout
+}
+
+func parseCollageSize(s string) (int, int, error) {
+	w, h, ok := strings.Cut(s, "x")
+	if ok {
+		width, werr := strconv.Atoi(w)
+		height, herr := strconv.Atoi(h)
+
+		if werr == nil && herr == nil && width > 0 && height > 0 {
+			return width, height, nil
+		}
+	}
+
+	return 0, 0, newInvalidURLErrorf(http.StatusBadRequest, "Invalid collage size: %s", s)
+}
+
+// parseCollageRequest parses the collage query:
+// src (required, one per cell), grid (COLSxROWS), gutter, bg, and g
+func parseCollageRequest(size string, qs url.Values) (collageRequest, error) {
+	var (
+		req collageRequest
+		err error
+	)
+
+	if req.layout.Width, req.layout.Height, err = parseCollageSize(size); err != nil {
+		return req, err
+	}
+
+	req.sources = qs["src"]
+	if len(req.sources) == 0 {
+		return req, newInvalidURLErrorf(http.StatusBadRequest, "Collage sources are required")
+	}
+	if len(req.sources) > config.CollageMaxCells {
+		return req, newInvalidURLErrorf(http.StatusBadRequest, "Too many collage sources: %d", len(req.sources))
+	}
+
+	if grid := qs.Get("grid"); len(grid) > 0 {
+		cols, rows, ok := strings.Cut(grid, "x")
+		req.layout.Columns, _ = strconv.Atoi(cols)
+		req.layout.Rows, _ = strconv.Atoi(rows)
+
+		if !ok || req.layout.Columns <= 0 || req.layout.Rows <= 0 ||
+			req.layout.Columns*req.layout.Rows > config.CollageMaxCells {
+			return req, newInvalidURLErrorf(http.StatusBadRequest, "Invalid collage grid: %s", grid)
+		}
+	} else {
+		req.layout.Columns = int(math.Ceil(math.Sqrt(float64(len(req.sources)))))
+		req.layout.Rows = (len(req.sources) + req.layout.Columns - 1) / req.layout.Columns
+	}
+
+	// Sources fill the grid row by row, the last row can't be empty
+	if cells := req.layout.Columns * req.layout.Rows; len(req.sources) > cells || cells-len(req.sources) >= req.layout.Columns {
+		return req, newInvalidURLErrorf(
+			http.StatusBadRequest, "Collage grid %dx%d doesn't match %d sources",
+			req.layout.Columns, req.layout.Rows, len(req.sources),
+		)
+	}
+
+	if gutter := qs.Get("gutter"); len(gutter) > 0 {
+		if req.layout.Gutter, err = strconv.Atoi(gutter); err != nil || req.layout.Gutter < 0 {
+			return req, newInvalidURLErrorf(http.StatusBadRequest, "Invalid collage gutter: %s", gutter)
+		}
+	}
+
+	if cellWidth, cellHeight := req.layout.CellSize(); cellWidth <= 0 || cellHeight <= 0 {
+		return req, newInvalidURLErrorf(http.StatusBadRequest, "Collage cells are too small")
+	}
+
+	req.layout.Background = vips.Color{R: 255, G: 255, B: 255}
+	if bg := qs.Get("bg"); len(bg) > 0 {
+		if req.layout.Background, err = vips.ColorFromHex(bg); err != nil {
+			return req, newInvalidURLErrorf(http.StatusBadRequest, "Invalid collage background: %s", bg)
+		}
+	}
+
+	// A single gravity is applied to all the cells
+	switch g := qs["g"]; len(g) {
+	case 0:
+	case 1, len(req.sources):
+		req.gravities = make([][]string, len(req.sources))
+
+		for i := range req.gravities {
+			cg := g[min(i, len(g)-1)]
+			if len(cg) > 0 {
+				req.gravities[i] = strings.Split(cg, config.ArgumentsSeparator)
+			}
+		}
+	default:
+		return req, newInvalidURLErrorf(http.StatusBadRequest, "Collage gravities count should be 1 or match the sources count")
+	}
+
+	return req, nil
+}
+
+// verifyCollageSignature checks the `sig` parameter. Collages have no path options,
+// so the path and the rest of the query are signed
+func verifyCollageSignature(path string, qs url.Values) error {
+	signed := make(url.Values, len(qs))
+	for k, v := range qs {
+		if k != "sig" {
+			signed[k] = v
+		}
+	}
+
+	return security.VerifySignature(qs.Get("sig"), path+"?"+signed.Encode())
+}
+
+// collageCellsOptions builds the processing options of every cell.
+// Cells are always filled, watermarks are applied to the whole collage only
+func collageCellsOptions(r *http.Request, qs url.Values, req collageRequest) ([]*options.ProcessingOptions, error) {
+	cellWidth, cellHeight := req.layout.CellSize()
+
+	cellsPO := make([]*options.ProcessingOptions, len(req.sources))
+
+	for i, src := range req.sources {
+		po, _, err := options.ParsePathIPC(fmt.Sprintf("%dx%d/%s", cellWidth, cellHeight, src), qs, r.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		po.ResizingType = options.ResizeFill
+		po.Enlarge = true
+		po.Watermark.Enabled = false
+
+		if req.gravities != nil && req.gravities[i] != nil {
+			if err = po.ApplyGravity(req.gravities[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		cellsPO[i] = po
+	}
+
+	return cellsPO, nil
+}
+
+func downloadCollageCells(ctx context.Context, sources []string, cellsPO []*options.ProcessingOptions) ([]*imagedata.ImageData, error) {
+	cells := make([]*imagedata.ImageData, len(sources))
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i, src := range sources {
+		g.Go(func() error {
+			imgdata, err := downloadMasterOrOriginal(gctx, src, cellsPO[i])
+			cells[i] = imgdata
+			return err
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		closeImagesData(cells)
+		return nil, err
+	}
+
+	return cells, nil
+}
+
+// GET /collage/{width}x{height}?src=a.jpg&src=b.jpg&grid=2x1
+func handleCollage(reqID string, rw http.ResponseWriter, r *http.Request) {
+	stats.IncRequestsInProgress()
+	defer stats.DecRequestsInProgress()
+
+	ctx := r.Context()
+
+	qs := r.URL.Query()
+
+	path := strings.TrimPrefix(r.URL.Path, config.PathPrefix)
+
+	err := verifyCollageSignature(path, qs)
+	checkErr(ctx, "security", err)
+
+	req, err := parseCollageRequest(strings.TrimPrefix(path, "/collage/"), qs)
+	checkErr(ctx, "path_parsing", err)
+
+	errorreport.SetMetadata(r, "Source Image URL", req.sources)
+	metrics.SetMetadata(ctx, "imgproxy.source_image_url", req.sources)
+
+	for _, src := range req.sources {
+		err = security.VerifySourceURL(src)
+		checkErr(ctx, "security", err)
+	}
+
+	// The collage options set the output format, quality, and watermark
+	po, _, err := options.ParsePathIPC(
+		fmt.Sprintf("%dx%d/%s", req.layout.Width, req.layout.Height, req.sources[0]), qs, r.Header,
+	)
+	checkErr(ctx, "path_parsing", err)
+
+	errorreport.SetMetadata(r, "Processing Options", po)
+	metrics.SetMetadata(ctx, "imgproxy.processing_options", po)
+
+	if po.SecurityOptions.MaxSrcResolution > 0 && req.layout.Width*req.layout.Height > po.SecurityOptions.MaxSrcResolution {
+		sendErrAndPanic(ctx, "security", newInvalidURLErrorf(
+			http.StatusUnprocessableEntity, "Collage resolution is too big: %dx%d", req.layout.Width, req.layout.Height,
+		))
+	}
+
+	cellsPO, err := collageCellsOptions(r, qs, req)
+	checkErr(ctx, "path_parsing", err)
+
+	if queueSem != nil {
+		acquired := queueSem.TryAcquire(1)
+		if !acquired {
+			panic(newTooManyRequestsError())
+		}
+		defer queueSem.Release(1)
+	}
+
+	// Collages are processed in a single worker like regular images
+	func() {
+		defer metrics.StartQueueSegment(ctx)()
+
+		err = processingSem.Acquire(ctx, 1)
+		if err != nil {
+			checkErr(ctx, "queue", router.CheckTimeout(ctx))
+			sendErrAndPanic(ctx, "queue", err)
+		}
+	}()
+	defer processingSem.Release(1)
+
+	stats.IncImagesInProgress()
+	defer stats.DecImagesInProgress()
+
+	cells, err := func() ([]*imagedata.ImageData, error) {
+		defer metrics.StartDownloadingSegment(ctx)()
+		return downloadCollageCells(ctx, req.sources, cellsPO)
+	}()
+	checkErr(ctx, "download", err)
+	defer closeImagesData(cells)
+
+	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
+
+	resultData, err := func() (*imagedata.ImageData, error) {
+		defer metrics.StartProcessingSegment(ctx)()
+		return processing.ProcessCollage(ctx, cells, cellsPO, po, req.layout)
+	}()
+	checkErr(ctx, "processing", err)
+	defer resultData.Close()
+
+	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
+
+	respondWithComposedImage(reqID, r, rw, resultData, po, req.sources)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+func TestParseCollageRequest(t *testing.T) {
+	config.Reset()
+	defer config.Reset()
+
+	config.CollageMaxCells = 6
+
+	tests := []struct {
+		name      string
+		size      string
+		query     string
+		columns   int
+		rows      int
+		gravities [][]string
+		err       bool
+	}{
+		{name: "auto grid", size: "1200x600", query: "src=a&src=b&src=c", columns: 2, rows: 2},
+		{name: "auto grid square", size: "1200x600", query: "src=a&src=b&src=c&src=d", columns: 2, rows: 2},
+		{name: "explicit grid", size: "1200x600", query: "src=a&src=b&grid=2x1", columns: 2, rows: 1},
+		{name: "last row partially filled", size: "1200x600", query: "src=a&src=b&src=c&grid=2x2", columns: 2, rows: 2},
+		{name: "last row empty", size: "1200x600", query: "src=a&src=b&grid=2x2", err: true},
+		{name: "more sources than cells", size: "1200x600", query: "src=a&src=b&src=c&grid=2x1", err: true},
+		{name: "too many cells", size: "1200x600", query: "src=a&grid=7x1", err: true},
+		{name: "invalid grid", size: "1200x600", query: "src=a&grid=2", err: true},
+		{name: "no sources", size: "1200x600", query: "grid=1x1", err: true},
+		{name: "too many sources", size: "1200x600", query: "src=a&src=b&src=c&src=d&src=e&src=f&src=g", err: true},
+		{name: "invalid size", size: "1200", query: "src=a", err: true},
+		{name: "zero size", size: "0x600", query: "src=a", err: true},
+		{name: "cells too small", size: "10x10", query: "src=a&src=b&gutter=10", err: true},
+		{name: "negative gutter", size: "1200x600", query: "src=a&gutter=-1", err: true},
+		{name: "invalid background", size: "1200x600", query: "src=a&bg=zzz", err: true},
+		{
+			name: "single gravity", size: "1200x600", query: "src=a&src=b&g=no", columns: 2, rows: 1,
+			gravities: [][]string{{"no"}, {"no"}},
+		},
+		{
+			name: "gravity per cell", size: "1200x600", query: "src=a&src=b&g=no&g=fp:0.3:0.7", columns: 2, rows: 1,
+			gravities: [][]string{{"no"}, {"fp", "0.3", "0.7"}},
+		},
+		{
+			name: "empty gravity keeps the default", size: "1200x600", query: "src=a&src=b&g=&g=so", columns: 2, rows: 1,
+			gravities: [][]string{nil, {"so"}},
+		},
+		{name: "gravities count mismatch", size: "1200x600", query: "src=a&src=b&src=c&g=no&g=so", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			qs, err := url.ParseQuery(tc.query)
+			require.NoError(t, err)
+
+			req, err := parseCollageRequest(tc.size, qs)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, qs["src"], req.sources)
+			require.Equal(t, tc.columns, req.layout.Columns)
+			require.Equal(t, tc.rows, req.layout.Rows)
+			require.Equal(t, tc.gravities, req.gravities)
+		})
+	}
+}
+
+func TestParseCollageRequestLayout(t *testing.T) {
+	config.Reset()
+	defer config.Reset()
+
+	qs, err := url.ParseQuery("src=a&src=b&grid=2x1&gutter=8&bg=f0f0f0")
+	require.NoError(t, err)
+
+	req, err := parseCollageRequest("1200x600", qs)
+	require.NoError(t, err)
+
+	require.Equal(t, 1200, req.layout.Width)
+	require.Equal(t, 600, req.layout.Height)
+	require.Equal(t, 8, req.layout.Gutter)
+	require.Equal(t, vips.Color{R: 0xf0, G: 0xf0, B: 0xf0}, req.layout.Background)
+
+	cellWidth, cellHeight := req.layout.CellSize()
+	require.Equal(t, 596, cellWidth)
+	require.Equal(t, 600, cellHeight)
+}
+
+func TestVerifyCollageSignature(t *testing.T) {
+	config.Reset()
+	defer config.Reset()
+
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+
+	// The signed string is the path and the query without `sig`, sorted by key.
+	// Clients rely on this format, so it must never change
+	signed := "/collage/1200x600?grid=2x1&src=cw%2Fec%2F1.jpg&src=cw%2Fec%2F2.jpg"
+
+	mac := hmac.New(sha256.New, config.Keys[0])
+	mac.Write(config.Salts[0])
+	mac.Write([]byte(signed))
+	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	// The order of the keys in the request doesn't matter, the order of the sources does
+	qs := url.Values{}
+	qs.Add("src", "cw/ec/1.jpg")
+	qs.Add("sig", sig)
+	qs.Add("src", "cw/ec/2.jpg")
+	qs.Add("grid", "2x1")
+
+	require.NoError(t, verifyCollageSignature("/collage/1200x600", qs))
+
+	tests := []struct {
+		name string
+		path string
+		qs   url.Values
+	}{
+		{
+			name: "another path",
+			path: "/collage/600x600",
+			qs:   qs,
+		},
+		{
+			name: "swapped sources",
+			path: "/collage/1200x600",
+			qs:   url.Values{"src": {"cw/ec/2.jpg", "cw/ec/1.jpg"}, "grid": {"2x1"}, "sig": {sig}},
+		},
+		{
+			name: "extra parameter",
+			path: "/collage/1200x600",
+			qs:   url.Values{"src": {"cw/ec/1.jpg", "cw/ec/2.jpg"}, "grid": {"2x1"}, "gutter": {"8"}, "sig": {sig}},
+		},
+		{
+			name: "no signature",
+			path: "/collage/1200x600",
+			qs:   url.Values{"src": {"cw/ec/1.jpg", "cw/ec/2.jpg"}, "grid": {"2x1"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Error(t, verifyCollageSignature(tc.path, tc.qs))
+		})
+	}
+}
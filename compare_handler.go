@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/errorreport"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/metrics"
+	"github.com/imgproxy/imgproxy/v3/metrics/stats"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+	"github.com/imgproxy/imgproxy/v3/similarity"
+)
+
+// Hashes are calculated from tiny images, so the smallest master level is enough
+const compareRenderSize = 64
+
+type compareImageHashes struct {
+	PHash string `json:"phash"`
+	DHash string `json:"dhash"`
+}
+
+type compareResponse struct {
+	PHashDistance int  `json:"phash_distance"`
+	DHashDistance int  `json:"dhash_distance"`
+	Similar       bool `json:"similar"`
+
+	A compareImageHashes `json:"a"`
+	B compareImageHashes `json:"b"`
+}
+
+func newCompareResponse(a, b processing.PerceptualHashes) compareResponse {
+	resp := compareResponse{
+		PHashDistance: similarity.HammingDistance(a.PHash, b.PHash),
+		DHashDistance: similarity.HammingDistance(a.DHash, b.DHash),
+	}
+
+	resp.Similar = resp.PHashDistance <= config.PerceptualHashThreshold
+
+	resp.A.PHash, resp.A.DHash = a.Strings()
+	resp.B.PHash, resp.B.DHash = b.Strings()
+
+	return resp
+}
+
+// createMasterHashesHeader calculates the perceptual hashes of the new master from its
+// smallest pyramid level and builds the S3 metadata headers with them.
+// Hashes are optional, so errors are only logged
+func createMasterHashesHeader(imageURL string, masterData *imagedata.ImageData, levels map[int]*imagedata.ImageData) http.Header {
+	if !config.PerceptualHashMasterMetadata {
+		return nil
+	}
+
+	src := masterData
+	for _, l := range config.MasterPyramidLevels {
+		if data, ok := levels[l]; ok {
+			src = data
+			break
+		}
+	}
+
+	hashes, err := processing.ImageHashes(src)
+	if err != nil {
+		log.Warningf("Can't calculate perceptual hashes of %s: %s", imageURL, err)
+		return nil
+	}
+
+	phash, dhash := hashes.Strings()
+
+	return http.Header{
+		"X-Amz-Meta-Phash": {phash},
+		"X-Amz-Meta-Dhash": {dhash},
+	}
+}
+
+func downloadCompareImages(ctx context.Context, imageURLs []string, pos []*options.ProcessingOptions) ([]*imagedata.ImageData, error) {
+	images := make([]*imagedata.ImageData, len(imageURLs))
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i, imageURL := range imageURLs {
+		g.Go(func() error {
+			imgdata, err := downloadMasterOrOriginal(gctx, imageURL, pos[i])
+			images[i] = imgdata
+			return err
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		closeImagesData(images)
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// GET /compare?a={path}&b={path}
+func handleCompare(reqID string, rw http.ResponseWriter, r *http.Request) {
+	stats.IncRequestsInProgress()
+	defer stats.DecRequestsInProgress()
+
+	ctx := r.Context()
+
+	qs := r.URL.Query()
+
+	imageURLs := make([]string, 2)
+	pos := make([]*options.ProcessingOptions, 2)
+
+	for i, k := range []string{"a", "b"} {
+		path := qs.Get(k)
+		if len(path) == 0 {
+			sendErrAndPanic(ctx, "path_parsing", newInvalidURLErrorf(http.StatusBadRequest, "Missing image to compare: %s", k))
+		}
+
+		var err error
+
+		pos[i], imageURLs[i], err = options.ParsePathIPC(fmt.Sprintf("%dx%d/%s", compareRenderSize, compareRenderSize, path), nil, r.Header)
+		checkErr(ctx, "path_parsing", err)
+	}
+
+	errorreport.SetMetadata(r, "Source Image URL", imageURLs)
+	metrics.SetMetadata(ctx, "imgproxy.source_image_url", imageURLs)
+
+	for _, imageURL := range imageURLs {
+		err := security.VerifySourceURL(imageURL)
+		checkErr(ctx, "security", err)
+	}
+
+	if queueSem != nil {
+		acquired := queueSem.TryAcquire(1)
+		if !acquired {
+			panic(newTooManyRequestsError())
+		}
+		defer queueSem.Release(1)
+	}
+
+	func() {
+		defer metrics.StartQueueSegment(ctx)()
+
+		err := processingSem.Acquire(ctx, 1)
+		if err != nil {
+			checkErr(ctx, "queue", router.CheckTimeout(ctx))
+			sendErrAndPanic(ctx, "queue", err)
+		}
+	}()
+	defer processingSem.Release(1)
+
+	stats.IncImagesInProgress()
+	defer stats.DecImagesInProgress()
+
+	images, err := func() ([]*imagedata.ImageData, error) {
+		defer metrics.StartDownloadingSegment(ctx)()
+		return downloadCompareImages(ctx, imageURLs, pos)
+	}()
+	checkErr(ctx, "download", err)
+	defer closeImagesData(images)
+
+	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
+
+	hashes := make([]processing.PerceptualHashes, len(images))
+
+	func() {
+		defer metrics.StartProcessingSegment(ctx)()
+
+		for i, imgdata := range images {
+			hashes[i], err = processing.ImageHashes(imgdata)
+			checkErr(ctx, "processing", err)
+		}
+	}()
+
+	writeJSON(rw, http.StatusOK, newCompareResponse(hashes[0], hashes[1]))
+
+	router.LogResponse(reqID, r, http.StatusOK, nil)
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"regexp"
 	"runtime"
+	"sort"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
@@ -35,6 +37,13 @@ var (
 	CacheControlPassthrough bool
 	SetCanonicalHeader      bool
 
+	CacheControlSMaxAge              int
+	CacheControlStaleWhileRevalidate int
+	CacheControlStaleIfError         int
+	CacheControlImmutable            bool
+	CacheControlStatusTTLs           map[int]int
+	CDNCacheControl                  bool
+
 	SoReuseport bool
 
 	PathPrefix string
@@ -52,15 +61,50 @@ var (
 	AllowSecurityOptions        bool
 
 	JpegProgressive       bool
+	JpegTrellisQuant      bool
 	PngInterlaced         bool
 	PngQuantize           bool
 	PngQuantizationColors int
+	WebpMethod            int
+	WebpAlphaQuality      int
 	AvifSpeed             int
 	JxlEffort             int
 	Quality               int
 	FormatQuality         map[imagetype.Type]int
+
+	AvifAnimation              bool
+	AvifAnimationMaxFrames     int
+	AvifAnimationMaxResolution int
+
+	TargetQualitySSIM          float64
+	TargetQualityMin           int
+	TargetQualityMax           int
+	TargetQualityMaxIterations int
+
+	MaxBytesMinQuality     int
+	MaxBytesMaxDownscales  int
+	MaxBytesFormatFallback bool
+	MaxBytesQueryMin       int
+
+	SpinMaxFrames     int
+	SpinMaxResolution int
+	SpinFrameDelay    int
+
+	CollageMaxCells int
+
+	PlaceholderSize           int
+	PlaceholderQuality        int
+	PlaceholderMasterMetadata bool
+
+	PerceptualHashThreshold      int
+	PerceptualHashMasterMetadata bool
+
+	ExtendBlurSigma      float64
+	ExtendBlurBrightness float64
+
 	StripMetadata         bool
 	KeepCopyright         bool
+	MetadataPolicies      map[string]string
 	StripColorProfile     bool
 	AutoRotate            bool
 	EnforceThumbnail      bool
@@ -144,6 +188,40 @@ var (
 
 	LastModifiedEnabled bool
 
+	ResultCacheSize int
+	ResultCacheTTL  int
+
+	DiskCacheDir         string
+	DiskCacheSize        int
+	DiskCacheTTL         int
+	DiskCacheDerivatives bool
+
+	DerivativeStoreBucket    string
+	DerivativeStoreTTL       int
+	DerivativeStoreWorkers   int
+	DerivativeStoreQueueSize int
+
+	MasterFormat             imagetype.Type
+	MasterQuality            int
+	MasterLossless           bool
+	MasterChromaSubsampling  string
+	MasterKeepColorProfile   bool
+	MasterMetadataPolicy     string
+	MasterPassthroughFormats []imagetype.Type
+	MasterPyramidLevels      []int
+	MasterPyramidPrefix      string
+	MasterEditsSuffix        string
+
+	WarmupVariants  []string
+	WarmupWorkers   int
+	WarmupQueueSize int
+
+	CacheTagHeaders       []string
+	CacheTagPrefix        string
+	CDNPurgeURL           string
+	CDNPurgeAuthorization string
+	CDNPurgeTimeout       int
+
 	BaseURL                   string
 	URLReplacements           []URLReplacement
 	Base64URLIncludesFilename bool
@@ -158,6 +236,7 @@ var (
 	WatermarkPaths  map[string]string
 	Artifacts 	 map[string]string
 	ArtifactsSizesMap map[string][]string
+	MaskPaths         map[string]string
 
 	FallbackImageData     string
 	FallbackImagePath     string
@@ -245,6 +324,13 @@ func Reset() {
 	CacheControlPassthrough = false
 	SetCanonicalHeader = false
 
+	CacheControlSMaxAge = 0
+	CacheControlStaleWhileRevalidate = 0
+	CacheControlStaleIfError = 0
+	CacheControlImmutable = false
+	CacheControlStatusTTLs = make(map[int]int)
+	CDNCacheControl = false
+
 	SoReuseport = false
 
 	PathPrefix = ""
@@ -262,10 +348,16 @@ func Reset() {
 	AllowSecurityOptions = true
 
 	JpegProgressive = false
+	JpegTrellisQuant = false
 	PngInterlaced = false
 	PngQuantize = false
 	PngQuantizationColors = 256
+	WebpMethod = 4
+	WebpAlphaQuality = 100
 	AvifSpeed = 8
+	AvifAnimation = false
+	AvifAnimationMaxFrames = 60
+	AvifAnimationMaxResolution = 25000000
 	JxlEffort = 4
 	Quality = 80
 	FormatQuality = map[imagetype.Type]int{
@@ -273,8 +365,36 @@ func Reset() {
 		imagetype.AVIF: 65,
 		imagetype.JXL:  77,
 	}
+
+	TargetQualitySSIM = 0
+	TargetQualityMin = 30
+	TargetQualityMax = 95
+	TargetQualityMaxIterations = 6
+
+	MaxBytesMinQuality = 10
+	MaxBytesMaxDownscales = 3
+	MaxBytesFormatFallback = true
+	MaxBytesQueryMin = 10 * 1024
+
+	SpinMaxFrames = 72
+	SpinMaxResolution = 100000000
+	SpinFrameDelay = 100
+
+	CollageMaxCells = 6
+
+	PlaceholderSize = 32
+	PlaceholderQuality = 30
+	PlaceholderMasterMetadata = false
+
+	PerceptualHashThreshold = 10
+	PerceptualHashMasterMetadata = false
+
+	ExtendBlurSigma = 20
+	ExtendBlurBrightness = 0.6
+
 	StripMetadata = true
 	KeepCopyright = true
+	MetadataPolicies = map[string]string{}
 	StripColorProfile = true
 	AutoRotate = true
 	EnforceThumbnail = false
@@ -353,7 +473,41 @@ func Reset() {
 	ETagEnabled = false
 	ETagBuster = ""
 
-	LastModifiedEnabled = false
+	LastModifiedEnabled = true
+
+	ResultCacheSize = 0
+	ResultCacheTTL = 300
+
+	DiskCacheDir = ""
+	DiskCacheSize = 10 * 1024 * 1024 * 1024
+	DiskCacheTTL = 86400
+	DiskCacheDerivatives = false
+
+	DerivativeStoreBucket = ""
+	DerivativeStoreTTL = 30 * 24 * 60 * 60
+	DerivativeStoreWorkers = 4
+	DerivativeStoreQueueSize = 256
+
+	MasterFormat = imagetype.Unknown
+	MasterQuality = 0
+	MasterLossless = false
+	MasterChromaSubsampling = "auto"
+	MasterKeepColorProfile = false
+	MasterMetadataPolicy = ""
+	MasterPassthroughFormats = make([]imagetype.Type, 0)
+	MasterPyramidLevels = make([]int, 0)
+	MasterPyramidPrefix = "levels"
+	MasterEditsSuffix = ""
+
+	WarmupVariants = make([]string, 0)
+	WarmupWorkers = 1
+	WarmupQueueSize = 64
+
+	CacheTagHeaders = make([]string, 0)
+	CacheTagPrefix = ""
+	CDNPurgeURL = ""
+	CDNPurgeAuthorization = ""
+	CDNPurgeTimeout = 10
 
 	BaseURL = ""
 	URLReplacements = make([]URLReplacement, 0)
@@ -397,6 +551,8 @@ func Reset() {
 		"9": {"642x336"},
 	}
 
+	MaskPaths = map[string]string{}
+
 	FallbackImageData = ""
 	FallbackImagePath = ""
 	FallbackImageURL = ""
@@ -495,6 +651,15 @@ func Configure() error {
 	configurators.Bool(&CacheControlPassthrough, "IMGPROXY_CACHE_CONTROL_PASSTHROUGH")
 	configurators.Bool(&SetCanonicalHeader, "IMGPROXY_SET_CANONICAL_HEADER")
 
+	configurators.Int(&CacheControlSMaxAge, "IMGPROXY_CACHE_CONTROL_S_MAXAGE")
+	configurators.Int(&CacheControlStaleWhileRevalidate, "IMGPROXY_CACHE_CONTROL_STALE_WHILE_REVALIDATE")
+	configurators.Int(&CacheControlStaleIfError, "IMGPROXY_CACHE_CONTROL_STALE_IF_ERROR")
+	configurators.Bool(&CacheControlImmutable, "IMGPROXY_CACHE_CONTROL_IMMUTABLE")
+	if err := configurators.IntMap(&CacheControlStatusTTLs, "IMGPROXY_CACHE_CONTROL_STATUS_TTLS"); err != nil {
+		return err
+	}
+	configurators.Bool(&CDNCacheControl, "IMGPROXY_CDN_CACHE_CONTROL")
+
 	configurators.Bool(&SoReuseport, "IMGPROXY_SO_REUSEPORT")
 
 	configurators.URLPath(&PathPrefix, "IMGPROXY_PATH_PREFIX")
@@ -523,17 +688,49 @@ func Configure() error {
 	configurators.Bool(&AllowSecurityOptions, "IMGPROXY_ALLOW_SECURITY_OPTIONS")
 
 	configurators.Bool(&JpegProgressive, "IMGPROXY_JPEG_PROGRESSIVE")
+	configurators.Bool(&JpegTrellisQuant, "IMGPROXY_JPEG_TRELLIS_QUANT")
 	configurators.Bool(&PngInterlaced, "IMGPROXY_PNG_INTERLACED")
 	configurators.Bool(&PngQuantize, "IMGPROXY_PNG_QUANTIZE")
 	configurators.Int(&PngQuantizationColors, "IMGPROXY_PNG_QUANTIZATION_COLORS")
+	configurators.Int(&WebpMethod, "IMGPROXY_WEBP_METHOD")
+	configurators.Int(&WebpAlphaQuality, "IMGPROXY_WEBP_ALPHA_QUALITY")
 	configurators.Int(&AvifSpeed, "IMGPROXY_AVIF_SPEED")
+	configurators.Bool(&AvifAnimation, "IMGPROXY_AVIF_ANIMATION")
+	configurators.Int(&AvifAnimationMaxFrames, "IMGPROXY_AVIF_ANIMATION_MAX_FRAMES")
+	configurators.MegaInt(&AvifAnimationMaxResolution, "IMGPROXY_AVIF_ANIMATION_MAX_RESOLUTION")
 	configurators.Int(&JxlEffort, "IMGPROXY_JXL_EFFORT")
 	configurators.Int(&Quality, "IMGPROXY_QUALITY")
 	if err := configurators.ImageTypesQuality(FormatQuality, "IMGPROXY_FORMAT_QUALITY"); err != nil {
 		return err
 	}
+	configurators.Float(&TargetQualitySSIM, "IMGPROXY_TARGET_QUALITY_SSIM")
+	configurators.Int(&TargetQualityMin, "IMGPROXY_TARGET_QUALITY_MIN")
+	configurators.Int(&TargetQualityMax, "IMGPROXY_TARGET_QUALITY_MAX")
+	configurators.Int(&TargetQualityMaxIterations, "IMGPROXY_TARGET_QUALITY_MAX_ITERATIONS")
+	configurators.Int(&MaxBytesMinQuality, "IMGPROXY_MAX_BYTES_MIN_QUALITY")
+	configurators.Int(&MaxBytesMaxDownscales, "IMGPROXY_MAX_BYTES_MAX_DOWNSCALES")
+	configurators.Bool(&MaxBytesFormatFallback, "IMGPROXY_MAX_BYTES_FORMAT_FALLBACK")
+	configurators.Int(&MaxBytesQueryMin, "IMGPROXY_MAX_BYTES_QUERY_MIN")
+	configurators.Int(&SpinMaxFrames, "IMGPROXY_SPIN_MAX_FRAMES")
+	configurators.MegaInt(&SpinMaxResolution, "IMGPROXY_SPIN_MAX_RESOLUTION")
+	configurators.Int(&SpinFrameDelay, "IMGPROXY_SPIN_FRAME_DELAY")
+
+	configurators.Int(&CollageMaxCells, "IMGPROXY_COLLAGE_MAX_CELLS")
+
+	configurators.Int(&PlaceholderSize, "IMGPROXY_PLACEHOLDER_SIZE")
+	configurators.Int(&PlaceholderQuality, "IMGPROXY_PLACEHOLDER_QUALITY")
+	configurators.Bool(&PlaceholderMasterMetadata, "IMGPROXY_PLACEHOLDER_MASTER_METADATA")
+
+	configurators.Int(&PerceptualHashThreshold, "IMGPROXY_PERCEPTUAL_HASH_THRESHOLD")
+	configurators.Bool(&PerceptualHashMasterMetadata, "IMGPROXY_PERCEPTUAL_HASH_MASTER_METADATA")
+
+	configurators.Float(&ExtendBlurSigma, "IMGPROXY_EXTEND_BLUR_SIGMA")
+	configurators.Float(&ExtendBlurBrightness, "IMGPROXY_EXTEND_BLUR_BRIGHTNESS")
 	configurators.Bool(&StripMetadata, "IMGPROXY_STRIP_METADATA")
 	configurators.Bool(&KeepCopyright, "IMGPROXY_KEEP_COPYRIGHT")
+	if err := configurators.StringMap(&MetadataPolicies, "IMGPROXY_METADATA_POLICIES"); err != nil {
+		return err
+	}
 	configurators.Bool(&StripColorProfile, "IMGPROXY_STRIP_COLOR_PROFILE")
 	configurators.Bool(&AutoRotate, "IMGPROXY_AUTO_ROTATE")
 	configurators.Bool(&EnforceThumbnail, "IMGPROXY_ENFORCE_THUMBNAIL")
@@ -639,6 +836,46 @@ func Configure() error {
 
 	configurators.Bool(&LastModifiedEnabled, "IMGPROXY_USE_LAST_MODIFIED")
 
+	configurators.Int(&ResultCacheSize, "IMGPROXY_RESULT_CACHE_SIZE")
+	configurators.Int(&ResultCacheTTL, "IMGPROXY_RESULT_CACHE_TTL")
+
+	configurators.String(&DiskCacheDir, "IMGPROXY_DISK_CACHE_DIR")
+	configurators.Int(&DiskCacheSize, "IMGPROXY_DISK_CACHE_SIZE")
+	configurators.Int(&DiskCacheTTL, "IMGPROXY_DISK_CACHE_TTL")
+	configurators.Bool(&DiskCacheDerivatives, "IMGPROXY_DISK_CACHE_DERIVATIVES")
+
+	configurators.String(&DerivativeStoreBucket, "IMGPROXY_DERIVATIVE_STORE_BUCKET")
+	configurators.Int(&DerivativeStoreTTL, "IMGPROXY_DERIVATIVE_STORE_TTL")
+	configurators.Int(&DerivativeStoreWorkers, "IMGPROXY_DERIVATIVE_STORE_WORKERS")
+	configurators.Int(&DerivativeStoreQueueSize, "IMGPROXY_DERIVATIVE_STORE_QUEUE_SIZE")
+
+	if err := configurators.ImageType(&MasterFormat, "IMGPROXY_MASTER_FORMAT"); err != nil {
+		return err
+	}
+	configurators.Int(&MasterQuality, "IMGPROXY_MASTER_QUALITY")
+	configurators.Bool(&MasterLossless, "IMGPROXY_MASTER_LOSSLESS")
+	configurators.String(&MasterChromaSubsampling, "IMGPROXY_MASTER_CHROMA_SUBSAMPLING")
+	configurators.Bool(&MasterKeepColorProfile, "IMGPROXY_MASTER_KEEP_COLOR_PROFILE")
+	configurators.String(&MasterMetadataPolicy, "IMGPROXY_MASTER_METADATA_POLICY")
+	if err := configurators.ImageTypes(&MasterPassthroughFormats, "IMGPROXY_MASTER_PASSTHROUGH_FORMATS"); err != nil {
+		return err
+	}
+	if err := configurators.IntSlice(&MasterPyramidLevels, "IMGPROXY_MASTER_PYRAMID_LEVELS"); err != nil {
+		return err
+	}
+	configurators.String(&MasterPyramidPrefix, "IMGPROXY_MASTER_PYRAMID_PREFIX")
+	configurators.String(&MasterEditsSuffix, "IMGPROXY_MASTER_EDITS_SUFFIX")
+
+	configurators.StringSlice(&WarmupVariants, "IMGPROXY_WARMUP_VARIANTS")
+	configurators.Int(&WarmupWorkers, "IMGPROXY_WARMUP_WORKERS")
+	configurators.Int(&WarmupQueueSize, "IMGPROXY_WARMUP_QUEUE_SIZE")
+
+	configurators.StringSlice(&CacheTagHeaders, "IMGPROXY_CACHE_TAG_HEADERS")
+	configurators.String(&CacheTagPrefix, "IMGPROXY_CACHE_TAG_PREFIX")
+	configurators.String(&CDNPurgeURL, "IMGPROXY_CDN_PURGE_URL")
+	configurators.String(&CDNPurgeAuthorization, "IMGPROXY_CDN_PURGE_AUTHORIZATION")
+	configurators.Int(&CDNPurgeTimeout, "IMGPROXY_CDN_PURGE_TIMEOUT")
+
 	configurators.String(&BaseURL, "IMGPROXY_BASE_URL")
 	if err := configurators.Replacements(&URLReplacements, "IMGPROXY_URL_REPLACEMENTS"); err != nil {
 		return err
@@ -658,6 +895,10 @@ func Configure() error {
 	configurators.String(&WatermarkURL, "IMGPROXY_WATERMARK_URL")
 	configurators.Float(&WatermarkOpacity, "IMGPROXY_WATERMARK_OPACITY")
 
+	if err := configurators.StringMap(&MaskPaths, "IMGPROXY_MASK_PATHS"); err != nil {
+		return err
+	}
+
 	configurators.String(&FallbackImageData, "IMGPROXY_FALLBACK_IMAGE_DATA")
 	configurators.String(&FallbackImagePath, "IMGPROXY_FALLBACK_IMAGE_PATH")
 	configurators.String(&FallbackImageURL, "IMGPROXY_FALLBACK_IMAGE_URL")
@@ -757,6 +998,27 @@ func Configure() error {
 		return fmt.Errorf("TTL should be greater than or equal to 0, now - %d\n", TTL)
 	}
 
+	if CacheControlSMaxAge < 0 {
+		return fmt.Errorf("Cache-Control s-maxage should be greater than or equal to 0, now - %d\n", CacheControlSMaxAge)
+	}
+
+	if CacheControlStaleWhileRevalidate < 0 {
+		return fmt.Errorf("Cache-Control stale-while-revalidate should be greater than or equal to 0, now - %d\n", CacheControlStaleWhileRevalidate)
+	}
+
+	if CacheControlStaleIfError < 0 {
+		return fmt.Errorf("Cache-Control stale-if-error should be greater than or equal to 0, now - %d\n", CacheControlStaleIfError)
+	}
+
+	for status, ttl := range CacheControlStatusTTLs {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("Invalid HTTP status in Cache-Control status TTLs: %d", status)
+		}
+		if ttl < 0 {
+			return fmt.Errorf("Cache-Control TTL for status %d should be greater than or equal to 0, now - %d\n", status, ttl)
+		}
+	}
+
 	if MaxSrcResolution <= 0 {
 		return fmt.Errorf("Max src resolution should be greater than 0, now - %d\n", MaxSrcResolution)
 	}
@@ -779,12 +1041,32 @@ func Configure() error {
 		return fmt.Errorf("Png quantization colors can't be greater than 256, now - %d\n", PngQuantizationColors)
 	}
 
+	if WebpMethod < 0 {
+		return fmt.Errorf("WebP method should be greater than or equal to 0, now - %d\n", WebpMethod)
+	} else if WebpMethod > 6 {
+		return fmt.Errorf("WebP method can't be greater than 6, now - %d\n", WebpMethod)
+	}
+
+	if WebpAlphaQuality < 0 {
+		return fmt.Errorf("WebP alpha quality should be greater than or equal to 0, now - %d\n", WebpAlphaQuality)
+	} else if WebpAlphaQuality > 100 {
+		return fmt.Errorf("WebP alpha quality can't be greater than 100, now - %d\n", WebpAlphaQuality)
+	}
+
 	if AvifSpeed < 0 {
 		return fmt.Errorf("Avif speed should be greater than or equal to 0, now - %d\n", AvifSpeed)
 	} else if AvifSpeed > 9 {
 		return fmt.Errorf("Avif speed can't be greater than 9, now - %d\n", AvifSpeed)
 	}
 
+	if AvifAnimationMaxFrames <= 0 {
+		return fmt.Errorf("Avif animation max frames should be greater than 0, now - %d\n", AvifAnimationMaxFrames)
+	}
+
+	if AvifAnimationMaxResolution < 0 {
+		return fmt.Errorf("Avif animation max resolution should be greater than or equal to 0, now - %d\n", AvifAnimationMaxResolution)
+	}
+
 	if JxlEffort < 1 {
 		return fmt.Errorf("JXL effort should be greater than 0, now - %d\n", JxlEffort)
 	} else if JxlEffort > 9 {
@@ -797,6 +1079,76 @@ func Configure() error {
 		return fmt.Errorf("Quality can't be greater than 100, now - %d\n", Quality)
 	}
 
+	if TargetQualitySSIM < 0 {
+		return fmt.Errorf("Target quality SSIM should be greater than or equal to 0, now - %f\n", TargetQualitySSIM)
+	} else if TargetQualitySSIM >= 1 {
+		return fmt.Errorf("Target quality SSIM should be less than 1, now - %f\n", TargetQualitySSIM)
+	}
+
+	if TargetQualityMin <= 0 {
+		return fmt.Errorf("Target quality min should be greater than 0, now - %d\n", TargetQualityMin)
+	} else if TargetQualityMax > 100 {
+		return fmt.Errorf("Target quality max can't be greater than 100, now - %d\n", TargetQualityMax)
+	} else if TargetQualityMin > TargetQualityMax {
+		return fmt.Errorf("Target quality min can't be greater than target quality max, now - %d > %d\n", TargetQualityMin, TargetQualityMax)
+	}
+
+	if TargetQualityMaxIterations <= 0 {
+		return fmt.Errorf("Target quality max iterations should be greater than 0, now - %d\n", TargetQualityMaxIterations)
+	}
+
+	if MaxBytesMinQuality <= 0 {
+		return fmt.Errorf("Max bytes min quality should be greater than 0, now - %d\n", MaxBytesMinQuality)
+	} else if MaxBytesMinQuality > 100 {
+		return fmt.Errorf("Max bytes min quality can't be greater than 100, now - %d\n", MaxBytesMinQuality)
+	}
+
+	if MaxBytesMaxDownscales < 0 {
+		return fmt.Errorf("Max bytes max downscales should be greater than or equal to 0, now - %d\n", MaxBytesMaxDownscales)
+	}
+
+	if MaxBytesQueryMin < 0 {
+		return fmt.Errorf("Max bytes query min should be greater than or equal to 0, now - %d\n", MaxBytesQueryMin)
+	}
+
+	if SpinMaxFrames <= 0 {
+		return fmt.Errorf("Spin max frames should be greater than 0, now - %d\n", SpinMaxFrames)
+	}
+
+	if SpinMaxResolution < 0 {
+		return fmt.Errorf("Spin max resolution should be greater than or equal to 0, now - %d\n", SpinMaxResolution)
+	}
+
+	if SpinFrameDelay <= 0 {
+		return fmt.Errorf("Spin frame delay should be greater than 0, now - %d\n", SpinFrameDelay)
+	}
+
+	if CollageMaxCells <= 0 {
+		return fmt.Errorf("Collage max cells should be greater than 0, now - %d\n", CollageMaxCells)
+	}
+
+	// ThumbHash doesn't support images larger than 100x100
+	if PlaceholderSize <= 0 || PlaceholderSize > 100 {
+		return fmt.Errorf("Placeholder size should be between 1 and 100, now - %d\n", PlaceholderSize)
+	}
+
+	if PlaceholderQuality <= 0 || PlaceholderQuality > 100 {
+		return fmt.Errorf("Placeholder quality should be between 1 and 100, now - %d\n", PlaceholderQuality)
+	}
+
+	// Hashes are 64-bit
+	if PerceptualHashThreshold < 0 || PerceptualHashThreshold > 64 {
+		return fmt.Errorf("Perceptual hash threshold should be between 0 and 64, now - %d\n", PerceptualHashThreshold)
+	}
+
+	if ExtendBlurSigma <= 0 {
+		return fmt.Errorf("Extend blur sigma should be greater than 0, now - %f\n", ExtendBlurSigma)
+	}
+
+	if ExtendBlurBrightness < 0 || ExtendBlurBrightness > 1 {
+		return fmt.Errorf("Extend blur brightness should be between 0 and 1, now - %f\n", ExtendBlurBrightness)
+	}
+
 	if len(PreferredFormats) == 0 {
 		return errors.New("At least one preferred format should be specified")
 	}
@@ -839,6 +1191,74 @@ func Configure() error {
 		return errors.New("Fallback image HTTP code should be between 100 and 599")
 	}
 
+	if ResultCacheSize < 0 {
+		return fmt.Errorf("Result cache size should be greater than or equal to 0, now - %d\n", ResultCacheSize)
+	}
+
+	if ResultCacheTTL <= 0 {
+		return fmt.Errorf("Result cache TTL should be greater than 0, now - %d\n", ResultCacheTTL)
+	}
+
+	if len(DiskCacheDir) > 0 {
+		if DiskCacheSize <= 0 {
+			return fmt.Errorf("Disk cache size should be greater than 0, now - %d\n", DiskCacheSize)
+		}
+
+		if DiskCacheTTL < 0 {
+			return fmt.Errorf("Disk cache TTL should be greater than or equal to 0, now - %d\n", DiskCacheTTL)
+		}
+	}
+
+	if DerivativeStoreTTL < 0 {
+		return fmt.Errorf("Derivative store TTL should be greater than or equal to 0, now - %d\n", DerivativeStoreTTL)
+	}
+
+	if DerivativeStoreWorkers <= 0 {
+		return fmt.Errorf("Derivative store workers number should be greater than 0, now - %d\n", DerivativeStoreWorkers)
+	}
+
+	if DerivativeStoreQueueSize < 0 {
+		return fmt.Errorf("Derivative store queue size should be greater than or equal to 0, now - %d\n", DerivativeStoreQueueSize)
+	}
+
+	if MasterQuality < 0 || MasterQuality > 100 {
+		return fmt.Errorf("Master quality should be between 0 and 100, now - %d\n", MasterQuality)
+	}
+
+	switch MasterChromaSubsampling {
+	case "auto", "on", "off":
+	default:
+		return fmt.Errorf("Master chroma subsampling should be one of auto, on, off, now - %s\n", MasterChromaSubsampling)
+	}
+
+	if _, ok := MetadataPolicies[MasterMetadataPolicy]; len(MasterMetadataPolicy) > 0 && !ok {
+		return fmt.Errorf("Master metadata policy is not defined, now - %s\n", MasterMetadataPolicy)
+	}
+
+	for _, l := range MasterPyramidLevels {
+		if l <= 0 {
+			return fmt.Errorf("Master pyramid levels should be greater than 0, now - %d\n", l)
+		}
+	}
+	// Levels are looked up from the smallest one
+	sort.Ints(MasterPyramidLevels)
+
+	if len(MasterPyramidLevels) > 0 && len(strings.Trim(MasterPyramidPrefix, "/")) == 0 {
+		return errors.New("Master pyramid prefix can't be empty")
+	}
+
+	if WarmupWorkers <= 0 {
+		return fmt.Errorf("Warmup workers number should be greater than 0, now - %d\n", WarmupWorkers)
+	}
+
+	if WarmupQueueSize < 0 {
+		return fmt.Errorf("Warmup queue size should be greater than or equal to 0, now - %d\n", WarmupQueueSize)
+	}
+
+	if CDNPurgeTimeout <= 0 {
+		return fmt.Errorf("CDN purge timeout should be greater than 0, now - %d\n", CDNPurgeTimeout)
+	}
+
 	if len(PrometheusBind) > 0 && PrometheusBind == Bind {
 		return errors.New("Can't use the same binding for the main server and Prometheus")
 	}
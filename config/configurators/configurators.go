@@ -86,6 +86,26 @@ func StringSliceFile(s *[]string, filepath string) error {
 	return nil
 }
 
+func IntSlice(s *[]int, name string) error {
+	if env := os.Getenv(name); len(env) > 0 {
+		parts := strings.Split(env, ",")
+
+		ints := make([]int, 0, len(parts))
+
+		for _, p := range parts {
+			i, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return fmt.Errorf("Invalid %s: %s", name, p)
+			}
+			ints = append(ints, i)
+		}
+
+		*s = ints
+	}
+
+	return nil
+}
+
 func StringMap(m *map[string]string, name string) error {
 	if env := os.Getenv(name); len(env) > 0 {
 		mm := make(map[string]string)
@@ -106,6 +126,35 @@ func StringMap(m *map[string]string, name string) error {
 	return nil
 }
 
+func IntMap(m *map[int]int, name string) error {
+	if env := os.Getenv(name); len(env) > 0 {
+		mm := make(map[int]int)
+
+		for _, keyvalue := range strings.Split(env, ",") {
+			k, v, ok := strings.Cut(keyvalue, "=")
+			if !ok {
+				return fmt.Errorf("Invalid key/value: %s", keyvalue)
+			}
+
+			key, err := strconv.Atoi(strings.TrimSpace(k))
+			if err != nil {
+				return fmt.Errorf("Invalid key: %s", keyvalue)
+			}
+
+			val, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("Invalid value: %s", keyvalue)
+			}
+
+			mm[key] = val
+		}
+
+		*m = mm
+	}
+
+	return nil
+}
+
 func Bool(b *bool, name string) {
 	if env, err := strconv.ParseBool(os.Getenv(name)); err == nil {
 		*b = env
@@ -131,6 +180,18 @@ func URLPath(s *string, name string) {
 	}
 }
 
+func ImageType(it *imagetype.Type, name string) error {
+	if env := strings.TrimSpace(os.Getenv(name)); len(env) > 0 {
+		if t, ok := imagetype.Types[env]; ok {
+			*it = t
+		} else {
+			return fmt.Errorf("Unknown image format: %s", env)
+		}
+	}
+
+	return nil
+}
+
 func ImageTypes(it *[]imagetype.Type, name string) error {
 	if env := os.Getenv(name); len(env) > 0 {
 		parts := strings.Split(env, ",")
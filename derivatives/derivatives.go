@@ -0,0 +1,122 @@
+package derivatives
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+const metricsName = "derivative"
+
+type upload struct {
+	uri    string
+	data   *imagedata.ImageData
+	header http.Header
+}
+
+var uploadQueue chan upload
+
+// Init starts the upload workers
+func Init() {
+	if !Enabled() {
+		uploadQueue = nil
+		return
+	}
+
+	uploadQueue = make(chan upload, config.DerivativeStoreQueueSize)
+
+	for i := 0; i < config.DerivativeStoreWorkers; i++ {
+		go runUploadWorker(uploadQueue)
+	}
+}
+
+func Enabled() bool {
+	return len(config.DerivativeStoreBucket) > 0
+}
+
+// ObjectURI returns the location of the derivative in the store.
+// Derivatives are grouped under the source image key, and the master ETag
+// is a part of the name, so a new master version never hits stale derivatives
+func ObjectURI(imageURL, poHash, masterETag string, format imagetype.Type) string {
+	ext := "auto"
+	if format != imagetype.Unknown {
+		ext = format.String()
+	}
+
+	return fmt.Sprintf(
+		"s3://%s/%s/%s-%s.%s",
+		config.DerivativeStoreBucket, imageURL, poHash, strings.Trim(masterETag, `"`), ext,
+	)
+}
+
+// Get downloads the derivative from the store.
+// Missing derivatives and the ones older than ttl are reported as misses
+func Get(ctx context.Context, uri string, ttl int, secopts security.Options) (*imagedata.ImageData, bool) {
+	imgdata, err := imagedata.Download(ctx, uri, "derivative image", imagedata.DownloadOptions{}, secopts)
+	if err != nil {
+		log.Debugf("Derivative %s is not available: %s", uri, err)
+		prometheus.IncrementCacheMisses(metricsName)
+		return nil, false
+	}
+
+	if ttl > 0 {
+		if lm, err := time.Parse(http.TimeFormat, imgdata.Headers["Last-Modified"]); err == nil && time.Since(lm) > time.Duration(ttl)*time.Second {
+			imgdata.Close()
+			prometheus.IncrementCacheMisses(metricsName)
+			return nil, false
+		}
+	}
+
+	prometheus.IncrementCacheHits(metricsName)
+
+	return imgdata, true
+}
+
+// Put queues the derivative upload to the store.
+// The data is copied, so the caller is free to release the buffer.
+// If the queue is full, the derivative is not stored.
+// Expires is informational only: the store doesn't delete expired derivatives,
+// this is up to the bucket lifecycle rules
+func Put(uri string, imgdata *imagedata.ImageData, ttl int) {
+	if uploadQueue == nil {
+		return
+	}
+
+	header := http.Header{"Content-Type": {imgdata.Type.Mime()}}
+	if ttl > 0 {
+		header.Set("Expires", time.Now().Add(time.Duration(ttl)*time.Second).UTC().Format(http.TimeFormat))
+	}
+
+	u := upload{
+		uri: uri,
+		data: &imagedata.ImageData{
+			Type: imgdata.Type,
+			Data: append([]byte(nil), imgdata.Data...),
+		},
+		header: header,
+	}
+
+	select {
+	case uploadQueue <- u:
+	default:
+		log.Warningf("Derivative store queue is full, skipping %s", uri)
+	}
+}
+
+func runUploadWorker(queue chan upload) {
+	for u := range queue {
+		if err := imagedata.Upload(context.Background(), u.uri, "derivative image", u.data, imagedata.UploadOptions{Header: u.header}); err != nil {
+			log.Warningf("Can't store derivative %s: %s", u.uri, err)
+		}
+	}
+}
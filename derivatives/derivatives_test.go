@@ -0,0 +1,176 @@
+package derivatives
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+type storedDerivative struct {
+	path   string
+	header http.Header
+	data   []byte
+}
+
+type DerivativesTestSuite struct {
+	suite.Suite
+
+	server *httptest.Server
+
+	data         []byte
+	lastModified time.Time
+	status       int
+	uploads      chan storedDerivative
+}
+
+func (s *DerivativesTestSuite) SetupSuite() {
+	config.Reset()
+	imagedata.Init()
+
+	data, err := os.ReadFile("../testdata/test1.jpg")
+	s.Require().NoError(err)
+
+	s.data = data
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			body, _ := io.ReadAll(r.Body)
+			s.uploads <- storedDerivative{path: r.URL.Path, header: r.Header, data: body}
+			return
+		}
+
+		if s.status != http.StatusOK {
+			rw.WriteHeader(s.status)
+			return
+		}
+
+		rw.Header().Set("Last-Modified", s.lastModified.UTC().Format(http.TimeFormat))
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(s.data)
+	}))
+}
+
+func (s *DerivativesTestSuite) TearDownSuite() {
+	s.server.Close()
+	config.Reset()
+	uploadQueue = nil
+}
+
+func (s *DerivativesTestSuite) SetupTest() {
+	config.Reset()
+	config.AllowLoopbackSourceAddresses = true
+	config.DerivativeStoreBucket = "derivatives"
+
+	s.status = http.StatusOK
+	s.lastModified = time.Now()
+	s.uploads = make(chan storedDerivative, 8)
+	uploadQueue = nil
+}
+
+func (s *DerivativesTestSuite) TestObjectURI() {
+	s.Require().Equal(
+		"s3://derivatives/cars/1.jpg/hash-abc.webp",
+		ObjectURI("cars/1.jpg", "hash", `"abc"`, imagetype.WEBP),
+	)
+
+	// The format is chosen per request when it's not set explicitly
+	s.Require().Equal(
+		"s3://derivatives/cars/1.jpg/hash-abc.auto",
+		ObjectURI("cars/1.jpg", "hash", `"abc"`, imagetype.Unknown),
+	)
+
+	// A new master version never points to the old derivative
+	s.Require().NotEqual(
+		ObjectURI("cars/1.jpg", "hash", `"abc"`, imagetype.WEBP),
+		ObjectURI("cars/1.jpg", "hash", `"def"`, imagetype.WEBP),
+	)
+}
+
+func (s *DerivativesTestSuite) TestGet() {
+	imgdata, ok := Get(context.Background(), s.server.URL+"/d.jpg", 3600, security.DefaultOptions())
+	s.Require().True(ok)
+	defer imgdata.Close()
+
+	s.Require().Equal(s.data, imgdata.Data)
+}
+
+func (s *DerivativesTestSuite) TestGetMissing() {
+	s.status = http.StatusNotFound
+
+	_, ok := Get(context.Background(), s.server.URL+"/d.jpg", 3600, security.DefaultOptions())
+	s.Require().False(ok)
+}
+
+func (s *DerivativesTestSuite) TestGetExpired() {
+	s.lastModified = time.Now().Add(-2 * time.Hour)
+
+	_, ok := Get(context.Background(), s.server.URL+"/d.jpg", 3600, security.DefaultOptions())
+	s.Require().False(ok)
+
+	// Zero TTL never expires
+	imgdata, ok := Get(context.Background(), s.server.URL+"/d.jpg", 0, security.DefaultOptions())
+	s.Require().True(ok)
+	imgdata.Close()
+}
+
+func (s *DerivativesTestSuite) TestPut() {
+	Init()
+
+	data := append([]byte(nil), s.data...)
+
+	Put(s.server.URL+"/d.jpg", &imagedata.ImageData{Type: imagetype.JPEG, Data: data}, 3600)
+
+	// The data is copied, so the caller can release the buffer right away
+	data[0] = 0
+
+	select {
+	case u := <-s.uploads:
+		s.Require().Equal("/d.jpg", u.path)
+		s.Require().Equal(s.data, u.data)
+		s.Require().Equal("image/jpeg", u.header.Get("Content-Type"))
+
+		expires, err := time.Parse(http.TimeFormat, u.header.Get("Expires"))
+		s.Require().NoError(err)
+		s.Require().WithinDuration(time.Now().Add(time.Hour), expires, time.Minute)
+	case <-time.After(5 * time.Second):
+		s.Fail("Derivative is not uploaded")
+	}
+}
+
+func (s *DerivativesTestSuite) TestPutDisabled() {
+	config.DerivativeStoreBucket = ""
+	Init()
+
+	Put(s.server.URL+"/d.jpg", &imagedata.ImageData{Type: imagetype.JPEG, Data: s.data}, 0)
+
+	s.Require().Nil(uploadQueue)
+}
+
+func (s *DerivativesTestSuite) TestPutDropsWhenQueueIsFull() {
+	// No workers, so the queue is never drained
+	uploadQueue = make(chan upload, 1)
+
+	Put(s.server.URL+"/a.jpg", &imagedata.ImageData{Type: imagetype.JPEG, Data: s.data}, 0)
+	Put(s.server.URL+"/b.jpg", &imagedata.ImageData{Type: imagetype.JPEG, Data: s.data}, 0)
+
+	s.Require().Len(uploadQueue, 1)
+
+	u := <-uploadQueue
+	s.Require().Equal(s.server.URL+"/a.jpg", u.uri)
+	s.Require().Empty(u.header.Get("Expires"))
+}
+
+func TestDerivatives(t *testing.T) {
+	suite.Run(t, new(DerivativesTestSuite))
+}
@@ -0,0 +1,338 @@
+package diskcache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/lru"
+	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+const (
+	metricsName = "disk"
+
+	tmpSuffix = ".tmp"
+
+	// Max size of the serialized headers stored before the image data
+	maxHeaderSize = 64 * 1024
+)
+
+// header is stored at the beginning of every cache file
+type header struct {
+	CreatedAt int64             `json:"created_at"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+var (
+	dir   string
+	index *lru.Cache[struct{}]
+)
+
+func Init() error {
+	if len(config.DiskCacheDir) == 0 {
+		index = nil
+		return nil
+	}
+
+	dir = config.DiskCacheDir
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("Can't create disk cache directory: %s", err)
+	}
+
+	index = lru.New(int64(config.DiskCacheSize), func(name string, _ struct{}) {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warningf("Can't remove disk cache file %s: %s", name, err)
+		}
+		prometheus.IncrementCacheEvictions(metricsName)
+	})
+
+	if err := loadIndex(); err != nil {
+		return fmt.Errorf("Can't load disk cache index: %s", err)
+	}
+
+	prometheus.AddGaugeFunc(
+		"disk_cache_bytes",
+		"A gauge of the disk cache size in bytes.",
+		func() float64 { return float64(index.Cost()) },
+	)
+	prometheus.AddGaugeFunc(
+		"disk_cache_entries",
+		"A gauge of the number of files in the disk cache.",
+		func() float64 { return float64(index.Len()) },
+	)
+
+	return nil
+}
+
+func Enabled() bool {
+	return index != nil
+}
+
+// DerivativesEnabled returns true if processed images should be cached on disk too
+func DerivativesEnabled() bool {
+	return Enabled() && config.DiskCacheDerivatives
+}
+
+// loadIndex restores the index from the files left by the previous run.
+// Files are added from the oldest to the newest so the LRU order survives restarts
+// as long as access times are preserved
+func loadIndex() error {
+	type file struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []file
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		// Leftovers of interrupted writes
+		if strings.HasSuffix(path, tmpSuffix) {
+			os.Remove(path)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// The index would never track files larger than the whole cache
+		// (e.g. after the cache size is reduced), so they'd stay on disk forever
+		if info.Size() > index.MaxCost() {
+			os.Remove(path)
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, file{name: name, size: info.Size(), modTime: info.ModTime()})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for _, f := range files {
+		index.Set(f.name, struct{}{}, f.size, 0)
+	}
+
+	return nil
+}
+
+func fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	h := hex.EncodeToString(sum[:])
+
+	return filepath.Join(h[:2], h)
+}
+
+// Get reads the cached image stored under the key.
+// Any read error is treated as a cache miss
+func Get(key, desc string, secopts security.Options) (*imagedata.ImageData, bool) {
+	if !Enabled() {
+		return nil, false
+	}
+
+	name := fileName(key)
+
+	if _, ok := index.Get(name); !ok {
+		prometheus.IncrementCacheMisses(metricsName)
+		return nil, false
+	}
+
+	imgdata, err := read(name, desc, secopts)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warningf("Can't read disk cache file %s: %s", name, err)
+		}
+
+		index.Delete(name)
+		os.Remove(filepath.Join(dir, name))
+
+		prometheus.IncrementCacheMisses(metricsName)
+		return nil, false
+	}
+
+	prometheus.IncrementCacheHits(metricsName)
+
+	return imgdata, true
+}
+
+func read(name, desc string, secopts security.Options) (*imagedata.ImageData, error) {
+	path := filepath.Join(dir, name)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(f)
+
+	var headerSize uint32
+	if err = binary.Read(br, binary.BigEndian, &headerSize); err != nil {
+		return nil, err
+	}
+
+	if headerSize > maxHeaderSize {
+		return nil, errors.New("invalid header size")
+	}
+
+	var h header
+	if err = json.NewDecoder(io.LimitReader(br, int64(headerSize))).Decode(&h); err != nil {
+		return nil, err
+	}
+
+	if config.DiskCacheTTL > 0 && time.Since(time.Unix(h.CreatedAt, 0)) > time.Duration(config.DiskCacheTTL)*time.Second {
+		return nil, fs.ErrNotExist
+	}
+
+	// The buffered reader may have read past the header, so seek to the data explicitly
+	dataSize := fi.Size() - 4 - int64(headerSize)
+	if _, err = f.Seek(4+int64(headerSize), io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	imgdata, err := imagedata.FromReader(f, int(dataSize), desc, secopts)
+	if err != nil {
+		return nil, err
+	}
+
+	imgdata.Headers = h.Headers
+
+	// Keep the access time on disk so the LRU order survives restarts
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return imgdata, nil
+}
+
+// Set stores the image under the key. The file is written to a temporary
+// location and then renamed, so a crash never leaves a partially written entry
+func Set(key string, imgdata *imagedata.ImageData) {
+	if !Enabled() {
+		return
+	}
+
+	name := fileName(key)
+
+	hdata, err := json.Marshal(header{
+		CreatedAt: time.Now().Unix(),
+		Headers:   imgdata.Headers,
+	})
+	if err != nil {
+		log.Warningf("Can't write disk cache file %s: %s", name, err)
+		return
+	}
+
+	// The index rejects entries larger than the whole cache,
+	// so don't write files that would never be tracked
+	size := int64(4 + len(hdata) + len(imgdata.Data))
+	if size > index.MaxCost() {
+		return
+	}
+
+	if err = write(name, hdata, imgdata.Data); err != nil {
+		log.Warningf("Can't write disk cache file %s: %s", name, err)
+		return
+	}
+
+	index.Set(name, struct{}{}, size, 0)
+}
+
+func write(name string, hdata, data []byte) error {
+	path := filepath.Join(dir, name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	if len(hdata) > maxHeaderSize {
+		return errors.New("headers are too large")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := f.Name()
+
+	err = func() error {
+		defer f.Close()
+
+		if err := binary.Write(f, binary.BigEndian, uint32(len(hdata))); err != nil {
+			return err
+		}
+		if _, err := f.Write(hdata); err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+
+		return f.Sync()
+	}()
+
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the entry stored under the key
+func Delete(key string) {
+	if !Enabled() {
+		return
+	}
+
+	name := fileName(key)
+
+	index.Delete(name)
+
+	if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warningf("Can't remove disk cache file %s: %s", name, err)
+	}
+}
@@ -0,0 +1,157 @@
+package diskcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+type DiskCacheTestSuite struct {
+	suite.Suite
+
+	data []byte
+}
+
+func (s *DiskCacheTestSuite) SetupSuite() {
+	config.Reset()
+	imagedata.Init()
+
+	data, err := os.ReadFile("../testdata/test1.jpg")
+	s.Require().NoError(err)
+
+	s.data = data
+}
+
+func (s *DiskCacheTestSuite) SetupTest() {
+	config.Reset()
+	config.DiskCacheDir = s.T().TempDir()
+
+	s.Require().NoError(Init())
+}
+
+func (s *DiskCacheTestSuite) TearDownSuite() {
+	config.Reset()
+	s.Require().NoError(Init())
+}
+
+func (s *DiskCacheTestSuite) set(key string) {
+	Set(key, &imagedata.ImageData{
+		Data:    s.data,
+		Headers: map[string]string{"ETag": `"` + key + `"`},
+	})
+}
+
+func (s *DiskCacheTestSuite) path(key string) string {
+	return filepath.Join(config.DiskCacheDir, fileName(key))
+}
+
+func (s *DiskCacheTestSuite) TestSetGet() {
+	_, ok := Get("a", "test", security.DefaultOptions())
+	s.Require().False(ok)
+
+	s.set("a")
+
+	imgdata, ok := Get("a", "test", security.DefaultOptions())
+	s.Require().True(ok)
+	defer imgdata.Close()
+
+	s.Require().Equal(s.data, imgdata.Data)
+	s.Require().Equal(map[string]string{"ETag": `"a"`}, imgdata.Headers)
+}
+
+func (s *DiskCacheTestSuite) TestGetExpired() {
+	config.DiskCacheTTL = 1
+
+	s.set("a")
+
+	// Rewrite the entry as if it was created long ago
+	s.Require().NoError(write(fileName("a"), []byte(`{"created_at":1}`), s.data))
+
+	_, ok := Get("a", "test", security.DefaultOptions())
+	s.Require().False(ok)
+	s.Require().NoFileExists(s.path("a"))
+}
+
+func (s *DiskCacheTestSuite) TestDelete() {
+	s.set("a")
+	s.Require().FileExists(s.path("a"))
+
+	Delete("a")
+
+	s.Require().NoFileExists(s.path("a"))
+
+	_, ok := Get("a", "test", security.DefaultOptions())
+	s.Require().False(ok)
+}
+
+func (s *DiskCacheTestSuite) TestEvictionRemovesFiles() {
+	// Room for a single entry
+	config.DiskCacheSize = len(s.data) + 1024
+	s.Require().NoError(Init())
+
+	s.set("a")
+	s.set("b")
+
+	s.Require().NoFileExists(s.path("a"))
+	s.Require().FileExists(s.path("b"))
+	s.Require().Equal(1, index.Len())
+}
+
+func (s *DiskCacheTestSuite) TestSetSkipsOversizedEntries() {
+	config.DiskCacheSize = len(s.data) / 2
+	s.Require().NoError(Init())
+
+	s.set("a")
+
+	s.Require().NoFileExists(s.path("a"))
+	s.Require().Zero(index.Len())
+}
+
+func (s *DiskCacheTestSuite) TestInitRebuildsIndex() {
+	s.set("a")
+	s.set("b")
+
+	s.Require().NoError(Init())
+	s.Require().Equal(2, index.Len())
+
+	imgdata, ok := Get("a", "test", security.DefaultOptions())
+	s.Require().True(ok)
+	defer imgdata.Close()
+
+	s.Require().Equal(s.data, imgdata.Data)
+}
+
+func (s *DiskCacheTestSuite) TestInitRemovesTmpFiles() {
+	s.set("a")
+
+	// Leftover of an interrupted write
+	tmpPath := s.path("a") + "-1234" + tmpSuffix
+	s.Require().NoError(os.WriteFile(tmpPath, []byte("partial"), 0o644))
+
+	s.Require().NoError(Init())
+
+	s.Require().NoFileExists(tmpPath)
+	s.Require().FileExists(s.path("a"))
+	s.Require().Equal(1, index.Len())
+}
+
+func (s *DiskCacheTestSuite) TestInitRemovesOversizedFiles() {
+	s.set("a")
+
+	// The cache size was reduced since the previous run
+	config.DiskCacheSize = len(s.data) / 2
+	s.Require().NoError(Init())
+
+	s.Require().NoFileExists(s.path("a"))
+	s.Require().Zero(index.Len())
+}
+
+func TestDiskCache(t *testing.T) {
+	suite.Run(t, new(DiskCacheTestSuite))
+}
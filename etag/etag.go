@@ -101,6 +101,11 @@ func (h *Handler) SetActualProcessingOptions(po *options.ProcessingOptions) bool
 	return h.ProcessingOptionsMatch()
 }
 
+// ProcessingOptionsHash returns the hash calculated by SetActualProcessingOptions
+func (h *Handler) ProcessingOptionsHash() string {
+	return h.poHashActual
+}
+
 func (h *Handler) ImageEtagExpected() string {
 	return h.imgEtagExpected
 }
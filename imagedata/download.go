@@ -303,6 +303,79 @@ func download(ctx context.Context, imageURL string, opts DownloadOptions, secopt
 	return imgdata, nil
 }
 
+// downloadPrefix requests the first size bytes of the image with a ranged request.
+// It returns the data along with the full size of the image.
+// Sources that don't support ranges respond with the whole image
+func downloadPrefix(ctx context.Context, imageURL string, size int, opts DownloadOptions, secopts security.Options) (*ImageData, int, error) {
+	// We use this for testing
+	if len(redirectAllRequestsTo) > 0 {
+		imageURL = redirectAllRequestsTo
+	}
+
+	header := opts.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Range", "bytes=0-"+strconv.Itoa(size-1))
+
+	req, reqCancel, err := BuildImageRequest(ctx, imageURL, header, opts.CookieJar)
+	defer reqCancel()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, err := SendRequest(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		// The range is ignored, so we've got the whole image
+		if res.Header.Get("Content-Encoding") == "gzip" {
+			return nil, 0, newImagePartialResponseError("Ranged response is compressed")
+		}
+
+		imgdata, err := readAndCheckImage(res.Body, int(res.ContentLength), secopts)
+		if err != nil {
+			return nil, 0, ierrors.Wrap(err, 0)
+		}
+
+		imgdata.Headers = headersToStore(res)
+
+		return imgdata, len(imgdata.Data), nil
+
+	case http.StatusPartialContent:
+		rangeParts := contentRangeRe.FindStringSubmatch(res.Header.Get("Content-Range"))
+		if len(rangeParts) == 0 || rangeParts[1] == "*" || rangeParts[2] != "0" || rangeParts[4] == "*" {
+			return nil, 0, newImagePartialResponseError("Partial response with invalid Content-Range header")
+		}
+
+		total, _ := strconv.Atoi(rangeParts[4])
+		if err = security.CheckFileSize(total, secopts); err != nil {
+			return nil, 0, err
+		}
+
+		data, err := io.ReadAll(io.LimitReader(res.Body, int64(size)))
+		if err != nil {
+			return nil, 0, wrapError(err)
+		}
+
+		return &ImageData{Data: data, Headers: headersToStore(res)}, total, nil
+
+	default:
+		var body string
+
+		if strings.HasPrefix(res.Header.Get("Content-Type"), "text/") {
+			bbody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+			body = string(bbody)
+		}
+
+		return nil, 0, newImageResponseStatusError(res.StatusCode, body)
+	}
+}
+
 func RedirectAllRequestsTo(u string) {
 	redirectAllRequestsTo = u
 }
@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
@@ -20,6 +23,8 @@ var (
 	BWWatermark     *ImageData
 	BWWatermarkV2     *ImageData
 	ArtifactMap map[string] *ImageData = make(map[string]*ImageData)
+	// MaskMap holds the mask images by their names
+	MaskMap = make(map[string]*ImageData)
 	FallbackImage *ImageData
 )
 
@@ -97,6 +102,15 @@ func loadWatermarkAndArtifacts() error {
 		}
 	}
 
+	// Download masks
+	for name, url := range config.MaskPaths {
+		mask, err := Download(ctx, url, "mask", DownloadOptions{}, security.DefaultOptions())
+		if err != nil {
+			return fmt.Errorf("failed to download mask %s from %s: %w", name, url, err)
+		}
+		MaskMap[name] = mask
+	}
+
 	return nil
 }
 
@@ -154,6 +168,15 @@ func FromFile(path, desc string, secopts security.Options) (*ImageData, error) {
 	return imgdata, nil
 }
 
+func FromReader(r io.Reader, size int, desc string, secopts security.Options) (*ImageData, error) {
+	imgdata, err := readAndCheckImage(r, size, secopts)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read %s: %s", desc, err)
+	}
+
+	return imgdata, nil
+}
+
 func Download(ctx context.Context, imageURL, desc string, opts DownloadOptions, secopts security.Options) (*ImageData, error) {
 	imgdata, err := download(ctx, imageURL, opts, secopts)
 	if err != nil {
@@ -166,13 +189,47 @@ func Download(ctx context.Context, imageURL, desc string, opts DownloadOptions,
 	return imgdata, nil
 }
 
-func Upload(ctx context.Context, imageURL, desc string, data *ImageData) (error) {
-	err := upload(ctx, imageURL, data.Data)
+// DownloadPrefix downloads the first size bytes of the image and returns them along
+// with the full size of the image. The data may be the whole image if it's not larger
+// than size or if the source doesn't support ranges. The data type is not detected,
+// since the prefix may not contain the image header
+func DownloadPrefix(ctx context.Context, imageURL, desc string, size int, opts DownloadOptions, secopts security.Options) (*ImageData, int, error) {
+	imgdata, total, err := downloadPrefix(ctx, imageURL, size, opts, secopts)
+	if err != nil {
+		return nil, 0, ierrors.Wrap(
+			err, 0,
+			ierrors.WithPrefix(fmt.Sprintf("Can't download %s", desc)),
+		)
+	}
+
+	return imgdata, total, nil
+}
+
+// Upload stores the image data at the URL. The ETag and Last-Modified of the stored
+// object are saved to the data headers, the same way as for downloaded images.
+// If the storage doesn't return Last-Modified, the upload time is used
+func Upload(ctx context.Context, imageURL, desc string, data *ImageData, opts UploadOptions) error {
+	header, err := upload(ctx, imageURL, data.Data, opts)
 	if err != nil {
 		return ierrors.Wrap(
 			err, 0,
 			ierrors.WithPrefix(fmt.Sprintf("Can't upload %s", desc)),
 		)
 	}
+
+	if data.Headers == nil {
+		data.Headers = make(map[string]string)
+	}
+
+	if etag := header.Get("ETag"); len(etag) > 0 {
+		data.Headers["ETag"] = etag
+	}
+
+	if lastModified := header.Get("Last-Modified"); len(lastModified) > 0 {
+		data.Headers["Last-Modified"] = lastModified
+	} else {
+		data.Headers["Last-Modified"] = time.Now().UTC().Format(http.TimeFormat)
+	}
+
 	return nil
 }
@@ -302,6 +302,31 @@ func (s *ImageDataTestSuite) TestFromBase64() {
 	s.Require().Equal(imagetype.JPEG, imgdata.Type)
 }
 
+func (s *ImageDataTestSuite) TestDownloadPrefixPartialContent() {
+	s.status = http.StatusPartialContent
+	s.data = s.defaultData[:1024]
+	s.header.Set("Content-Range", fmt.Sprintf("bytes 0-1023/%d", len(s.defaultData)))
+
+	s.check = func(r *http.Request) {
+		s.Require().Equal("bytes=0-1023", r.Header.Get("Range"))
+	}
+
+	imgdata, total, err := DownloadPrefix(context.Background(), s.server.URL, "Test image", 1024, DownloadOptions{}, security.DefaultOptions())
+
+	s.Require().NoError(err)
+	s.Require().Equal(s.defaultData[:1024], imgdata.Data)
+	s.Require().Equal(len(s.defaultData), total)
+}
+
+func (s *ImageDataTestSuite) TestDownloadPrefixRangeIgnored() {
+	imgdata, total, err := DownloadPrefix(context.Background(), s.server.URL, "Test image", 1024, DownloadOptions{}, security.DefaultOptions())
+
+	s.Require().NoError(err)
+	s.Require().Equal(s.defaultData, imgdata.Data)
+	s.Require().Equal(imagetype.JPEG, imgdata.Type)
+	s.Require().Equal(len(s.defaultData), total)
+}
+
 func TestImageData(t *testing.T) {
 	suite.Run(t, new(ImageDataTestSuite))
 }
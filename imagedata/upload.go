@@ -3,24 +3,52 @@ package imagedata
 import (
 	"bytes"
 	"context"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/imgproxy/imgproxy/v3/config"
+	transportCommon "github.com/imgproxy/imgproxy/v3/transport/common"
 )
 
-func upload(ctx context.Context, imageURL string, data []byte) error {
-	clientCopy := *downloadClient
-	client := &clientCopy
-	reqCtx, reqCancel := func() (context.Context, context.CancelFunc) {
-		var timeout time.Duration = time.Duration(config.DownloadTimeout) * time.Second
-		return context.WithDeadline(ctx, time.Now().Add(timeout))
-	}()
+type UploadOptions struct {
+	Header http.Header
+}
+
+func upload(ctx context.Context, imageURL string, data []byte, opts UploadOptions) (http.Header, error) {
+	reqCtx, reqCancel := context.WithTimeout(ctx, time.Duration(config.DownloadTimeout)*time.Second)
+	defer reqCancel()
+
+	imageURL = transportCommon.EscapeURL(imageURL)
+
 	req, err := http.NewRequestWithContext(reqCtx, "PUT", imageURL, bytes.NewReader(data))
 	if err != nil {
-		reqCancel()
-		return newImageRequestError(err)
+		return nil, newImageRequestError(err)
+	}
+
+	for k, v := range opts.Header {
+		if len(v) > 0 {
+			req.Header.Set(k, v[0])
+		}
+	}
+
+	res, err := downloadClient.Do(req)
+	if err != nil {
+		return nil, wrapError(err)
 	}
-	_, err = client.Do(req)
-	return err
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var body string
+
+		if strings.HasPrefix(res.Header.Get("Content-Type"), "text/") {
+			bbody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+			body = string(bbody)
+		}
+
+		return nil, newImageResponseStatusError(res.StatusCode, body)
+	}
+
+	return res.Header, nil
 }
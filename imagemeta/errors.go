@@ -10,6 +10,7 @@ import (
 type (
 	UnknownFormatError struct{}
 	FormatError        string
+	TruncatedError     string
 )
 
 func newUnknownFormatError() error {
@@ -35,3 +36,15 @@ func newFormatError(format, msg string) error {
 }
 
 func (e FormatError) Error() string { return string(e) }
+
+func newTruncatedError(format string) error {
+	return ierrors.Wrap(
+		TruncatedError(fmt.Sprintf("Invalid %s file: metadata is truncated", format)),
+		1,
+		ierrors.WithStatusCode(http.StatusUnprocessableEntity),
+		ierrors.WithPublicMessage("Invalid source image"),
+		ierrors.WithShouldReport(false),
+	)
+}
+
+func (e TruncatedError) Error() string { return string(e) }
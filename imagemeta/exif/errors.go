@@ -0,0 +1,21 @@
+package exif
+
+import (
+	"fmt"
+
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+)
+
+type ExifError string
+
+func newExifError(format string, args ...interface{}) error {
+	return ierrors.Wrap(
+		ExifError(fmt.Sprintf(format, args...)),
+		1,
+		ierrors.WithStatusCode(422),
+		ierrors.WithPublicMessage("Invalid EXIF data"),
+		ierrors.WithShouldReport(false),
+	)
+}
+
+func (e ExifError) Error() string { return string(e) }
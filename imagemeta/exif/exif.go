@@ -0,0 +1,190 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+var (
+	exifHeader   = []byte("Exif\x00\x00")
+	tiffLeHeader = []byte("II\x2A\x00")
+	tiffBeHeader = []byte("MM\x00\x2A")
+)
+
+// TIFF data types
+const (
+	dtByte      = 1
+	dtASCII     = 2
+	dtShort     = 3
+	dtLong      = 4
+	dtRational  = 5
+	dtSLong     = 9
+	dtSRational = 10
+)
+
+var dtSizes = map[uint16]int{
+	dtByte:      1,
+	dtASCII:     1,
+	dtShort:     2,
+	dtLong:      4,
+	dtRational:  8,
+	dtSLong:     4,
+	dtSRational: 8,
+}
+
+// ExifMap holds the parsed EXIF tags by their names. Values are strings,
+// ints, or float64 for rationals. Multi-value tags are slices.
+// GPS tag names start with `GPS`
+type ExifMap map[string]any
+
+// Orientation returns the EXIF orientation or 0 if it's not set
+func (m ExifMap) Orientation() int {
+	if o, ok := m["Orientation"].(int); ok && o >= 1 && o <= 8 {
+		return o
+	}
+	return 0
+}
+
+type parser struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// Parse parses TIFF-structured EXIF data. The `Exif\0\0` header is optional
+func Parse(data []byte, m ExifMap) error {
+	data = bytes.TrimPrefix(data, exifHeader)
+
+	p := parser{data: data}
+
+	switch {
+	case bytes.HasPrefix(data, tiffLeHeader):
+		p.order = binary.LittleEndian
+	case bytes.HasPrefix(data, tiffBeHeader):
+		p.order = binary.BigEndian
+	default:
+		return newExifError("invalid TIFF header")
+	}
+
+	if len(data) < 8 {
+		return newExifError("invalid IFD0 offset")
+	}
+
+	ifd0 := int(p.order.Uint32(data[4:8]))
+
+	pointers, err := p.parseIFD(ifd0, ifd0Tags, m)
+	if err != nil {
+		return err
+	}
+
+	if exifIFD := pointers[tagExifIFDPointer]; exifIFD > 0 && exifIFD != ifd0 {
+		if _, err = p.parseIFD(exifIFD, exifTags, m); err != nil {
+			return err
+		}
+	}
+
+	// GPS is optional, so broken GPS IFD doesn't break the rest
+	if gpsIFD := pointers[tagGPSIFDPointer]; gpsIFD > 0 && gpsIFD != ifd0 {
+		p.parseIFD(gpsIFD, gpsTags, m)
+	}
+
+	return nil
+}
+
+// parseIFD adds the known tags of the IFD to the map and returns the offsets
+// of the sub-IFDs the IFD points to
+func (p parser) parseIFD(offset int, tags map[uint16]string, m ExifMap) (map[uint16]int, error) {
+	if offset < 8 || offset+2 > len(p.data) {
+		return nil, newExifError("invalid IFD offset: %d", offset)
+	}
+
+	count := int(p.order.Uint16(p.data[offset:]))
+	offset += 2
+
+	if offset+count*12 > len(p.data) {
+		return nil, newExifError("IFD is out of bounds")
+	}
+
+	pointers := make(map[uint16]int)
+
+	for i := 0; i < count; i++ {
+		entry := p.data[offset+i*12 : offset+(i+1)*12]
+
+		tag := p.order.Uint16(entry)
+
+		if tag == tagExifIFDPointer || tag == tagGPSIFDPointer {
+			pointers[tag] = int(p.order.Uint32(entry[8:]))
+			continue
+		}
+
+		name, ok := tags[tag]
+		if !ok {
+			continue
+		}
+
+		// Ignore invalid values. If a tag is invalid, just don't add it
+		if v, ok := p.value(entry); ok {
+			m[name] = v
+		}
+	}
+
+	return pointers, nil
+}
+
+func (p parser) value(entry []byte) (any, bool) {
+	dt := p.order.Uint16(entry[2:])
+	count := int(p.order.Uint32(entry[4:]))
+
+	size, ok := dtSizes[dt]
+	if !ok || count <= 0 || count > len(p.data)/size {
+		return nil, false
+	}
+
+	data := entry[8:12]
+	if size*count > 4 {
+		offset := int(p.order.Uint32(entry[8:]))
+		if offset < 0 || offset+size*count > len(p.data) {
+			return nil, false
+		}
+		data = p.data[offset:]
+	}
+
+	if dt == dtASCII {
+		return strings.TrimRight(string(data[:count]), "\x00 "), true
+	}
+
+	values := make([]any, count)
+
+	for i := range values {
+		b := data[i*size:]
+
+		switch dt {
+		case dtByte:
+			values[i] = int(b[0])
+		case dtShort:
+			values[i] = int(p.order.Uint16(b))
+		case dtLong:
+			values[i] = int(p.order.Uint32(b))
+		case dtSLong:
+			values[i] = int(int32(p.order.Uint32(b)))
+		case dtRational:
+			num, den := p.order.Uint32(b), p.order.Uint32(b[4:])
+			if den == 0 {
+				return nil, false
+			}
+			values[i] = float64(num) / float64(den)
+		case dtSRational:
+			num, den := int32(p.order.Uint32(b)), int32(p.order.Uint32(b[4:]))
+			if den == 0 {
+				return nil, false
+			}
+			values[i] = float64(num) / float64(den)
+		}
+	}
+
+	if count == 1 {
+		return values[0], true
+	}
+
+	return values, true
+}
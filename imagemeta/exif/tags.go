@@ -0,0 +1,66 @@
+package exif
+
+const (
+	tagExifIFDPointer = 0x8769
+	tagGPSIFDPointer  = 0x8825
+)
+
+// Tag names by the tag IDs. Tags that are not listed here are skipped
+var (
+	ifd0Tags = map[uint16]string{
+		0x010e: "ImageDescription",
+		0x010f: "Make",
+		0x0110: "Model",
+		0x0112: "Orientation",
+		0x011a: "XResolution",
+		0x011b: "YResolution",
+		0x0128: "ResolutionUnit",
+		0x0131: "Software",
+		0x0132: "DateTime",
+		0x013b: "Artist",
+		0x8298: "Copyright",
+	}
+
+	exifTags = map[uint16]string{
+		0x829a: "ExposureTime",
+		0x829d: "FNumber",
+		0x8822: "ExposureProgram",
+		0x8827: "ISOSpeedRatings",
+		0x9003: "DateTimeOriginal",
+		0x9004: "DateTimeDigitized",
+		0x9010: "OffsetTime",
+		0x9011: "OffsetTimeOriginal",
+		0x9201: "ShutterSpeedValue",
+		0x9202: "ApertureValue",
+		0x9204: "ExposureBiasValue",
+		0x9207: "MeteringMode",
+		0x9209: "Flash",
+		0x920a: "FocalLength",
+		0xa001: "ColorSpace",
+		0xa002: "PixelXDimension",
+		0xa003: "PixelYDimension",
+		0xa402: "ExposureMode",
+		0xa403: "WhiteBalance",
+		0xa405: "FocalLengthIn35mmFilm",
+		0xa431: "BodySerialNumber",
+		0xa433: "LensMake",
+		0xa434: "LensModel",
+	}
+
+	gpsTags = map[uint16]string{
+		0x0000: "GPSVersionID",
+		0x0001: "GPSLatitudeRef",
+		0x0002: "GPSLatitude",
+		0x0003: "GPSLongitudeRef",
+		0x0004: "GPSLongitude",
+		0x0005: "GPSAltitudeRef",
+		0x0006: "GPSAltitude",
+		0x0007: "GPSTimeStamp",
+		0x000c: "GPSSpeedRef",
+		0x000d: "GPSSpeed",
+		0x0010: "GPSImgDirectionRef",
+		0x0011: "GPSImgDirection",
+		0x0012: "GPSMapDatum",
+		0x001d: "GPSDateStamp",
+	}
+)
@@ -23,6 +23,11 @@ type TagKey struct {
 	TagID    byte
 }
 
+// Name returns the tag name or an empty string if the tag is unknown
+func (key TagKey) Name() string {
+	return tagInfoMap[key].Name
+}
+
 type TagInfo struct {
 	Name       string
 	Title      string
@@ -0,0 +1,197 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+)
+
+const (
+	jpegApp1Marker  = 0xe1
+	jpegApp2Marker  = 0xe2
+	jpegApp13Marker = 0xed
+)
+
+var (
+	jpegExifHeader = []byte("Exif\x00\x00")
+	jpegXmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegIccHeader  = []byte("ICC_PROFILE\x00")
+
+	pngXmpKeyword = []byte("XML:com.adobe.xmp\x00")
+)
+
+// Metadata holds the raw metadata blocks of an image
+type Metadata struct {
+	// HasICC is true if the image has an embedded ICC profile
+	HasICC bool
+	// Exif is TIFF-structured EXIF data
+	Exif []byte
+	// XMP is the XMP packet
+	XMP []byte
+	// Photoshop is the Photoshop 3.0 data that holds IPTC
+	Photoshop []byte
+}
+
+// DecodeMetadata finds the metadata blocks in the image data without decoding the image.
+// Formats that are not supported return empty metadata.
+// If the data ends before all the metadata blocks are found, TruncatedError is returned
+// along with the blocks found so far, so the data may be a prefix of the image
+func DecodeMetadata(it imagetype.Type, data []byte) (Metadata, error) {
+	var md Metadata
+
+	switch it {
+	case imagetype.JPEG:
+		return md, decodeJpegMetadata(data, &md)
+	case imagetype.PNG:
+		return md, decodePngMetadata(data, &md)
+	case imagetype.WEBP:
+		return md, decodeWebpMetadata(data, &md)
+	case imagetype.TIFF:
+		// TIFF files are EXIF themselves
+		md.Exif = data
+	}
+
+	return md, nil
+}
+
+func decodeJpegMetadata(data []byte, md *Metadata) error {
+	if len(data) < 2 || data[0] != 0xff || data[1] != jpegSoiMarker {
+		return newFormatError("JPEG", "missing SOI marker")
+	}
+
+	pos := 2
+
+	for pos+2 <= len(data) {
+		// This is not a segment, continue searching
+		if data[pos] != 0xff {
+			pos++
+			continue
+		}
+
+		marker := data[pos+1]
+
+		switch {
+		case marker == 0xff:
+			// Marker can be preceded by fill bytes
+			pos++
+			continue
+		case marker == 0, jpegRst0Marker <= marker && marker <= jpegRst7Marker:
+			pos += 2
+			continue
+		case marker == jpegSosMarker, marker == jpegEoiMarker:
+			// Metadata segments are always before the image data
+			return nil
+		}
+
+		if pos+4 > len(data) {
+			return newTruncatedError("JPEG")
+		}
+
+		n := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if n < 2 {
+			return newFormatError("JPEG", "invalid segment length")
+		}
+		if pos+2+n > len(data) {
+			return newTruncatedError("JPEG")
+		}
+
+		segment := data[pos+4 : pos+2+n]
+
+		switch {
+		case marker == jpegApp1Marker && bytes.HasPrefix(segment, jpegExifHeader):
+			md.Exif = segment[len(jpegExifHeader):]
+		case marker == jpegApp1Marker && bytes.HasPrefix(segment, jpegXmpHeader):
+			md.XMP = segment[len(jpegXmpHeader):]
+		case marker == jpegApp2Marker && bytes.HasPrefix(segment, jpegIccHeader):
+			md.HasICC = true
+		case marker == jpegApp13Marker:
+			md.Photoshop = segment
+		}
+
+		pos += 2 + n
+	}
+
+	return newTruncatedError("JPEG")
+}
+
+func decodePngMetadata(data []byte, md *Metadata) error {
+	if !bytes.HasPrefix(data, pngMagick) {
+		return newFormatError("PNG", "not a PNG image")
+	}
+
+	// Chunk: length (4), type (4), data, CRC (4)
+	for pos := len(pngMagick); pos+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[pos:]))
+		if n < 0 {
+			return newFormatError("PNG", "invalid chunk length")
+		}
+		if pos+12+n > len(data) {
+			return newTruncatedError("PNG")
+		}
+
+		chunk := data[pos+8 : pos+8+n]
+
+		switch string(data[pos+4 : pos+8]) {
+		case "iCCP":
+			md.HasICC = true
+		case "eXIf":
+			md.Exif = chunk
+		case "iTXt":
+			// Keyword, compression flag, compression method, language, translated keyword, text.
+			// Compressed XMP is not supported
+			if bytes.HasPrefix(chunk, pngXmpKeyword) && len(chunk) > len(pngXmpKeyword)+2 && chunk[len(pngXmpKeyword)] == 0 {
+				text := chunk[len(pngXmpKeyword)+2:]
+				for i := 0; i < 2; i++ {
+					if _, text, _ = bytes.Cut(text, []byte{0}); text == nil {
+						break
+					}
+				}
+				md.XMP = text
+			}
+		case "IEND":
+			return nil
+		}
+
+		pos += 12 + n
+	}
+
+	return newTruncatedError("PNG")
+}
+
+func decodeWebpMetadata(data []byte, md *Metadata) error {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return newFormatError("WEBP", "invalid form type")
+	}
+
+	// Chunk: FourCC (4), length (4), data padded to even
+	for pos := 12; pos+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if n < 0 {
+			return newFormatError("WEBP", "invalid chunk length")
+		}
+		if pos+8+n > len(data) {
+			return newTruncatedError("WEBP")
+		}
+
+		chunk := data[pos+8 : pos+8+n]
+
+		switch string(data[pos : pos+4]) {
+		case "ICCP":
+			md.HasICC = true
+		case "EXIF":
+			md.Exif = bytes.TrimPrefix(chunk, jpegExifHeader)
+		case "XMP ":
+			md.XMP = chunk
+		}
+
+		pos += 8 + n + n%2
+	}
+
+	// WebP has no end chunk, so we check the RIFF size
+	if len(data) < int(binary.LittleEndian.Uint32(data[4:]))+8 {
+		return newTruncatedError("WEBP")
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/imagemeta/exif"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+)
+
+type MetadataTestSuite struct {
+	suite.Suite
+}
+
+// exifData builds big-endian EXIF data with Make, Orientation, and Exif IFD with DateTimeOriginal
+func (s *MetadataTestSuite) exifData() []byte {
+	buf := new(bytes.Buffer)
+
+	write := func(v ...any) {
+		for _, x := range v {
+			s.Require().NoError(binary.Write(buf, binary.BigEndian, x))
+		}
+	}
+
+	buf.WriteString("MM\x00\x2A")
+	write(uint32(8))
+
+	// IFD0 at 8: 3 entries, data starts at 8 + 2 + 3*12 + 4 = 50
+	write(uint16(3))
+	write(uint16(0x010f), uint16(2), uint32(6), uint32(50))
+	write(uint16(0x0112), uint16(3), uint32(1), uint16(6), uint16(0))
+	write(uint16(0x8769), uint16(4), uint32(1), uint32(56))
+	write(uint32(0))
+	buf.WriteString("Canon\x00")
+
+	// Exif IFD at 56: 1 entry, data starts at 56 + 2 + 12 + 4 = 74
+	write(uint16(1))
+	write(uint16(0x9003), uint16(2), uint32(20), uint32(74))
+	write(uint32(0))
+	buf.WriteString("2024:05:01 10:20:30\x00")
+
+	return buf.Bytes()
+}
+
+func (s *MetadataTestSuite) TestDecodeJpegMetadata() {
+	exifData := s.exifData()
+
+	jpeg := new(bytes.Buffer)
+	jpeg.Write([]byte{0xff, jpegSoiMarker})
+
+	writeSegment := func(marker byte, header string, data []byte) {
+		jpeg.Write([]byte{0xff, marker})
+		s.Require().NoError(binary.Write(jpeg, binary.BigEndian, uint16(2+len(header)+len(data))))
+		jpeg.WriteString(header)
+		jpeg.Write(data)
+	}
+
+	writeSegment(jpegApp1Marker, "Exif\x00\x00", exifData)
+	writeSegment(jpegApp2Marker, "ICC_PROFILE\x00", []byte{1, 1})
+	writeSegment(jpegApp1Marker, "http://ns.adobe.com/xap/1.0/\x00", []byte("<x:xmpmeta/>"))
+	jpeg.Write([]byte{0xff, jpegSosMarker})
+
+	md, err := DecodeMetadata(imagetype.JPEG, jpeg.Bytes())
+	s.Require().NoError(err)
+
+	s.Require().True(md.HasICC)
+	s.Require().Equal(exifData, md.Exif)
+	s.Require().Equal("<x:xmpmeta/>", string(md.XMP))
+	s.Require().Empty(md.Photoshop)
+
+	exifMap := make(exif.ExifMap)
+	s.Require().NoError(exif.Parse(md.Exif, exifMap))
+
+	s.Require().Equal(exif.ExifMap{
+		"Make":             "Canon",
+		"Orientation":      6,
+		"DateTimeOriginal": "2024:05:01 10:20:30",
+	}, exifMap)
+	s.Require().Equal(6, exifMap.Orientation())
+}
+
+func (s *MetadataTestSuite) TestDecodeTruncatedJpegMetadata() {
+	exifData := s.exifData()
+
+	jpeg := new(bytes.Buffer)
+	jpeg.Write([]byte{0xff, jpegSoiMarker, 0xff, jpegApp1Marker})
+	s.Require().NoError(binary.Write(jpeg, binary.BigEndian, uint16(2+6+len(exifData))))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(exifData)
+	jpeg.Write([]byte{0xff, jpegSosMarker})
+
+	data := jpeg.Bytes()
+
+	var terr TruncatedError
+
+	// The EXIF segment is cut
+	_, err := DecodeMetadata(imagetype.JPEG, data[:20])
+	s.Require().ErrorAs(err, &terr)
+
+	// The EXIF segment is complete, but the image data is not reached yet
+	md, err := DecodeMetadata(imagetype.JPEG, data[:len(data)-2])
+	s.Require().ErrorAs(err, &terr)
+	s.Require().Equal(exifData, md.Exif)
+
+	_, err = DecodeMetadata(imagetype.JPEG, data)
+	s.Require().NoError(err)
+}
+
+func TestMetadata(t *testing.T) {
+	suite.Run(t, new(MetadataTestSuite))
+}
@@ -0,0 +1,154 @@
+package imagemeta
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/imagemeta/exif"
+	"github.com/imgproxy/imgproxy/v3/imagemeta/iptc"
+)
+
+// MetadataPolicy is an allowlist of the metadata fields. Fields are set as
+// `exif:Name`, `iptc:Name`, or `xmp:prefix:name`. The `*` suffix matches any field
+// with the prefix, but wildcards never match GPS fields, so GPS is kept
+// only if it's listed explicitly (e.g. `exif:GPS*`)
+type MetadataPolicy struct {
+	Exif []string
+	Iptc []string
+	XMP  []string
+}
+
+// DefaultMetadataPolicy keeps everything but GPS
+var DefaultMetadataPolicy = &MetadataPolicy{
+	Exif: []string{"*"},
+	Iptc: []string{"*"},
+	XMP:  []string{"*"},
+}
+
+var metadataPolicies map[string]*MetadataPolicy
+
+// ParseMetadataPolicy parses the comma-separated list of fields
+func ParseMetadataPolicy(s string) (*MetadataPolicy, error) {
+	p := new(MetadataPolicy)
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+
+		block, name, _ := strings.Cut(field, ":")
+		if len(name) == 0 {
+			return nil, fmt.Errorf("Invalid metadata field: %s", field)
+		}
+
+		switch block {
+		case "exif":
+			p.Exif = append(p.Exif, name)
+		case "iptc":
+			p.Iptc = append(p.Iptc, name)
+		case "xmp":
+			// XMP properties are qualified with the namespace prefix
+			if name != "*" && !strings.Contains(name, ":") {
+				return nil, fmt.Errorf("Invalid XMP field: %s", field)
+			}
+			p.XMP = append(p.XMP, name)
+		default:
+			return nil, fmt.Errorf("Invalid metadata field: %s", field)
+		}
+	}
+
+	return p, nil
+}
+
+// ParseMetadataPolicies parses the named policies
+func ParseMetadataPolicies(policies map[string]string) error {
+	metadataPolicies = make(map[string]*MetadataPolicy, len(policies))
+
+	for name, s := range policies {
+		p, err := ParseMetadataPolicy(s)
+		if err != nil {
+			return fmt.Errorf("Invalid metadata policy %s: %s", name, err)
+		}
+
+		metadataPolicies[name] = p
+	}
+
+	return nil
+}
+
+// GetMetadataPolicy returns the named policy
+func GetMetadataPolicy(name string) (*MetadataPolicy, bool) {
+	p, ok := metadataPolicies[name]
+	return p, ok
+}
+
+// isGPSField checks if the field holds the location. XMP fields are qualified
+func isGPSField(name string) bool {
+	if _, local, ok := strings.Cut(name, ":"); ok {
+		name = local
+	}
+	return strings.HasPrefix(name, "GPS")
+}
+
+func matchMetadataField(patterns []string, name string) bool {
+	for _, p := range patterns {
+		prefix, wildcard := strings.CutSuffix(p, "*")
+
+		if !wildcard {
+			if p == name {
+				return true
+			}
+			continue
+		}
+
+		if strings.HasPrefix(name, prefix) && (!isGPSField(name) || isGPSField(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KeepExif checks if the EXIF tag is allowed
+func (p *MetadataPolicy) KeepExif(name string) bool {
+	return matchMetadataField(p.Exif, name)
+}
+
+// KeepIptc checks if the IPTC tag is allowed. Envelope record tags are always allowed
+// since they describe the IPTC data itself
+func (p *MetadataPolicy) KeepIptc(key iptc.TagKey) bool {
+	return key.RecordID != 2 || matchMetadataField(p.Iptc, key.Name())
+}
+
+// KeepXMP checks if the XMP property is allowed
+func (p *MetadataPolicy) KeepXMP(name string) bool {
+	return matchMetadataField(p.XMP, name)
+}
+
+// FilterExif removes the tags that are not allowed
+func (p *MetadataPolicy) FilterExif(m exif.ExifMap) {
+	for name := range m {
+		if !p.KeepExif(name) {
+			delete(m, name)
+		}
+	}
+}
+
+// FilterIptc removes the tags that are not allowed
+func (p *MetadataPolicy) FilterIptc(m iptc.IptcMap) {
+	for key := range m {
+		if !p.KeepIptc(key) {
+			delete(m, key)
+		}
+	}
+}
+
+// FilterXMP removes the properties that are not allowed
+func (p *MetadataPolicy) FilterXMP(m XmpMap) {
+	for name := range m {
+		if !p.KeepXMP(name) {
+			delete(m, name)
+		}
+	}
+}
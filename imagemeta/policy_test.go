@@ -0,0 +1,105 @@
+package imagemeta
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/imagemeta/exif"
+	"github.com/imgproxy/imgproxy/v3/imagemeta/iptc"
+)
+
+type MetadataPolicyTestSuite struct {
+	suite.Suite
+}
+
+func (s *MetadataPolicyTestSuite) TestParseMetadataPolicy() {
+	p, err := ParseMetadataPolicy("exif:Make, exif:GPS*,iptc:Credit,xmp:dc:*")
+	s.Require().NoError(err)
+
+	s.Require().Equal(&MetadataPolicy{
+		Exif: []string{"Make", "GPS*"},
+		Iptc: []string{"Credit"},
+		XMP:  []string{"dc:*"},
+	}, p)
+}
+
+func (s *MetadataPolicyTestSuite) TestParseMetadataPolicyInvalid() {
+	for _, str := range []string{"Make", "exif:", "foo:Bar", "xmp:creator"} {
+		_, err := ParseMetadataPolicy(str)
+		s.Require().Error(err, str)
+	}
+}
+
+func (s *MetadataPolicyTestSuite) TestFilterExif() {
+	m := exif.ExifMap{
+		"Make":         "Canon",
+		"Model":        "EOS R5",
+		"Software":     "Lightroom",
+		"GPSLatitude":  []any{18.0, 31.0, 12.5},
+		"GPSLongitude": []any{73.0, 51.0, 2.0},
+	}
+
+	DefaultMetadataPolicy.FilterExif(m)
+	s.Require().NotContains(m, "GPSLatitude")
+	s.Require().NotContains(m, "GPSLongitude")
+	s.Require().Len(m, 3)
+
+	p, err := ParseMetadataPolicy("exif:M*,exif:GPSLatitude")
+	s.Require().NoError(err)
+
+	m["GPSLatitude"] = 18.5
+	m["GPSLongitude"] = 73.8
+	p.FilterExif(m)
+
+	s.Require().Equal(exif.ExifMap{"Make": "Canon", "Model": "EOS R5", "GPSLatitude": 18.5}, m)
+}
+
+func (s *MetadataPolicyTestSuite) TestFilterIptc() {
+	p, err := ParseMetadataPolicy("iptc:Credit")
+	s.Require().NoError(err)
+
+	m := iptc.IptcMap{
+		{RecordID: 1, TagID: 90}:  {{Format: iptc.TagFormatBinary, Raw: []byte("\x1b%G")}},
+		{RecordID: 2, TagID: 80}:  {{Format: iptc.TagFormatString, Raw: []byte("Jane")}},
+		{RecordID: 2, TagID: 110}: {{Format: iptc.TagFormatString, Raw: []byte("CarWale")}},
+	}
+	p.FilterIptc(m)
+
+	// Envelope tags are kept
+	s.Require().Contains(m, iptc.TagKey{RecordID: 1, TagID: 90})
+	s.Require().Contains(m, iptc.TagKey{RecordID: 2, TagID: 110})
+	s.Require().NotContains(m, iptc.TagKey{RecordID: 2, TagID: 80})
+}
+
+func (s *MetadataPolicyTestSuite) TestParseAndFilterXMP() {
+	data := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="18,31.2N" exif:ISOSpeed="100">
+<dc:creator><rdf:Seq><rdf:li>Jane</rdf:li><rdf:li>John</rdf:li></rdf:Seq></dc:creator>
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Car</rdf:li><rdf:li xml:lang="de">Auto</rdf:li></rdf:Alt></dc:title>
+</rdf:Description></rdf:RDF></x:xmpmeta>`)
+
+	m := make(XmpMap)
+	s.Require().NoError(ParseXMP(data, m))
+
+	s.Require().Equal(XmpMap{
+		"dc:creator":       []any{"Jane", "John"},
+		"dc:title":         map[string]string{"x-default": "Car", "de": "Auto"},
+		"exif:GPSLatitude": "18,31.2N",
+		"exif:ISOSpeed":    "100",
+	}, m)
+
+	p, err := ParseMetadataPolicy("xmp:dc:creator,xmp:exif:*")
+	s.Require().NoError(err)
+
+	p.FilterXMP(m)
+
+	s.Require().Equal(XmpMap{
+		"dc:creator":    []any{"Jane", "John"},
+		"exif:ISOSpeed": "100",
+	}, m)
+}
+
+func TestMetadataPolicy(t *testing.T) {
+	suite.Run(t, new(MetadataPolicyTestSuite))
+}
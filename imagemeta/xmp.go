@@ -0,0 +1,92 @@
+package imagemeta
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/trimmer-io/go-xmp/xmp"
+)
+
+// XmpMap holds the top-level XMP properties by their qualified names (e.g. `dc:creator`).
+// Values are strings, slices for arrays, language maps for alternatives,
+// and maps for structures
+type XmpMap map[string]any
+
+// ParseXMP parses the XMP packet and adds its properties to the map
+func ParseXMP(data []byte, m XmpMap) error {
+	doc, err := xmp.Read(bytes.NewReader(data))
+	if err != nil {
+		return newFormatError("XMP", err.Error())
+	}
+
+	for _, n := range doc.Nodes() {
+		addXmpProperties(n, m)
+	}
+
+	return nil
+}
+
+// isXmpSyntaxName checks if the name belongs to the RDF/XML syntax rather than to the data
+func isXmpSyntaxName(name string) bool {
+	prefix, _, _ := strings.Cut(name, ":")
+	return prefix == "rdf" || prefix == "xml" || prefix == "xmlns" || prefix == "x"
+}
+
+func xmpAttrName(a xmp.Attr) string {
+	if len(a.Name.Space) > 0 {
+		return a.Name.Space + ":" + a.Name.Local
+	}
+	return a.Name.Local
+}
+
+func addXmpProperties(n *xmp.Node, m map[string]any) {
+	for _, a := range n.Attr {
+		if name := xmpAttrName(a); !isXmpSyntaxName(name) {
+			m[name] = a.Value
+		}
+	}
+
+	for _, c := range n.Nodes {
+		name := c.FullName()
+
+		switch {
+		case name == "rdf:Description":
+			// Structures may be wrapped into rdf:Description
+			addXmpProperties(c, m)
+		case !isXmpSyntaxName(name):
+			m[name] = xmpNodeValue(c)
+		}
+	}
+}
+
+func xmpNodeValue(n *xmp.Node) any {
+	if len(n.Nodes) == 1 {
+		switch c := n.Nodes[0]; c.FullName() {
+		case "rdf:Seq", "rdf:Bag":
+			values := make([]any, 0, len(c.Nodes))
+			for _, li := range c.Nodes {
+				values = append(values, xmpNodeValue(li))
+			}
+			return values
+		case "rdf:Alt":
+			values := make(map[string]string, len(c.Nodes))
+			for _, li := range c.Nodes {
+				lang := "x-default"
+				if attr := li.GetAttr("", "lang"); len(attr) > 0 {
+					lang = attr[0].Value
+				}
+				values[lang] = li.Value
+			}
+			return values
+		}
+	}
+
+	values := make(map[string]any)
+	addXmpProperties(n, values)
+
+	if len(values) == 0 {
+		return n.Value
+	}
+
+	return values
+}
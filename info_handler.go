@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/errorreport"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
+	"github.com/imgproxy/imgproxy/v3/imagemeta/exif"
+	"github.com/imgproxy/imgproxy/v3/imagemeta/iptc"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/metrics"
+	"github.com/imgproxy/imgproxy/v3/metrics/stats"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+// infoPrefixSize is the size of the first ranged request of the image info.
+// It's enough for the headers and metadata of most images. If it's not,
+// the prefix grows by infoPrefixGrowth times until the metadata fits
+const (
+	infoPrefixSize   = 64 * 1024
+	infoPrefixGrowth = 4
+)
+
+type imageInfo struct {
+	Format imagetype.Type `json:"format"`
+	Width  int            `json:"width"`
+	Height int            `json:"height"`
+	// Size of the original in bytes
+	Size        int              `json:"size"`
+	Orientation int              `json:"orientation,omitempty"`
+	HasICC      bool             `json:"icc"`
+	Exif        exif.ExifMap     `json:"exif,omitempty"`
+	Iptc        iptc.IptcMap     `json:"iptc,omitempty"`
+	XMP         imagemeta.XmpMap `json:"xmp,omitempty"`
+
+	// Deep is set only if requested with `deep=1`
+	Deep *processing.ImageInfo `json:"deep,omitempty"`
+}
+
+// infoPrefixComplete checks if the image prefix contains the header and all the metadata blocks.
+// TIFF metadata may be anywhere in the file, so TIFF images are always downloaded completely
+func infoPrefixComplete(data []byte) bool {
+	meta, err := imagemeta.DecodeMeta(bytes.NewReader(data))
+	if err != nil || meta.Format() == imagetype.TIFF {
+		return false
+	}
+
+	var terr imagemeta.TruncatedError
+	_, err = imagemeta.DecodeMetadata(meta.Format(), data)
+
+	return !errors.As(err, &terr)
+}
+
+// downloadInfoData downloads the part of the original needed to read the image info.
+// It returns the data and the full size of the original
+func downloadInfoData(ctx context.Context, imageURL string, po *options.ProcessingOptions) (*imagedata.ImageData, int, error) {
+	uri := "s3://" + originalBucket + "/" + imageURL
+
+	for size := infoPrefixSize; ; size *= infoPrefixGrowth {
+		imgdata, total, err := imagedata.DownloadPrefix(ctx, uri, "source image", size, imagedata.DownloadOptions{}, po.SecurityOptions)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if len(imgdata.Data) >= total || infoPrefixComplete(imgdata.Data) {
+			return imgdata, total, nil
+		}
+
+		imgdata.Close()
+
+		if err = router.CheckTimeout(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// readImageInfo reads the image info from the headers and metadata blocks without decoding the image.
+// The data may be a prefix of the image of the given size. Broken metadata is skipped
+func readImageInfo(imgdata *imagedata.ImageData, size int) (*imageInfo, error) {
+	meta, err := imagemeta.DecodeMeta(bytes.NewReader(imgdata.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &imageInfo{
+		Format: meta.Format(),
+		Width:  meta.Width(),
+		Height: meta.Height(),
+		Size:   size,
+	}
+
+	md, err := imagemeta.DecodeMetadata(meta.Format(), imgdata.Data)
+	if err != nil {
+		log.Debugf("Can't read image metadata: %s", err)
+	}
+
+	info.HasICC = md.HasICC
+
+	parsed := parseImageMetadata(md)
+
+	info.Orientation = parsed.Exif.Orientation()
+
+	// GPS is exported only by the metadata endpoint with a policy that allows it
+	parsed.filter(imagemeta.DefaultMetadataPolicy)
+
+	info.Exif = parsed.Exif
+	info.Iptc = parsed.Iptc
+	info.XMP = parsed.XMP
+
+	return info, nil
+}
+
+// GET /info/{path}[?deep=1]
+func handleInfo(reqID string, rw http.ResponseWriter, r *http.Request) {
+	stats.IncRequestsInProgress()
+	defer stats.DecRequestsInProgress()
+
+	ctx := r.Context()
+
+	path := strings.TrimPrefix(r.URL.Path, config.PathPrefix+"/info/")
+
+	var deep bool
+	if d := r.URL.Query().Get("deep"); len(d) > 0 {
+		var err error
+		if deep, err = strconv.ParseBool(d); err != nil {
+			sendErrAndPanic(ctx, "path_parsing", newInvalidURLErrorf(http.StatusBadRequest, "Invalid deep: %s", d))
+		}
+	}
+
+	po, imageURL, err := options.ParsePathIPC("0x0/"+path, nil, r.Header)
+	checkErr(ctx, "path_parsing", err)
+
+	errorreport.SetMetadata(r, "Source Image URL", imageURL)
+	metrics.SetMetadata(ctx, "imgproxy.source_image_url", imageURL)
+
+	err = security.VerifySourceURL(imageURL)
+	checkErr(ctx, "security", err)
+
+	// Deep info needs the whole image, otherwise only the headers and metadata are downloaded
+	var size int
+
+	originData, err := func() (*imagedata.ImageData, error) {
+		defer metrics.StartDownloadingSegment(ctx)()
+
+		if deep {
+			imgdata, err := imagedata.Download(ctx, "s3://"+originalBucket+"/"+imageURL, "source image", imagedata.DownloadOptions{}, po.SecurityOptions)
+			if err == nil {
+				size = len(imgdata.Data)
+			}
+			return imgdata, err
+		}
+
+		imgdata, total, err := downloadInfoData(ctx, imageURL, po)
+		size = total
+		return imgdata, err
+	}()
+	checkErr(ctx, "download", err)
+	defer originData.Close()
+
+	info, err := readImageInfo(originData, size)
+	checkErr(ctx, "processing", err)
+
+	// Deep info loads the image with libvips, so it takes a processing slot
+	if deep {
+		func() {
+			defer metrics.StartQueueSegment(ctx)()
+
+			err = processingSem.Acquire(ctx, 1)
+			if err != nil {
+				checkErr(ctx, "queue", router.CheckTimeout(ctx))
+				sendErrAndPanic(ctx, "queue", err)
+			}
+		}()
+		defer processingSem.Release(1)
+
+		info.Deep, err = func() (*processing.ImageInfo, error) {
+			defer metrics.StartProcessingSegment(ctx)()
+			return processing.LoadImageInfo(originData)
+		}()
+		checkErr(ctx, "processing", err)
+
+		info.HasICC = info.HasICC || info.Deep.HasICC
+	}
+
+	setCacheControl(rw, po, http.StatusOK, originData.Headers)
+	setLastModified(rw, originData.Headers)
+	setCacheTags(rw, po, imageURL, originData.Headers)
+
+	writeJSON(rw, http.StatusOK, info)
+
+	router.LogResponse(reqID, r, http.StatusOK, nil)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+)
+
+func TestReadImageInfoFiltersXMP(t *testing.T) {
+	xmpData := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="18,31.2N" exif:GPSLongitude="73,51.0E" exif:ISOSpeed="100"/>
+</rdf:RDF></x:xmpmeta>`
+
+	jpeg := new(bytes.Buffer)
+	jpeg.Write([]byte{0xff, 0xd8})
+
+	writeSegment := func(marker byte, data []byte) {
+		jpeg.Write([]byte{0xff, marker})
+		require.NoError(t, binary.Write(jpeg, binary.BigEndian, uint16(2+len(data))))
+		jpeg.Write(data)
+	}
+
+	writeSegment(0xe1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), xmpData...))
+	// SOF0: 8 bits, 2x3, one component
+	writeSegment(0xc0, []byte{8, 0, 3, 0, 2, 1, 1, 0x11, 0})
+	jpeg.Write([]byte{0xff, 0xd9})
+
+	imgdata := &imagedata.ImageData{Type: imagetype.JPEG, Data: jpeg.Bytes()}
+
+	info, err := readImageInfo(imgdata, jpeg.Len())
+	require.NoError(t, err)
+
+	require.Equal(t, imagetype.JPEG, info.Format)
+	require.Equal(t, 2, info.Width)
+	require.Equal(t, 3, info.Height)
+	require.Equal(t, "100", info.XMP["exif:ISOSpeed"])
+	require.NotContains(t, info.XMP, "exif:GPSLatitude")
+	require.NotContains(t, info.XMP, "exif:GPSLongitude")
+}
@@ -0,0 +1,149 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type item[V any] struct {
+	key     string
+	value   V
+	cost    int64
+	expires time.Time
+}
+
+// Cache is a cost-bounded LRU cache safe for concurrent use.
+// Every entry has a cost (usually its size in bytes); when the total cost
+// exceeds the limit, the least recently used entries are evicted.
+type Cache[V any] struct {
+	mu sync.Mutex
+
+	maxCost int64
+	cost    int64
+
+	ll    *list.List
+	items map[string]*list.Element
+
+	onEvict func(key string, value V)
+}
+
+func New[V any](maxCost int64, onEvict func(key string, value V)) *Cache[V] {
+	return &Cache[V]{
+		maxCost: maxCost,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		onEvict: onEvict,
+	}
+}
+
+// Get returns the value stored under the key and marks it as recently used.
+// Expired entries are removed and reported as missing.
+func (c *Cache[V]) Get(key string) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return value, false
+	}
+
+	it := el.Value.(*item[V])
+
+	if !it.expires.IsZero() && time.Now().After(it.expires) {
+		c.remove(el)
+		return value, false
+	}
+
+	c.ll.MoveToFront(el)
+
+	return it.value, true
+}
+
+// Set stores the value under the key. Zero ttl means the entry never expires.
+// Entries that cost more than the whole cache are not stored.
+// The eviction callback is called after the cache is unlocked, so it may do
+// slow work without blocking other callers.
+func (c *Cache[V]) Set(key string, value V, cost int64, ttl time.Duration) {
+	if cost > c.maxCost {
+		return
+	}
+
+	evicted := c.set(key, value, cost, ttl)
+
+	if c.onEvict != nil {
+		for _, it := range evicted {
+			c.onEvict(it.key, it.value)
+		}
+	}
+}
+
+func (c *Cache[V]) set(key string, value V, cost int64, ttl time.Duration) []*item[V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+
+	it := &item[V]{key: key, value: value, cost: cost}
+	if ttl > 0 {
+		it.expires = time.Now().Add(ttl)
+	}
+
+	c.items[key] = c.ll.PushFront(it)
+	c.cost += cost
+
+	var evicted []*item[V]
+
+	for c.cost > c.maxCost {
+		el := c.ll.Back()
+		if el == nil {
+			break
+		}
+
+		c.remove(el)
+		evicted = append(evicted, el.Value.(*item[V]))
+	}
+
+	return evicted
+}
+
+// Delete removes the entry from the cache if it's present.
+func (c *Cache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// MaxCost returns the cost limit of the cache.
+func (c *Cache[V]) MaxCost() int64 {
+	return c.maxCost
+}
+
+// Cost returns the total cost of the stored entries.
+func (c *Cache[V]) Cost() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cost
+}
+
+// Len returns the number of the stored entries.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+func (c *Cache[V]) remove(el *list.Element) {
+	it := el.Value.(*item[V])
+
+	c.ll.Remove(el)
+	delete(c.items, it.key)
+	c.cost -= it.cost
+}
@@ -0,0 +1,80 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	var evicted []string
+
+	c := New[int](10, func(key string, _ int) {
+		evicted = append(evicted, key)
+	})
+
+	c.Set("a", 1, 4, 0)
+	c.Set("b", 2, 4, 0)
+
+	// Touch "a" so "b" becomes the least recently used entry
+	_, ok := c.Get("a")
+	require.True(t, ok)
+
+	c.Set("c", 3, 4, 0)
+
+	require.Equal(t, []string{"b"}, evicted)
+	require.Equal(t, int64(8), c.Cost())
+	require.Equal(t, 2, c.Len())
+
+	_, ok = c.Get("b")
+	require.False(t, ok)
+}
+
+func TestCacheReplacesExistingKey(t *testing.T) {
+	c := New[int](10, nil)
+
+	c.Set("a", 1, 4, 0)
+	c.Set("a", 2, 6, 0)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	require.Equal(t, int64(6), c.Cost())
+}
+
+func TestCacheSkipsTooLargeEntries(t *testing.T) {
+	c := New[int](10, nil)
+
+	c.Set("a", 1, 11, 0)
+
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, int64(0), c.Cost())
+}
+
+func TestCacheExpiresEntries(t *testing.T) {
+	c := New[int](10, nil)
+
+	c.Set("a", 1, 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, 0, c.Len())
+}
+
+func TestCacheEvictsOutsideOfLock(t *testing.T) {
+	var c *Cache[int]
+
+	c = New[int](4, func(string, int) {
+		// Would deadlock if the callback was called under the lock
+		require.Equal(t, 1, c.Len())
+	})
+
+	c.Set("a", 1, 4, 0)
+	c.Set("b", 2, 4, 0)
+
+	_, ok := c.Get("b")
+	require.True(t, ok)
+}
@@ -14,15 +14,19 @@ import (
 
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/config/loadenv"
+	"github.com/imgproxy/imgproxy/v3/derivatives"
+	"github.com/imgproxy/imgproxy/v3/diskcache"
 	"github.com/imgproxy/imgproxy/v3/errorreport"
 	"github.com/imgproxy/imgproxy/v3/gliblog"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/logger"
 	"github.com/imgproxy/imgproxy/v3/memory"
 	"github.com/imgproxy/imgproxy/v3/metrics"
 	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
 	"github.com/imgproxy/imgproxy/v3/options"
 	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/resultcache"
 	"github.com/imgproxy/imgproxy/v3/version"
 	"github.com/imgproxy/imgproxy/v3/vips"
 )
@@ -52,6 +56,18 @@ func initialize() error {
 		return err
 	}
 
+	resultcache.Init()
+
+	derivatives.Init()
+
+	if err := diskcache.Init(); err != nil {
+		return err
+	}
+
+	if err := imagemeta.ParseMetadataPolicies(config.MetadataPolicies); err != nil {
+		return err
+	}
+
 	initProcessingHandler()
 
 	errorreport.Init()
@@ -75,6 +91,11 @@ func initialize() error {
 		return err
 	}
 
+	if err := initWarmup(); err != nil {
+		vips.Shutdown()
+		return err
+	}
+
 	return nil
 }
 
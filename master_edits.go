@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+)
+
+// Edits are a short list of options, anything bigger is not an edits file
+const maxMasterEditsSize = 4096
+
+// downloadMasterEdits downloads the sidecar edits stored next to the original.
+// A missing sidecar means there are no edits
+func downloadMasterEdits(ctx context.Context, imageURL string) (string, error) {
+	if len(config.MasterEditsSuffix) == 0 {
+		return "", nil
+	}
+
+	uri := "s3://" + originalBucket + "/" + imageURL + config.MasterEditsSuffix
+
+	req, cancel, err := imagedata.BuildImageRequest(ctx, uri, nil, nil)
+	defer cancel()
+	if err != nil {
+		return "", err
+	}
+
+	res, err := imagedata.SendRequest(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("Can't download edits of %s: status %d", imageURL, res.StatusCode)
+	}
+
+	edits, err := io.ReadAll(io.LimitReader(res.Body, maxMasterEditsSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(edits) > maxMasterEditsSize {
+		return "", fmt.Errorf("Edits of %s are too big", imageURL)
+	}
+
+	return strings.TrimSpace(string(edits)), nil
+}
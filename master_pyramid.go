@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/diskcache"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
+	"github.com/imgproxy/imgproxy/v3/lru"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/processing"
+)
+
+const (
+	// Max number of remembered missing pyramid levels
+	maxMissingMasterLevels = 65536
+	// Masters created before the levels were enabled don't have them until
+	// they are refreshed, and small masters don't have large levels.
+	// Remember missing levels for a while to avoid useless requests
+	missingMasterLevelsTTL = 10 * time.Minute
+)
+
+var missingMasterLevels = lru.New[struct{}](maxMissingMasterLevels, nil)
+
+// masterObjectURI returns the location of the master pyramid level.
+// Level 0 is the full master
+func masterObjectURI(imageURL string, level int) string {
+	if level == 0 {
+		return "s3://" + masterBucket + "/" + imageURL
+	}
+
+	return fmt.Sprintf(
+		"s3://%s/%s/%d/%s",
+		masterBucket, strings.Trim(config.MasterPyramidPrefix, "/"), level, imageURL,
+	)
+}
+
+// requiredMasterSize returns the master size needed to render the result without upscaling.
+// Zero means that the dimension is not constrained
+func requiredMasterSize(po *options.ProcessingOptions) (int, int) {
+	w := float64(po.Width) * po.Dpr * po.ZoomWidth
+	h := float64(po.Height) * po.Dpr * po.ZoomHeight
+
+	// Relative crops are scaled to the result size, so the master should be
+	// larger by the crop ratio
+	if po.Crop.Width > 0 && po.Crop.Width < 1 {
+		w /= po.Crop.Width
+	}
+	if po.Crop.Height > 0 && po.Crop.Height < 1 {
+		h /= po.Crop.Height
+	}
+
+	return int(math.Ceil(w)), int(math.Ceil(h))
+}
+
+// absoluteCrop checks if the crop size is set in pixels. Such crops are
+// relative to the full master, so pyramid levels can't be used
+func absoluteCrop(po *options.ProcessingOptions) bool {
+	return po.Crop.Width >= 1 || po.Crop.Height >= 1
+}
+
+// pyramidLevelFor returns the smallest level with the long edge not less than size.
+// It returns 0 (the full master) if there is no such level
+func pyramidLevelFor(size int) int {
+	if size <= 0 {
+		return 0
+	}
+
+	for _, l := range config.MasterPyramidLevels {
+		if l >= size {
+			return l
+		}
+	}
+
+	return 0
+}
+
+// masterPyramidLevel returns the pyramid level to try first. We don't know the
+// master aspect ratio yet, so the level is chosen by the long edge of the result
+func masterPyramidLevel(po *options.ProcessingOptions) int {
+	if absoluteCrop(po) {
+		return 0
+	}
+
+	w, h := requiredMasterSize(po)
+	return pyramidLevelFor(max(w, h))
+}
+
+// nextMasterLevel checks if the level is enough to render the result.
+// If it's not, it returns the next level to try
+func nextMasterLevel(po *options.ProcessingOptions, level int, data *imagedata.ImageData) (int, bool) {
+	meta, err := imagemeta.DecodeMeta(bytes.NewReader(data.Data))
+	if err != nil || meta.Width() == 0 || meta.Height() == 0 {
+		return 0, false
+	}
+
+	w, h := requiredMasterSize(po)
+
+	wscale := float64(w) / float64(meta.Width())
+	hscale := float64(h) / float64(meta.Height())
+
+	var scale float64
+
+	switch {
+	case w == 0:
+		scale = hscale
+	case h == 0:
+		scale = wscale
+	case po.ResizingType == options.ResizeFit:
+		scale = math.Min(wscale, hscale)
+	default:
+		scale = math.Max(wscale, hscale)
+	}
+
+	if scale <= 1 {
+		return level, true
+	}
+
+	return pyramidLevelFor(max(int(math.Ceil(float64(level)*scale)), level+1)), false
+}
+
+func downloadMasterLevel(ctx context.Context, uri string, opts imagedata.DownloadOptions, po *options.ProcessingOptions) (*imagedata.ImageData, error) {
+	if cached, ok := diskcache.Get(masterCacheKey(uri), "cached source image", po.SecurityOptions); ok {
+		return cached, nil
+	}
+
+	imgdata, err := imagedata.Download(ctx, uri, "source image", opts, po.SecurityOptions)
+	if err == nil {
+		diskcache.Set(masterCacheKey(uri), imgdata)
+	}
+
+	return imgdata, err
+}
+
+// downloadMaster downloads the smallest master pyramid level that is enough
+// to render the result. If levels are missing, the full master is downloaded
+func downloadMaster(ctx context.Context, imageURL string, opts imagedata.DownloadOptions, po *options.ProcessingOptions) (*imagedata.ImageData, error) {
+	level := masterPyramidLevel(po)
+
+	for level > 0 {
+		levelURI := masterObjectURI(imageURL, level)
+
+		if _, missing := missingMasterLevels.Get(levelURI); missing {
+			break
+		}
+
+		imgdata, err := downloadMasterLevel(ctx, levelURI, opts, po)
+
+		var nmErr imagedata.NotModifiedError
+		if errors.As(err, &nmErr) {
+			return nil, err
+		}
+
+		if err != nil {
+			log.Debugf("Master level %d of %s is not available: %s", level, imageURL, err)
+
+			if ierr, ok := err.(*ierrors.Error); ok && ierr.StatusCode() == http.StatusNotFound {
+				missingMasterLevels.Set(levelURI, struct{}{}, 1, missingMasterLevelsTTL)
+			}
+
+			break
+		}
+
+		next, ok := nextMasterLevel(po, level, imgdata)
+		if ok {
+			return imgdata, nil
+		}
+
+		imgdata.Close()
+		level = next
+	}
+
+	return downloadMasterLevel(ctx, masterObjectURI(imageURL, 0), opts, po)
+}
+
+// downloadMasterOrOriginal downloads the master of the image. Images that are used
+// only as parts of spins or collages often don't have masters, so the original
+// is used in this case
+func downloadMasterOrOriginal(ctx context.Context, imageURL string, po *options.ProcessingOptions) (*imagedata.ImageData, error) {
+	if imgdata, err := downloadMaster(ctx, imageURL, imagedata.DownloadOptions{}, po); err == nil {
+		return imgdata, nil
+	}
+
+	return imagedata.Download(ctx, "s3://"+originalBucket+"/"+imageURL, "source image", imagedata.DownloadOptions{}, po.SecurityOptions)
+}
+
+// createMasterLevels renders the master pyramid levels with the same edits as the master.
+// The largest level is rendered from the original image, and every next level is
+// rendered from the previous one, so the original is decoded only once.
+// Levels that are not smaller than the master are skipped
+func createMasterLevels(ctx context.Context, imageURL string, originData, masterData *imagedata.ImageData, edits string) (map[int]*imagedata.ImageData, error) {
+	if len(config.MasterPyramidLevels) == 0 {
+		return nil, nil
+	}
+
+	meta, err := imagemeta.DecodeMeta(bytes.NewReader(masterData.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make([]int, 0, len(config.MasterPyramidLevels))
+	for _, l := range config.MasterPyramidLevels {
+		if l >= max(meta.Width(), meta.Height()) {
+			break
+		}
+		sizes = append(sizes, l)
+	}
+
+	levels := make(map[int]*imagedata.ImageData, len(sizes))
+
+	srcData := originData
+
+	for i := len(sizes) - 1; i >= 0; i-- {
+		l := sizes[i]
+
+		po, _, err := options.ParsePathIPC(
+			fmt.Sprintf("%dx%d/%s", l, l, imageURL),
+			url.Values{"fit": {"1"}},
+			masterRequestHeader(),
+		)
+		if err != nil {
+			closeMasterLevels(levels)
+			return nil, err
+		}
+
+		applyMasterOptions(po)
+
+		if srcData == originData {
+			err = po.ApplyEdits(edits)
+		} else {
+			// The larger level is already edited and sharpened
+			po.Sharpen = 0
+		}
+
+		if err != nil {
+			closeMasterLevels(levels)
+			return nil, err
+		}
+
+		leveldata, err := processing.ProcessImage(ctx, srcData, po)
+		if err != nil {
+			closeMasterLevels(levels)
+			return nil, err
+		}
+
+		levels[l] = leveldata
+		srcData = leveldata
+	}
+
+	return levels, nil
+}
+
+func closeMasterLevels(levels map[int]*imagedata.ImageData) {
+	for _, l := range levels {
+		l.Close()
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/imgproxy/imgproxy/v3/cachetags"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/options"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -27,6 +29,12 @@ func writeJSON(w http.ResponseWriter, code int, v any) {
 	}
 }
 
+// purgeImage invalidates every derivative of the image at the CDN.
+// It should be called whenever the master is replaced or removed
+func purgeImage(ctx context.Context, imageURL string) error {
+	return cachetags.Purge(ctx, cachetags.ObjectTag(imageURL))
+}
+
 // POST /master/refresh with payload {"path":"<original-object-key-or-imgproxy-path>"}
 func handleRefreshMaster(reqID string, rw http.ResponseWriter, r *http.Request) {
 
@@ -86,6 +94,16 @@ func handleRefreshMaster(reqID string, rw http.ResponseWriter, r *http.Request)
 
 	resultData.Close()
 
+	if _, imageURL, err := options.ParsePathIPC(normalized, nil, http.Header{}); err == nil {
+		if err = purgeImage(cctx, imageURL); err != nil {
+			// The master is updated, but the CDN still serves stale derivatives.
+			// Report the failure so the caller retries the refresh
+			log.WithError(err).Error("master refresh purge failed")
+			writeJSON(rw, http.StatusBadGateway, false)
+			return
+		}
+	}
+
 	writeJSON(rw, http.StatusOK, true)
 
 }
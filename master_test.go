@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/diskcache"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+type MasterTestSuite struct {
+	suite.Suite
+
+	server  *httptest.Server
+	backend *s3mem.Backend
+	router  *router.Router
+
+	originalBucket string
+	masterBucket   string
+}
+
+func (s *MasterTestSuite) SetupSuite() {
+	s.backend = s3mem.New()
+	s.server = httptest.NewServer(gofakes3.New(s.backend).Server())
+
+	s.Require().NoError(s.backend.CreateBucket("originals"))
+	s.Require().NoError(s.backend.CreateBucket("masters"))
+
+	s.originalBucket, s.masterBucket = originalBucket, masterBucket
+	originalBucket, masterBucket = "originals", "masters"
+
+	s.T().Setenv("IMGPROXY_S3_ENABLED", "true")
+	s.T().Setenv("IMGPROXY_S3_ENDPOINT", s.server.URL)
+	s.T().Setenv("IMGPROXY_DISK_CACHE_DIR", s.T().TempDir())
+	s.T().Setenv("IMGPROXY_MASTER_FORMAT", "png")
+	s.T().Setenv("AWS_REGION", "eu-central-1")
+	s.T().Setenv("AWS_ACCESS_KEY_ID", "Foo")
+	s.T().Setenv("AWS_SECRET_ACCESS_KEY", "Bar")
+
+	s.Require().NoError(initialize())
+
+	logrus.SetOutput(io.Discard)
+
+	s.router = buildRouter()
+}
+
+func (s *MasterTestSuite) TearDownSuite() {
+	s.server.Close()
+	originalBucket, masterBucket = s.originalBucket, s.masterBucket
+	logrus.SetOutput(os.Stdout)
+}
+
+func (s *MasterTestSuite) send(method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rw := httptest.NewRecorder()
+
+	s.router.ServeHTTP(rw, req)
+
+	return rw
+}
+
+func (s *MasterTestSuite) putOriginal(name string, c color.Color) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	s.Require().NoError(png.Encode(&buf, img))
+
+	_, err := s.backend.PutObject("originals", name, map[string]string{"Content-Type": "image/png"}, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	s.Require().NoError(err)
+}
+
+func (s *MasterTestSuite) masterColor(name string) color.RGBA {
+	obj, err := s.backend.GetObject("masters", name, nil)
+	s.Require().NoError(err)
+	defer obj.Contents.Close()
+
+	img, err := png.Decode(obj.Contents)
+	s.Require().NoError(err)
+
+	r, g, b, a := img.At(0, 0).RGBA()
+
+	return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+}
+
+func (s *MasterTestSuite) TestRefreshIgnoresCachedMaster() {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	s.putOriginal("refresh.png", red)
+
+	// The first request creates the master, the second one puts it to the disk cache
+	s.Require().Equal(http.StatusOK, s.send(http.MethodGet, "/4x4/refresh.png", "").Code)
+	s.Require().Equal(http.StatusOK, s.send(http.MethodGet, "/4x4/refresh.png", "").Code)
+
+	cached, ok := diskcache.Get(masterCacheKey(masterObjectURI("refresh.png", 0)), "cached source image", security.DefaultOptions())
+	s.Require().True(ok)
+	cached.Close()
+
+	s.Require().Equal(red, s.masterColor("refresh.png"))
+
+	s.putOriginal("refresh.png", blue)
+
+	res := s.send(http.MethodPost, "/master/refresh", `{"path":"refresh.png"}`)
+	s.Require().Equal(http.StatusOK, res.Code)
+
+	s.Require().Equal(blue, s.masterColor("refresh.png"))
+}
+
+func (s *MasterTestSuite) TestCreatedMasterLastModified() {
+	s.putOriginal("created.png", color.RGBA{0, 255, 0, 255})
+
+	start := time.Now().Truncate(time.Second)
+
+	res := s.send(http.MethodGet, "/4x4/created.png", "")
+	s.Require().Equal(http.StatusOK, res.Code)
+
+	lastModified, err := time.Parse(http.TimeFormat, res.Header().Get("Last-Modified"))
+	s.Require().NoError(err)
+	s.Require().False(lastModified.Before(start))
+}
+
+func (s *MasterTestSuite) TestPlaceholderIgnoresOtherOptions() {
+	s.putOriginal("placeholder.png", color.RGBA{0, 0, 0, 255})
+
+	// The width is not a placeholder option, so it must neither change the render
+	// nor the cached placeholder
+	res := s.send(http.MethodGet, "/placeholder/placeholder.png?w=4", "")
+	s.Require().Equal(http.StatusOK, res.Code)
+	s.Require().Contains(res.Body.String(), `"width":8`)
+
+	res = s.send(http.MethodGet, "/placeholder/placeholder.png", "")
+	s.Require().Equal(http.StatusOK, res.Code)
+	s.Require().Contains(res.Body.String(), `"width":8`)
+}
+
+func TestMaster(t *testing.T) {
+	suite.Run(t, new(MasterTestSuite))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/errorreport"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
+	"github.com/imgproxy/imgproxy/v3/imagemeta/exif"
+	"github.com/imgproxy/imgproxy/v3/imagemeta/iptc"
+	"github.com/imgproxy/imgproxy/v3/imagemeta/photoshop"
+	"github.com/imgproxy/imgproxy/v3/metrics"
+	"github.com/imgproxy/imgproxy/v3/metrics/stats"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+type imageMetadata struct {
+	Exif exif.ExifMap     `json:"exif,omitempty"`
+	Iptc iptc.IptcMap     `json:"iptc,omitempty"`
+	XMP  imagemeta.XmpMap `json:"xmp,omitempty"`
+}
+
+// parseImageMetadata parses the metadata blocks. Broken blocks are skipped
+func parseImageMetadata(md imagemeta.Metadata) imageMetadata {
+	var parsed imageMetadata
+
+	if len(md.Exif) > 0 {
+		exifMap := make(exif.ExifMap)
+		if err := exif.Parse(md.Exif, exifMap); err == nil {
+			parsed.Exif = exifMap
+		} else {
+			log.Debugf("Can't parse EXIF: %s", err)
+		}
+	}
+
+	if len(md.Photoshop) > 0 {
+		ps3Map := make(photoshop.PhotoshopMap)
+		photoshop.Parse(md.Photoshop, ps3Map)
+
+		if iptcData, ok := ps3Map[photoshop.IptcKey]; ok {
+			iptcMap := make(iptc.IptcMap)
+			if err := iptc.Parse(iptcData, iptcMap); err == nil && len(iptcMap) > 0 {
+				parsed.Iptc = iptcMap
+			}
+		}
+	}
+
+	if len(md.XMP) > 0 {
+		xmpMap := make(imagemeta.XmpMap)
+		if err := imagemeta.ParseXMP(md.XMP, xmpMap); err == nil {
+			parsed.XMP = xmpMap
+		} else {
+			log.Debugf("Can't parse XMP: %s", err)
+		}
+	}
+
+	return parsed
+}
+
+// filter removes the fields that are not allowed by the policy
+func (m imageMetadata) filter(policy *imagemeta.MetadataPolicy) {
+	policy.FilterExif(m.Exif)
+	policy.FilterIptc(m.Iptc)
+	policy.FilterXMP(m.XMP)
+}
+
+// GET /metadata/{path}[?policy=name]
+func handleMetadata(reqID string, rw http.ResponseWriter, r *http.Request) {
+	stats.IncRequestsInProgress()
+	defer stats.DecRequestsInProgress()
+
+	ctx := r.Context()
+
+	path := strings.TrimPrefix(r.URL.Path, config.PathPrefix+"/metadata/")
+
+	// GPS is never exported unless the policy allows it
+	policy := imagemeta.DefaultMetadataPolicy
+	if name := r.URL.Query().Get("policy"); len(name) > 0 {
+		var ok bool
+		if policy, ok = imagemeta.GetMetadataPolicy(name); !ok {
+			sendErrAndPanic(ctx, "path_parsing", newInvalidURLErrorf(http.StatusBadRequest, "Unknown metadata policy: %s", name))
+		}
+	}
+
+	po, imageURL, err := options.ParsePathIPC("0x0/"+path, nil, r.Header)
+	checkErr(ctx, "path_parsing", err)
+
+	errorreport.SetMetadata(r, "Source Image URL", imageURL)
+	metrics.SetMetadata(ctx, "imgproxy.source_image_url", imageURL)
+
+	err = security.VerifySourceURL(imageURL)
+	checkErr(ctx, "security", err)
+
+	originData, err := func() (*imagedata.ImageData, error) {
+		defer metrics.StartDownloadingSegment(ctx)()
+		return imagedata.Download(ctx, "s3://"+originalBucket+"/"+imageURL, "source image", imagedata.DownloadOptions{}, po.SecurityOptions)
+	}()
+	checkErr(ctx, "download", err)
+	defer originData.Close()
+
+	md, err := imagemeta.DecodeMetadata(originData.Type, originData.Data)
+	checkErr(ctx, "processing", err)
+
+	parsed := parseImageMetadata(md)
+	parsed.filter(policy)
+
+	setCacheControl(rw, po, http.StatusOK, originData.Headers)
+	setLastModified(rw, originData.Headers)
+	setCacheTags(rw, po, imageURL, originData.Headers)
+
+	writeJSON(rw, http.StatusOK, parsed)
+
+	router.LogResponse(reqID, r, http.StatusOK, nil)
+}
@@ -35,6 +35,10 @@ var (
 
 	requestsInProgress prometheus.GaugeFunc
 	imagesInProgress   prometheus.GaugeFunc
+
+	cacheHitsTotal      *prometheus.CounterVec
+	cacheMissesTotal    *prometheus.CounterVec
+	cacheEvictionsTotal *prometheus.CounterVec
 )
 
 func Init() {
@@ -115,6 +119,24 @@ func Init() {
 		Help:      "A gauge of the number of images currently being in progress.",
 	}, stats.ImagesInProgress)
 
+	cacheHitsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "cache_hits_total",
+		Help:      "A counter of the cache hits separated by cache.",
+	}, []string{"cache"})
+
+	cacheMissesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "cache_misses_total",
+		Help:      "A counter of the cache misses separated by cache.",
+	}, []string{"cache"})
+
+	cacheEvictionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "cache_evictions_total",
+		Help:      "A counter of the cache evictions separated by cache.",
+	}, []string{"cache"})
+
 	prometheus.MustRegister(
 		requestsTotal,
 		statusCodesTotal,
@@ -128,6 +150,9 @@ func Init() {
 		bufferMaxSize,
 		requestsInProgress,
 		imagesInProgress,
+		cacheHitsTotal,
+		cacheMissesTotal,
+		cacheEvictionsTotal,
 	)
 
 	enabled = true
@@ -254,6 +279,24 @@ func SetBufferMaxSize(t string, size int) {
 	}
 }
 
+func IncrementCacheHits(cache string) {
+	if enabled {
+		cacheHitsTotal.With(prometheus.Labels{"cache": cache}).Inc()
+	}
+}
+
+func IncrementCacheMisses(cache string) {
+	if enabled {
+		cacheMissesTotal.With(prometheus.Labels{"cache": cache}).Inc()
+	}
+}
+
+func IncrementCacheEvictions(cache string) {
+	if enabled {
+		cacheEvictionsTotal.With(prometheus.Labels{"cache": cache}).Inc()
+	}
+}
+
 func AddGaugeFunc(name, help string, f func() float64) {
 	if !enabled {
 		return
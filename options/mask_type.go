@@ -0,0 +1,39 @@
+package options
+
+import "fmt"
+
+type MaskType int
+
+const (
+	MaskNone MaskType = iota
+	MaskRound
+	MaskCircle
+	MaskEllipse
+	MaskImage
+)
+
+var maskTypes = map[string]MaskType{
+	"none":    MaskNone,
+	"round":   MaskRound,
+	"circle":  MaskCircle,
+	"ellipse": MaskEllipse,
+	"image":   MaskImage,
+}
+
+func (mt MaskType) String() string {
+	for k, v := range maskTypes {
+		if v == mt {
+			return k
+		}
+	}
+	return ""
+}
+
+func (mt MaskType) MarshalJSON() ([]byte, error) {
+	for k, v := range maskTypes {
+		if v == mt {
+			return []byte(fmt.Sprintf("%q", k)), nil
+		}
+	}
+	return []byte("null"), nil
+}
@@ -3,6 +3,7 @@ package options
 import (
 	"encoding/base64"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"slices"
@@ -15,6 +16,7 @@ import (
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
 	"github.com/imgproxy/imgproxy/v3/imath"
 	"github.com/imgproxy/imgproxy/v3/security"
@@ -27,6 +29,10 @@ const maxClientHintDPR = 8
 type ExtendOptions struct {
 	Enabled bool
 	Gravity GravityOptions
+	// Blur fills the extended area with a blurred and darkened copy of the image
+	Blur           bool
+	BlurSigma      float32
+	BlurBrightness float64
 }
 
 type CropOptions struct {
@@ -68,6 +74,115 @@ type ArtifactOptions struct {
 	Scale    float64
 }
 
+type CacheControlOptions struct {
+	TTL                  int
+	SMaxAge              int
+	StaleWhileRevalidate int
+	StaleIfError         int
+	Immutable            bool
+}
+
+// TargetQualityOptions enable searching for the lowest quality
+// that keeps the result SSIM not less than the target one
+type TargetQualityOptions struct {
+	SSIM       float64
+	MinQuality int
+	MaxQuality int
+}
+
+func (tq TargetQualityOptions) Enabled() bool {
+	return tq.SSIM > 0
+}
+
+// Frame index that means the most representative frame
+const BestFrame = -2
+
+type AnimationOptions struct {
+	// Frame to be extracted as a static poster, -1 keeps the animation
+	Frame int
+	// Only every Stride-th frame is kept
+	Stride int
+	// Speed multiplier of the animation
+	Speed float64
+	// Loop count override, -1 keeps the original one
+	Loop int
+	// Max total duration of the animation in milliseconds, 0 means unlimited
+	MaxDuration int
+}
+
+func (ao AnimationOptions) Poster() bool {
+	return ao.Frame != -1
+}
+
+type DuotoneOptions struct {
+	Enabled   bool
+	Shadow    vips.Color
+	Highlight vips.Color
+	// Intensity sets how much of the duotone is mixed with the image
+	Intensity float64
+}
+
+// Sepia is a duotone preset
+var sepiaDuotone = DuotoneOptions{
+	Enabled:   true,
+	Shadow:    vips.Color{R: 43, G: 26, B: 10},
+	Highlight: vips.Color{R: 245, G: 230, B: 200},
+	Intensity: 1,
+}
+
+type ColorAdjustOptions struct {
+	// Brightness is added to the channels, -255..255
+	Brightness int
+	// Contrast, Saturation, and Gamma are multipliers, 1 keeps the image as is
+	Contrast   float64
+	Saturation float64
+	Gamma      float64
+	Grayscale  bool
+	AutoLevel  bool
+	Duotone    DuotoneOptions
+}
+
+func (ca ColorAdjustOptions) Enabled() bool {
+	return ca.Brightness != 0 || ca.Contrast != 1 || ca.Saturation != 1 || ca.Gamma != 1 ||
+		ca.Grayscale || ca.AutoLevel || ca.Duotone.Enabled
+}
+
+type MaskOptions struct {
+	Type MaskType
+	// Radius of the round corners. Values less than 1 are relative to the shorter side
+	Radius float64
+	// Image is the name of the mask in the masks registry
+	Image string
+}
+
+func (mo MaskOptions) Enabled() bool {
+	return mo.Type != MaskNone
+}
+
+type RotateAngleOptions struct {
+	// Angle in degrees clockwise
+	Angle float64
+	// AutoCrop crops the largest rectangle without corners that has the aspect ratio of the image
+	AutoCrop bool
+	// Fill fills the corners with Background, otherwise they are transparent
+	Fill       bool
+	Background vips.Color
+}
+
+func (ro RotateAngleOptions) Enabled() bool {
+	return math.Mod(ro.Angle, 360) != 0
+}
+
+// Transparent checks if the rotation makes transparent corners
+func (ro RotateAngleOptions) Transparent() bool {
+	return ro.Enabled() && !ro.AutoCrop && !ro.Fill
+}
+
+type DerivativeStoreOptions struct {
+	Enabled bool
+	TTL     int
+}
+
 func (wo WatermarkOptions) ShouldReplicate() bool {
 	return wo.Position.Type == GravityReplicate
 }
@@ -89,17 +204,27 @@ type ProcessingOptions struct {
 	Padding           PaddingOptions
 	Trim              TrimOptions
 	Rotate            int
+	RotateAngle       RotateAngleOptions
 	Format            imagetype.Type
 	Quality           int
 	FormatQuality     map[imagetype.Type]int
 	MaxBytes          int
+	MaxBytesStrict    bool
+	TargetQuality     TargetQualityOptions
+	SaveOptions       vips.SaveOptions
 	Flatten           bool
 	Background        vips.Color
-	Blur              float32
-	Sharpen           float32
-	Pixelate          int
-	StripMetadata     bool
-	KeepCopyright     bool
+	// BackgroundAuto replaces the background with the dominant colour of the image
+	BackgroundAuto bool
+	Blur           float32
+	Sharpen        float32
+	Pixelate       int
+	ColorAdjust    ColorAdjustOptions
+	Mask           MaskOptions
+	StripMetadata  bool
+	KeepCopyright  bool
+	// MetadataPolicy is the name of the metadata allowlist. It overrides KeepCopyright
+	MetadataPolicy    string
 	StripColorProfile bool
 	AutoRotate        bool
 	EnforceThumbnail  bool
@@ -110,6 +235,10 @@ type ProcessingOptions struct {
 
 	Expires *time.Time
 
+	CacheControl CacheControlOptions
+
+	Animation AnimationOptions
+
 	Watermark WatermarkOptions
 
 	Artifact ArtifactOptions
@@ -126,6 +255,8 @@ type ProcessingOptions struct {
 
 	Raw bool
 
+	DerivativeStore DerivativeStoreOptions
+
 	UsedPresets []string
 
 	SecurityOptions security.Options
@@ -135,14 +266,19 @@ type ProcessingOptions struct {
 
 func NewProcessingOptions() *ProcessingOptions {
 	po := ProcessingOptions{
-		ResizingType:      ResizeFit,
-		Width:             0,
-		Height:            0,
-		ZoomWidth:         1,
-		ZoomHeight:        1,
-		Gravity:           GravityOptions{Type: GravityCenter},
-		Enlarge:           false,
-		Extend:            ExtendOptions{Enabled: false, Gravity: GravityOptions{Type: GravityCenter}},
+		ResizingType: ResizeFit,
+		Width:        0,
+		Height:       0,
+		ZoomWidth:    1,
+		ZoomHeight:   1,
+		Gravity:      GravityOptions{Type: GravityCenter},
+		Enlarge:      false,
+		Extend: ExtendOptions{
+			Enabled:        false,
+			Gravity:        GravityOptions{Type: GravityCenter},
+			BlurSigma:      float32(config.ExtendBlurSigma),
+			BlurBrightness: config.ExtendBlurBrightness,
+		},
 		ExtendAspectRatio: ExtendOptions{Enabled: false, Gravity: GravityOptions{Type: GravityCenter}},
 		Padding:           PaddingOptions{Enabled: false},
 		Trim:              TrimOptions{Enabled: false, Threshold: 10, Smart: true},
@@ -153,8 +289,9 @@ func NewProcessingOptions() *ProcessingOptions {
 		Background:        vips.Color{R: 255, G: 255, B: 255},
 		Blur:              0,
 		Sharpen:           0.5,
+		ColorAdjust:       ColorAdjustOptions{Contrast: 1, Saturation: 1, Gamma: 1},
 		Dpr:               1,
-		Watermark:         WatermarkOptions{Opacity: 1, Position: GravityOptions{Type: GravityCenter}},
+		Watermark:         WatermarkOptions{Opacity: 1, Position: GravityOptions{Type: GravitySouthEast, X: 17, Y: 6}},
 		Artifact:          ArtifactOptions{Opacity: 1, Position: GravityOptions{Type: GravityCenter}},
 		StripMetadata:     config.StripMetadata,
 		KeepCopyright:     config.KeepCopyright,
@@ -162,6 +299,21 @@ func NewProcessingOptions() *ProcessingOptions {
 		AutoRotate:        config.AutoRotate,
 		EnforceThumbnail:  config.EnforceThumbnail,
 		ReturnAttachment:  config.ReturnAttachment,
+		SaveOptions:       vips.DefaultSaveOptions(),
+		TargetQuality: TargetQualityOptions{
+			SSIM:       config.TargetQualitySSIM,
+			MinQuality: config.TargetQualityMin,
+			MaxQuality: config.TargetQualityMax,
+		},
+		DerivativeStore: DerivativeStoreOptions{Enabled: false, TTL: config.DerivativeStoreTTL},
+		Animation:       AnimationOptions{Frame: -1, Stride: 1, Speed: 1, Loop: -1},
+		CacheControl: CacheControlOptions{
+			TTL:                  config.TTL,
+			SMaxAge:              config.CacheControlSMaxAge,
+			StaleWhileRevalidate: config.CacheControlStaleWhileRevalidate,
+			StaleIfError:         config.CacheControlStaleIfError,
+			Immutable:            config.CacheControlImmutable,
+		},
 
 		SkipProcessingFormats: append([]imagetype.Type(nil), config.SkipProcessingFormats...),
 		UsedPresets:           make([]string, 0, len(config.Presets)),
@@ -181,10 +333,16 @@ func NewProcessingOptions() *ProcessingOptions {
 }
 
 func (po *ProcessingOptions) GetQuality() int {
+	return po.GetFormatQuality(po.Format)
+}
+
+// GetFormatQuality returns the quality the image should be saved with
+// if it's saved to the format
+func (po *ProcessingOptions) GetFormatQuality(format imagetype.Type) int {
 	q := po.Quality
 
 	if q == 0 {
-		q = po.FormatQuality[po.Format]
+		q = po.FormatQuality[format]
 	}
 
 	if q == 0 {
@@ -337,6 +495,37 @@ func applyExtendOption(po *ProcessingOptions, args []string) error {
 	return parseExtend(&po.Extend, "extend", args)
 }
 
+// applyExtendBlurOption parses `enabled[:sigma[:brightness]]`.
+// Enabling the blurred fill enables extend as well
+func applyExtendBlurOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 3 {
+		return newOptionArgumentError("Invalid extend blur arguments: %v", args)
+	}
+
+	po.Extend.Blur = parseBoolOption(args[0])
+	if po.Extend.Blur {
+		po.Extend.Enabled = true
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		if sigma, err := strconv.ParseFloat(args[1], 32); err == nil && sigma > 0 {
+			po.Extend.BlurSigma = float32(sigma)
+		} else {
+			return newOptionArgumentError("Invalid extend blur sigma: %s", args[1])
+		}
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		if b, err := strconv.ParseFloat(args[2], 64); err == nil && b >= 0 && b <= 1 {
+			po.Extend.BlurBrightness = b
+		} else {
+			return newOptionArgumentError("Invalid extend blur brightness: %s", args[2])
+		}
+	}
+
+	return nil
+}
+
 func applyExtendAspectRatioOption(po *ProcessingOptions, args []string) error {
 	return parseExtend(&po.ExtendAspectRatio, "extend_aspect_ratio", args)
 }
@@ -450,6 +639,12 @@ func applyGravityOption(po *ProcessingOptions, args []string) error {
 	return parseGravity(&po.Gravity, "gravity", args, cropGravityTypes)
 }
 
+// ApplyGravity sets the gravity from the `type[:x_offset:y_offset]` arguments.
+// It's used by the endpoints that set gravities apart from the URL options
+func (po *ProcessingOptions) ApplyGravity(args []string) error {
+	return applyGravityOption(po, args)
+}
+
 func applyCropOption(po *ProcessingOptions, args []string) error {
 	if w, err := strconv.ParseFloat(args[0], 64); err == nil && w >= 0 {
 		po.Crop.Width = w
@@ -564,6 +759,68 @@ func applyRotateOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+// applyRotateAngleOption parses `angle[:auto_crop[:background]]`.
+// Without the background the corners are transparent
+func applyRotateAngleOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 3 {
+		return newOptionArgumentError("Invalid rotate angle arguments: %v", args)
+	}
+
+	ro := RotateAngleOptions{}
+
+	if err := parseFloatInRange(&ro.Angle, "rotate angle", args[0], -360, 360); err != nil {
+		return err
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		ro.AutoCrop = parseBoolOption(args[1])
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		c, err := vips.ColorFromHex(args[2])
+		if err != nil {
+			return newOptionArgumentError("Invalid rotate angle background: %s", args[2])
+		}
+
+		ro.Fill = true
+		ro.Background = c
+	}
+
+	po.RotateAngle = ro
+
+	return nil
+}
+
+// editOptions are the options allowed in the sidecar edits of the originals
+var editOptions = map[string]bool{
+	"rotate":       true,
+	"rot":          true,
+	"rotate_angle": true,
+	"ra":           true,
+}
+
+// ApplyEdits applies the sidecar edits of the original. Edits are the rotation
+// options in the presets format: `ra:3.5:1/rot:90`
+func (po *ProcessingOptions) ApplyEdits(edits string) error {
+	edits = strings.TrimSpace(edits)
+	if len(edits) == 0 {
+		return nil
+	}
+
+	opts, rest := parseURLOptions(strings.Split(edits, "/"))
+	if len(rest) > 0 {
+		return newOptionArgumentError("Invalid edits: %s", edits)
+	}
+
+	for _, opt := range opts {
+		if !editOptions[opt.Name] {
+			return newOptionArgumentError("Option %s is not allowed in edits", opt.Name)
+		}
+	}
+
+	return applyURLOptions(po, opts)
+}
+
 func applyQualityOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 1 {
 		return newOptionArgumentError("Invalid quality arguments: %v", args)
@@ -601,7 +858,7 @@ func applyFormatQualityOption(po *ProcessingOptions, args []string) error {
 }
 
 func applyMaxBytesOption(po *ProcessingOptions, args []string) error {
-	if len(args) > 1 {
+	if len(args) > 2 {
 		return newOptionArgumentError("Invalid max_bytes arguments: %v", args)
 	}
 
@@ -611,14 +868,167 @@ func applyMaxBytesOption(po *ProcessingOptions, args []string) error {
 		return newOptionArgumentError("Invalid max_bytes: %s", args[0])
 	}
 
+	po.MaxBytesStrict = len(args) > 1 && parseBoolOption(args[1])
+
+	return nil
+}
+
+func applyTargetQualityOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 3 {
+		return newOptionArgumentError("Invalid target quality arguments: %v", args)
+	}
+
+	if ssim, err := strconv.ParseFloat(args[0], 64); err == nil && ssim >= 0 && ssim < 1 {
+		po.TargetQuality.SSIM = ssim
+	} else {
+		return newOptionArgumentError("Invalid target quality ssim: %s", args[0])
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		if err := parseIntInRange(&po.TargetQuality.MinQuality, "target quality min", args[1], 1, 100); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		if err := parseIntInRange(&po.TargetQuality.MaxQuality, "target quality max", args[2], 1, 100); err != nil {
+			return err
+		}
+	}
+
+	if po.TargetQuality.MinQuality > po.TargetQuality.MaxQuality {
+		return newOptionArgumentError("Invalid target quality range: %d-%d", po.TargetQuality.MinQuality, po.TargetQuality.MaxQuality)
+	}
+
+	return nil
+}
+
+func parseFloatInRange(dst *float64, name string, arg string, min, max float64) error {
+	if v, err := strconv.ParseFloat(arg, 64); err == nil && v >= min && v <= max {
+		*dst = v
+		return nil
+	}
+
+	return newOptionArgumentError("Invalid %s: %s", name, arg)
+}
+
+func parseIntInRange(dst *int, name string, arg string, min, max int) error {
+	if v, err := strconv.Atoi(arg); err == nil && v >= min && v <= max {
+		*dst = v
+		return nil
+	}
+
+	return newOptionArgumentError("Invalid %s: %s", name, arg)
+}
+
+func parseChromaSubsampling(po *ProcessingOptions, name, arg string) error {
+	cs, err := vips.ParseChromaSubsampling(arg)
+	if err != nil {
+		return newOptionArgumentError("Invalid %s subsample: %s", name, arg)
+	}
+
+	po.SaveOptions.ChromaSubsampling = cs
+
+	return nil
+}
+
+func applyJpegOptionsOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 3 {
+		return newOptionArgumentError("Invalid jpeg options arguments: %v", args)
+	}
+
+	if len(args[0]) > 0 {
+		po.SaveOptions.JpegProgressive = parseBoolOption(args[0])
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		po.SaveOptions.JpegTrellisQuant = parseBoolOption(args[1])
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		return parseChromaSubsampling(po, "jpeg", args[2])
+	}
+
+	return nil
+}
+
+func applyPngOptionsOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 2 {
+		return newOptionArgumentError("Invalid png options arguments: %v", args)
+	}
+
+	if len(args[0]) > 0 {
+		po.SaveOptions.PngQuantize = parseBoolOption(args[0])
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		return parseIntInRange(&po.SaveOptions.PngQuantizationColors, "png quantization colors", args[1], 2, 256)
+	}
+
+	return nil
+}
+
+func applyWebpOptionsOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 3 {
+		return newOptionArgumentError("Invalid webp options arguments: %v", args)
+	}
+
+	switch args[0] {
+	case "":
+	case "lossy":
+		po.SaveOptions.WebpLossless = false
+		po.SaveOptions.WebpNearLossless = false
+	case "near_lossless":
+		po.SaveOptions.WebpLossless = false
+		po.SaveOptions.WebpNearLossless = true
+	case "lossless":
+		po.SaveOptions.WebpLossless = true
+		po.SaveOptions.WebpNearLossless = false
+	default:
+		return newOptionArgumentError("Invalid webp compression: %s", args[0])
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		if err := parseIntInRange(&po.SaveOptions.WebpMethod, "webp method", args[1], 0, 6); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		return parseIntInRange(&po.SaveOptions.WebpAlphaQuality, "webp alpha quality", args[2], 0, 100)
+	}
+
+	return nil
+}
+
+func applyAvifOptionsOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 2 {
+		return newOptionArgumentError("Invalid avif options arguments: %v", args)
+	}
+
+	if len(args[0]) > 0 {
+		if err := parseIntInRange(&po.SaveOptions.AvifSpeed, "avif speed", args[0], 0, 9); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		return parseChromaSubsampling(po, "avif", args[1])
+	}
+
 	return nil
 }
 
 func applyBackgroundOption(po *ProcessingOptions, args []string) error {
+	po.BackgroundAuto = false
+
 	switch len(args) {
 	case 1:
 		if len(args[0]) == 0 {
 			po.Flatten = false
+		} else if args[0] == "auto" {
+			po.Flatten = true
+			po.BackgroundAuto = true
 		} else if c, err := vips.ColorFromHex(args[0]); err == nil {
 			po.Flatten = true
 			po.Background = c
@@ -696,6 +1106,154 @@ func applyPixelateOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+// applyMaskOption parses `round:radius`, `circle`, `ellipse`, `image:name`, or `none`
+func applyMaskOption(po *ProcessingOptions, args []string) error {
+	t, ok := maskTypes[args[0]]
+	if !ok {
+		return newOptionArgumentError("Invalid mask type: %s", args[0])
+	}
+
+	mask := MaskOptions{Type: t}
+
+	switch t {
+	case MaskRound:
+		if len(args) != 2 {
+			return newOptionArgumentError("Invalid mask arguments: %v", args)
+		}
+
+		if r, err := strconv.ParseFloat(args[1], 64); err == nil && r > 0 {
+			mask.Radius = r
+		} else {
+			return newOptionArgumentError("Invalid mask radius: %s", args[1])
+		}
+
+	case MaskImage:
+		if len(args) != 2 {
+			return newOptionArgumentError("Invalid mask arguments: %v", args)
+		}
+
+		mask.Image = args[1]
+
+	default:
+		if len(args) > 1 {
+			return newOptionArgumentError("Invalid mask arguments: %v", args)
+		}
+	}
+
+	po.Mask = mask
+
+	return nil
+}
+
+func applyBrightnessOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid brightness arguments: %v", args)
+	}
+
+	return parseIntInRange(&po.ColorAdjust.Brightness, "brightness", args[0], -255, 255)
+}
+
+func applyContrastOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid contrast arguments: %v", args)
+	}
+
+	return parseFloatInRange(&po.ColorAdjust.Contrast, "contrast", args[0], 0, 10)
+}
+
+func applySaturationOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid saturation arguments: %v", args)
+	}
+
+	return parseFloatInRange(&po.ColorAdjust.Saturation, "saturation", args[0], 0, 10)
+}
+
+func applyGammaOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid gamma arguments: %v", args)
+	}
+
+	if err := parseFloatInRange(&po.ColorAdjust.Gamma, "gamma", args[0], 0, 10); err != nil {
+		return err
+	}
+
+	if po.ColorAdjust.Gamma == 0 {
+		return newOptionArgumentError("Invalid gamma: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyGrayscaleOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid grayscale arguments: %v", args)
+	}
+
+	po.ColorAdjust.Grayscale = parseBoolOption(args[0])
+
+	return nil
+}
+
+func applyAutoLevelOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid auto level arguments: %v", args)
+	}
+
+	po.ColorAdjust.AutoLevel = parseBoolOption(args[0])
+
+	return nil
+}
+
+func applySepiaOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid sepia arguments: %v", args)
+	}
+
+	if parseBoolOption(args[0]) {
+		po.ColorAdjust.Duotone = sepiaDuotone
+	} else {
+		po.ColorAdjust.Duotone.Enabled = false
+	}
+
+	return nil
+}
+
+// applyDuotoneOption parses `shadow:highlight[:intensity]` with hex colours.
+// An empty shadow disables the duotone
+func applyDuotoneOption(po *ProcessingOptions, args []string) error {
+	if len(args) == 1 && len(args[0]) == 0 {
+		po.ColorAdjust.Duotone.Enabled = false
+		return nil
+	}
+
+	if len(args) < 2 || len(args) > 3 {
+		return newOptionArgumentError("Invalid duotone arguments: %v", args)
+	}
+
+	d := DuotoneOptions{Enabled: true, Intensity: 1}
+
+	var err error
+
+	if d.Shadow, err = vips.ColorFromHex(args[0]); err != nil {
+		return newOptionArgumentError("Invalid duotone shadow: %s", args[0])
+	}
+
+	if d.Highlight, err = vips.ColorFromHex(args[1]); err != nil {
+		return newOptionArgumentError("Invalid duotone highlight: %s", args[1])
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		if err = parseFloatInRange(&d.Intensity, "duotone intensity", args[2], 0, 1); err != nil {
+			return err
+		}
+	}
+
+	po.ColorAdjust.Duotone = d
+
+	return nil
+}
+
 func applyPresetOption(po *ProcessingOptions, args []string, usedPresets ...string) error {
 	for _, preset := range args {
 		if p, ok := presets[preset]; ok {
@@ -718,20 +1276,67 @@ func applyPresetOption(po *ProcessingOptions, args []string, usedPresets ...stri
 }
 
 func applyWatermarkOption(po *ProcessingOptions, args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("Invalid watermark arguments: %v", args)
+	if len(args) == 0 || len(args) > 6 {
+		return newOptionArgumentError("Invalid watermark arguments: %v", args)
 	}
+
 	if watermarkType, err := strconv.Atoi(args[0]); err != nil || watermarkType < 1 || watermarkType > 3 {
 		po.Watermark.Enabled = false
 		return nil
 	}
+
 	po.Watermark.Enabled = true
-	po.Watermark.Opacity = 1
 	po.Watermark.Type = args[0]
-	po.Watermark.Position.Type = GravitySouthEast
-	po.Watermark.Position.X = 17
-	po.Watermark.Position.Y = 6
-	po.Watermark.Scale = 0
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		if err := applyWatermarkOpacityOption(po, args[1:2]); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		if err := applyWatermarkPositionOption(po, args[2:imath.Min(len(args), 5)]); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 5 && len(args[5]) > 0 {
+		if err := applyWatermarkScaleOption(po, args[5:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyWatermarkOpacityOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid watermark opacity arguments: %v", args)
+	}
+
+	if o, err := strconv.ParseFloat(args[0], 64); err == nil && o >= 0 && o <= 1 {
+		po.Watermark.Opacity = o
+	} else {
+		return newOptionArgumentError("Invalid watermark opacity: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyWatermarkPositionOption(po *ProcessingOptions, args []string) error {
+	return parseGravity(&po.Watermark.Position, "watermark position", args, watermarkGravityTypes)
+}
+
+func applyWatermarkScaleOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid watermark scale arguments: %v", args)
+	}
+
+	if s, err := strconv.ParseFloat(args[0], 64); err == nil && s >= 0 {
+		po.Watermark.Scale = s
+	} else {
+		return newOptionArgumentError("Invalid watermark scale: %s", args[0])
+	}
 
 	return nil
 }
@@ -809,6 +1414,40 @@ func applyRawOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyCacheControlOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 5 {
+		return newOptionArgumentError("Invalid cache control arguments: %v", args)
+	}
+
+	durations := []struct {
+		name string
+		dst  *int
+	}{
+		{"TTL", &po.CacheControl.TTL},
+		{"s-maxage", &po.CacheControl.SMaxAge},
+		{"stale-while-revalidate", &po.CacheControl.StaleWhileRevalidate},
+		{"stale-if-error", &po.CacheControl.StaleIfError},
+	}
+
+	for i, d := range durations {
+		if len(args) <= i || len(args[i]) == 0 {
+			continue
+		}
+
+		if v, err := strconv.Atoi(args[i]); err == nil && v >= 0 {
+			*d.dst = v
+		} else {
+			return newOptionArgumentError("Invalid cache control %s: %s", d.name, args[i])
+		}
+	}
+
+	if len(args) > 4 && len(args[4]) > 0 {
+		po.CacheControl.Immutable = parseBoolOption(args[4])
+	}
+
+	return nil
+}
+
 func applyFilenameOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 2 {
 		return newOptionArgumentError("Invalid filename arguments: %v", args)
@@ -868,6 +1507,22 @@ func applyKeepCopyrightOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyMetadataPolicyOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid metadata policy arguments: %v", args)
+	}
+
+	if len(args[0]) > 0 {
+		if _, ok := imagemeta.GetMetadataPolicy(args[0]); !ok {
+			return newOptionArgumentError("Unknown metadata policy: %s", args[0])
+		}
+	}
+
+	po.MetadataPolicy = args[0]
+
+	return nil
+}
+
 func applyStripColorProfileOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 1 {
 		return newOptionArgumentError("Invalid strip color profile arguments: %v", args)
@@ -944,6 +1599,53 @@ func applyMaxSrcFileSizeOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyAnimationFrameOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return newOptionArgumentError("Invalid animation frame arguments: %v", args)
+	}
+
+	if args[0] == "best" {
+		po.Animation.Frame = BestFrame
+		return nil
+	}
+
+	return parseIntInRange(&po.Animation.Frame, "animation frame", args[0], -1, math.MaxInt32)
+}
+
+func applyAnimationOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 4 {
+		return newOptionArgumentError("Invalid animation arguments: %v", args)
+	}
+
+	if len(args[0]) > 0 {
+		if err := parseIntInRange(&po.Animation.Stride, "animation stride", args[0], 1, math.MaxInt32); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		if x, err := strconv.ParseFloat(args[1], 64); err == nil && x > 0 {
+			po.Animation.Speed = x
+		} else {
+			return newOptionArgumentError("Invalid animation speed: %s", args[1])
+		}
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		if err := parseIntInRange(&po.Animation.Loop, "animation loop", args[2], -1, math.MaxUint16); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 3 && len(args[3]) > 0 {
+		if err := parseIntInRange(&po.Animation.MaxDuration, "animation max duration", args[3], 0, math.MaxInt32); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func applyMaxAnimationFramesOption(po *ProcessingOptions, args []string) error {
 	if err := security.IsSecurityOptionsAllowed(); err != nil {
 		return err
@@ -980,6 +1682,24 @@ func applyMaxAnimationFrameResolutionOption(po *ProcessingOptions, args []string
 	return nil
 }
 
+func applyDerivativeStoreOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 2 {
+		return newOptionArgumentError("Invalid derivative store arguments: %v", args)
+	}
+
+	po.DerivativeStore.Enabled = parseBoolOption(args[0])
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		if ttl, err := strconv.Atoi(args[1]); err == nil && ttl >= 0 {
+			po.DerivativeStore.TTL = ttl
+		} else {
+			return newOptionArgumentError("Invalid derivative store TTL: %s", args[1])
+		}
+	}
+
+	return nil
+}
+
 func applyURLOption(po *ProcessingOptions, name string, args []string, usedPresets ...string) error {
 	switch name {
 	case "resize", "rs":
@@ -1004,6 +1724,8 @@ func applyURLOption(po *ProcessingOptions, name string, args []string, usedPrese
 		return applyEnlargeOption(po, args)
 	case "extend", "ex":
 		return applyExtendOption(po, args)
+	case "extend_blur", "exb":
+		return applyExtendBlurOption(po, args)
 	case "extend_aspect_ratio", "extend_ar", "exar":
 		return applyExtendAspectRatioOption(po, args)
 	case "gravity", "g":
@@ -1018,6 +1740,8 @@ func applyURLOption(po *ProcessingOptions, name string, args []string, usedPrese
 		return applyAutoRotateOption(po, args)
 	case "rotate", "rot":
 		return applyRotateOption(po, args)
+	case "rotate_angle", "ra":
+		return applyRotateAngleOption(po, args)
 	case "background", "bg":
 		return applyBackgroundOption(po, args)
 	case "blur", "bl":
@@ -1026,14 +1750,40 @@ func applyURLOption(po *ProcessingOptions, name string, args []string, usedPrese
 		return applySharpenOption(po, args)
 	case "pixelate", "pix":
 		return applyPixelateOption(po, args)
+	case "mask", "mk":
+		return applyMaskOption(po, args)
+	case "brightness", "br":
+		return applyBrightnessOption(po, args)
+	case "contrast", "co":
+		return applyContrastOption(po, args)
+	case "saturation", "sa":
+		return applySaturationOption(po, args)
+	case "gamma", "ga":
+		return applyGammaOption(po, args)
+	case "grayscale", "gs":
+		return applyGrayscaleOption(po, args)
+	case "auto_level", "al":
+		return applyAutoLevelOption(po, args)
+	case "sepia", "sp":
+		return applySepiaOption(po, args)
+	case "duotone", "dt":
+		return applyDuotoneOption(po, args)
 	case "watermark", "wm":
 		return applyWatermarkOption(po, args)
+	case "watermark_opacity", "wmo":
+		return applyWatermarkOpacityOption(po, args)
+	case "watermark_position", "wmg":
+		return applyWatermarkPositionOption(po, args)
+	case "watermark_scale", "wms":
+		return applyWatermarkScaleOption(po, args)
 	case "artifact", "art":
 		return applyArtifactOption(po, args)
 	case "strip_metadata", "sm":
 		return applyStripMetadataOption(po, args)
 	case "keep_copyright", "kcr":
 		return applyKeepCopyrightOption(po, args)
+	case "metadata_policy", "mp":
+		return applyMetadataPolicyOption(po, args)
 	case "strip_color_profile", "scp":
 		return applyStripColorProfileOption(po, args)
 	case "enforce_thumbnail", "eth":
@@ -1045,6 +1795,20 @@ func applyURLOption(po *ProcessingOptions, name string, args []string, usedPrese
 		return applyFormatQualityOption(po, args)
 	case "max_bytes", "mb":
 		return applyMaxBytesOption(po, args)
+	case "target_quality", "tq":
+		return applyTargetQualityOption(po, args)
+	case "animation_frame", "af":
+		return applyAnimationFrameOption(po, args)
+	case "animation", "anim":
+		return applyAnimationOption(po, args)
+	case "jpeg_options", "jpgo":
+		return applyJpegOptionsOption(po, args)
+	case "png_options", "pngo":
+		return applyPngOptionsOption(po, args)
+	case "webp_options", "webpo":
+		return applyWebpOptionsOption(po, args)
+	case "avif_options", "avifo":
+		return applyAvifOptionsOption(po, args)
 	case "format", "f", "ext", "fmt":
 		return applyFormatOption(po, args)
 	// Handling options
@@ -1056,10 +1820,14 @@ func applyURLOption(po *ProcessingOptions, name string, args []string, usedPrese
 		return applyCacheBusterOption(po, args)
 	case "expires", "exp":
 		return applyExpiresOption(po, args)
+	case "cache_control", "cc":
+		return applyCacheControlOption(po, args)
 	case "filename", "fn":
 		return applyFilenameOption(po, args)
 	case "return_attachment", "att":
 		return applyReturnAttachmentOption(po, args)
+	case "derivative_store", "ds":
+		return applyDerivativeStoreOption(po, args)
 	// Presets
 	case "preset", "pr":
 		return applyPresetOption(po, args, usedPresets...)
@@ -11,7 +11,9 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/vips"
 )
 
 type ProcessingOptionsTestSuite struct{ suite.Suite }
@@ -377,6 +379,24 @@ func (s *ProcessingOptionsTestSuite) TestParsePathBackgroundDisable() {
 	s.Require().False(po.Flatten)
 }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathBackgroundAuto() {
+	path := "/background:auto/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().True(po.Flatten)
+	s.Require().True(po.BackgroundAuto)
+
+	path = "/background:auto/background:fff/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err = ParsePath(path, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().True(po.Flatten)
+	s.Require().False(po.BackgroundAuto)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathBlur() {
 	path := "/blur:0.2/plain/http://images.dev/lorem/ipsum.jpg"
 	po, _, err := ParsePath(path, make(http.Header))
@@ -415,6 +435,324 @@ func (s *ProcessingOptionsTestSuite) TestParsePathWatermark() {
 	s.Require().InDelta(0.6, po.Watermark.Scale, 0.0001)
 }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCWatermarkOverrides() {
+	qs := url.Values{
+		"wm":  {"1"},
+		"wmg": {"nowe:10:20"},
+		"wmo": {"0.5"},
+		"wms": {"0.3"},
+	}
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", qs, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().True(po.Watermark.Enabled)
+	s.Require().Equal("1", po.Watermark.Type)
+	s.Require().Equal(GravityNorthWest, po.Watermark.Position.Type)
+	s.Require().InDelta(10.0, po.Watermark.Position.X, 0.0001)
+	s.Require().InDelta(20.0, po.Watermark.Position.Y, 0.0001)
+	s.Require().InDelta(0.5, po.Watermark.Opacity, 0.0001)
+	s.Require().InDelta(0.3, po.Watermark.Scale, 0.0001)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCWatermarkPresetDefaults() {
+	presets["hero"] = urlOptions{
+		urlOption{Name: "watermark_position", Args: []string{"sowe", "30", "12"}},
+	}
+
+	qs := url.Values{
+		"pr": {"hero"},
+		"wm": {"2"},
+	}
+	po, _, err := ParsePathIPC("/1280x720/lorem/ipsum.jpg", qs, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().True(po.Watermark.Enabled)
+	s.Require().Equal(GravitySouthWest, po.Watermark.Position.Type)
+	s.Require().InDelta(30.0, po.Watermark.Position.X, 0.0001)
+	s.Require().InDelta(12.0, po.Watermark.Position.Y, 0.0001)
+	s.Require().InDelta(1.0, po.Watermark.Opacity, 0.0001)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCWatermarkInvalidPosition() {
+	qs := url.Values{
+		"wm":  {"1"},
+		"wmg": {"fp:0.5:0.5"},
+	}
+	_, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", qs, make(http.Header))
+
+	s.Require().Error(err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCDerivativeStorePreset() {
+	presets["card"] = urlOptions{
+		urlOption{Name: "derivative_store", Args: []string{"1", "3600"}},
+	}
+
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"pr": {"card"}}, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().True(po.DerivativeStore.Enabled)
+	s.Require().Equal(3600, po.DerivativeStore.TTL)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCCacheControlPreset() {
+	config.CacheControlStaleIfError = 600
+
+	presets["hero"] = urlOptions{
+		urlOption{Name: "cache_control", Args: []string{"86400", "604800", "60", "", "1"}},
+	}
+
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"pr": {"hero"}}, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().Equal(CacheControlOptions{
+		TTL:                  86400,
+		SMaxAge:              604800,
+		StaleWhileRevalidate: 60,
+		StaleIfError:         600,
+		Immutable:            true,
+	}, po.CacheControl)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCEncoderOptions() {
+	presets["hero"] = urlOptions{
+		urlOption{Name: "avif_options", Args: []string{"4", "off"}},
+		urlOption{Name: "jpeg_options", Args: []string{"1", "1"}},
+	}
+
+	query := url.Values{
+		"pr":    {"hero"},
+		"webpo": {"near_lossless:6:90"},
+	}
+
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", query, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().Equal(4, po.SaveOptions.AvifSpeed)
+	s.Require().Equal(vips.ChromaSubsamplingOff, po.SaveOptions.ChromaSubsampling)
+	s.Require().True(po.SaveOptions.JpegProgressive)
+	s.Require().True(po.SaveOptions.JpegTrellisQuant)
+	s.Require().True(po.SaveOptions.WebpNearLossless)
+	s.Require().False(po.SaveOptions.WebpLossless)
+	s.Require().Equal(6, po.SaveOptions.WebpMethod)
+	s.Require().Equal(90, po.SaveOptions.WebpAlphaQuality)
+	s.Require().Equal(config.PngQuantizationColors, po.SaveOptions.PngQuantizationColors)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCTargetQuality() {
+	presets["tq"] = urlOptions{
+		urlOption{Name: "target_quality", Args: []string{"0.98", "", "90"}},
+	}
+
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"pr": {"tq"}}, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().Equal(TargetQualityOptions{
+		SSIM:       0.98,
+		MinQuality: config.TargetQualityMin,
+		MaxQuality: 90,
+	}, po.TargetQuality)
+
+	presets["tq"] = urlOptions{
+		urlOption{Name: "target_quality", Args: []string{"0.98", "90", "50"}},
+	}
+
+	_, _, err = ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"pr": {"tq"}}, make(http.Header))
+
+	s.Require().Error(err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCTargetQualityNotAllowedInQuery() {
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"tq": {"0.98"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().False(po.TargetQuality.Enabled())
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCMaxBytes() {
+	presets["amp"] = urlOptions{
+		urlOption{Name: "max_bytes", Args: []string{"50000"}},
+	}
+
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"pr": {"amp"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(50000, po.MaxBytes)
+
+	po, _, err = ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"pr": {"amp"}, "mb": {"20000"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(20000, po.MaxBytes)
+	s.Require().False(po.MaxBytesStrict)
+
+	po, _, err = ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"mb": {"20000:1"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(20000, po.MaxBytes)
+	s.Require().True(po.MaxBytesStrict)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCMaxBytesQueryMin() {
+	config.MaxBytesQueryMin = 10000
+
+	_, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"mb": {"1"}}, make(http.Header))
+
+	s.Require().Error(err)
+
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"mb": {"10000"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(10000, po.MaxBytes)
+
+	// Presets are not limited
+	presets["tiny"] = urlOptions{
+		urlOption{Name: "max_bytes", Args: []string{"1"}},
+	}
+
+	po, _, err = ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"pr": {"tiny"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(1, po.MaxBytes)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCAnimation() {
+	presets["preview"] = urlOptions{
+		urlOption{Name: "animation", Args: []string{"2", "1.5", "", "3000"}},
+	}
+
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.gif", url.Values{"pr": {"preview"}, "anim": {"::1"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().False(po.Animation.Poster())
+	s.Require().Equal(AnimationOptions{Frame: -1, Stride: 2, Speed: 1.5, Loop: 1, MaxDuration: 3000}, po.Animation)
+
+	po, _, err = ParsePathIPC("/642x336/lorem/ipsum.gif", url.Values{"af": {"best"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().True(po.Animation.Poster())
+	s.Require().Equal(BestFrame, po.Animation.Frame)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCExtendBlur() {
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"fit": {"blur"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(ResizeFit, po.ResizingType)
+	s.Require().True(po.Extend.Enabled)
+	s.Require().True(po.Extend.Blur)
+
+	presets["letterbox"] = urlOptions{
+		urlOption{Name: "resizing_type", Args: []string{"fit"}},
+		urlOption{Name: "extend_blur", Args: []string{"1", "30", "0.4"}},
+	}
+
+	po, _, err = ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"pr": {"letterbox"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(ResizeFit, po.ResizingType)
+	s.Require().True(po.Extend.Blur)
+	s.Require().InDelta(30, po.Extend.BlurSigma, 0.0001)
+	s.Require().InDelta(0.4, po.Extend.BlurBrightness, 0.0001)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCColorAdjust() {
+	presets["editorial"] = urlOptions{
+		urlOption{Name: "grayscale", Args: []string{"1"}},
+		urlOption{Name: "contrast", Args: []string{"1.2"}},
+	}
+
+	po, _, err := ParsePathIPC(
+		"/642x336/lorem/ipsum.jpg",
+		url.Values{"pr": {"editorial"}, "br": {"-10"}, "al": {"1"}, "dt": {"000:f0c:0.5"}},
+		make(http.Header),
+	)
+
+	s.Require().NoError(err)
+	s.Require().True(po.ColorAdjust.Enabled())
+	s.Require().Equal(-10, po.ColorAdjust.Brightness)
+	s.Require().InDelta(1.2, po.ColorAdjust.Contrast, 0.0001)
+	s.Require().True(po.ColorAdjust.Grayscale)
+	s.Require().True(po.ColorAdjust.AutoLevel)
+	s.Require().Equal(DuotoneOptions{
+		Enabled:   true,
+		Shadow:    vips.Color{R: 0, G: 0, B: 0},
+		Highlight: vips.Color{R: 255, G: 0, B: 204},
+		Intensity: 0.5,
+	}, po.ColorAdjust.Duotone)
+
+	po, _, err = ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"sp": {"1"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(sepiaDuotone, po.ColorAdjust.Duotone)
+
+	_, _, err = ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"ga": {"0"}}, make(http.Header))
+
+	s.Require().Error(err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCMask() {
+	po, _, err := ParsePathIPC("/200x200/lorem/ipsum.jpg", url.Values{"mk": {"round:0.2"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().True(po.Mask.Enabled())
+	s.Require().Equal(MaskOptions{Type: MaskRound, Radius: 0.2}, po.Mask)
+
+	presets["avatar"] = urlOptions{
+		urlOption{Name: "mask", Args: []string{"circle"}},
+	}
+
+	po, _, err = ParsePathIPC("/200x200/lorem/ipsum.jpg", url.Values{"pr": {"avatar"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(MaskOptions{Type: MaskCircle}, po.Mask)
+
+	po, _, err = ParsePathIPC("/200x200/lorem/ipsum.jpg", url.Values{"mk": {"image:badge"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(MaskOptions{Type: MaskImage, Image: "badge"}, po.Mask)
+
+	_, _, err = ParsePathIPC("/200x200/lorem/ipsum.jpg", url.Values{"mk": {"round"}}, make(http.Header))
+
+	s.Require().Error(err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCRotateAngle() {
+	po, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"ra": {"3.5:1"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().True(po.RotateAngle.Enabled())
+	s.Require().False(po.RotateAngle.Transparent())
+	s.Require().Equal(RotateAngleOptions{Angle: 3.5, AutoCrop: true}, po.RotateAngle)
+
+	po, _, err = ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"ra": {"-2::ffffff"}}, make(http.Header))
+
+	s.Require().NoError(err)
+	s.Require().Equal(RotateAngleOptions{Angle: -2, Fill: true, Background: vips.Color{R: 255, G: 255, B: 255}}, po.RotateAngle)
+}
+
+func (s *ProcessingOptionsTestSuite) TestApplyEdits() {
+	po := NewProcessingOptions()
+
+	s.Require().NoError(po.ApplyEdits(" ra:3.5:1/rot:90\n"))
+	s.Require().Equal(90, po.Rotate)
+	s.Require().Equal(RotateAngleOptions{Angle: 3.5, AutoCrop: true}, po.RotateAngle)
+
+	s.Require().Error(po.ApplyEdits("rs:fill:100:100"))
+	s.Require().Error(po.ApplyEdits("ra:3.5/lorem.jpg"))
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathIPCInvalidEncoderOptions() {
+	_, _, err := ParsePathIPC("/642x336/lorem/ipsum.jpg", url.Values{"avifo": {"10"}}, make(http.Header))
+
+	s.Require().Error(err)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathPreset() {
 	presets["test1"] = urlOptions{
 		urlOption{Name: "resizing_type", Args: []string{"fill"}},
@@ -489,6 +827,23 @@ func (s *ProcessingOptionsTestSuite) TestParsePathStripMetadata() {
 	s.Require().True(po.StripMetadata)
 }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathMetadataPolicy() {
+	err := imagemeta.ParseMetadataPolicies(map[string]string{"camera": "exif:Make,exif:Model"})
+	s.Require().NoError(err)
+
+	path := "/metadata_policy:camera/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	s.Require().NoError(err)
+
+	s.Require().Equal("camera", po.MetadataPolicy)
+
+	path = "/mp:unknown/plain/http://images.dev/lorem/ipsum.jpg"
+	_, _, err = ParsePath(path, make(http.Header))
+
+	s.Require().Error(err)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathWebpDetection() {
 	config.AutoWebp = true
 
@@ -2,6 +2,7 @@ package options
 
 import (
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -54,7 +55,61 @@ func parseURLOptionsIPC(qs url.Values, path string) (urlOptions, string, error)
 	}
 
 	// Define allowed query parameters
-	validKeys := map[string]bool{"qp": true, "wm": true, "art": true, "fmt" : true, "fit" : true, "sh" : true}
+	validKeys := map[string]bool{
+		// Base options
+		"qp":  true,
+		"art": true,
+		"fmt": true,
+		"fit": true,
+		"sh":  true,
+
+		// Watermark
+		"wm":  true,
+		"wmo": true,
+		"wmg": true,
+		"wms": true,
+
+		// Encoder tuning. Target quality encodes the image several times,
+		// so it's available only in presets. Max bytes is limited by
+		// IMGPROXY_MAX_BYTES_QUERY_MIN for the same reason
+		"jpgo":  true,
+		"pngo":  true,
+		"webpo": true,
+		"avifo": true,
+		"mb":    true,
+
+		// Animation
+		"af":   true,
+		"anim": true,
+
+		// Blurred background letterboxing
+		"exb": true,
+
+		// Colour adjustments and filters
+		"br": true,
+		"co": true,
+		"sa": true,
+		"ga": true,
+		"gs": true,
+		"al": true,
+		"sp": true,
+		"dt": true,
+
+		// Masks and rotation
+		"mk": true,
+		"ra": true,
+
+		// Metadata policy
+		"mp": true,
+	}
+
+	// Presets go first so that explicit query parameters can override them
+	if pr := qs.Get("pr"); len(pr) > 0 {
+		parsed = append(parsed, urlOption{
+			Name: "pr",
+			Args: strings.Split(pr, config.ArgumentsSeparator),
+		})
+	}
 
 	if isMediaPath(path) {
 		parsed = append(parsed, urlOption{
@@ -68,13 +123,41 @@ func parseURLOptionsIPC(qs url.Values, path string) (urlOptions, string, error)
         })
 	}
 
+	// Sort keys so options that touch the same fields are applied in a stable order
+	keys := make([]string, 0, len(qs))
+	for key := range qs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	// Append valid query parameters
-	for key, val := range qs {
+	for _, key := range keys {
+		val := qs[key]
+
 		if validKeys[key] {
 			if key == "fit" {
 				parsed[0].Args[0] = "fit"
+
+				// `fit=blur` fills the letterbox with the blurred image instead of the background colour
+				if val[0] == "blur" {
+					parsed = append(parsed, urlOption{Name: "exb", Args: []string{"1"}})
+				}
 				continue
 			}
+
+			// Multi-argument options like `wmg=soea:10:20` come as a single value
+			if len(val) == 1 {
+				val = strings.Split(val[0], config.ArgumentsSeparator)
+			}
+
+			// Every max_bytes attempt is a separate encode, so tiny budgets
+			// from arbitrary URLs would burn through all of them
+			if key == "mb" {
+				if mb, err := strconv.Atoi(val[0]); err == nil && mb > 0 && mb < config.MaxBytesQueryMin {
+					return nil, "", newOptionArgumentError("max_bytes should be at least %d, now - %d", config.MaxBytesQueryMin, mb)
+				}
+			}
+
 			parsed = append(parsed, urlOption{Name: key, Args: val})
 		}
 	}
@@ -0,0 +1,174 @@
+package palette
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Max number of k-means iterations. Clusters initialised by median cut
+// are close to the final ones, so a few iterations are enough
+const maxIterations = 10
+
+// Swatch is a palette colour with the share of the pixels that are the closest to it
+type Swatch struct {
+	R, G, B    uint8
+	Proportion float64
+}
+
+// Hex returns the swatch colour in the `#rrggbb` format
+func (s Swatch) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", s.R, s.G, s.B)
+}
+
+type point [3]float64
+
+func (p point) dist(q point) float64 {
+	d0, d1, d2 := p[0]-q[0], p[1]-q[1], p[2]-q[2]
+	return d0*d0 + d1*d1 + d2*d2
+}
+
+// Extract finds up to k colours that represent 8-bit RGB pixels the best.
+// Colours are found with k-means initialised by median cut. Swatches are sorted
+// by proportion, so the first one is the dominant colour
+func Extract(pixels []byte, k int) []Swatch {
+	n := len(pixels) / 3
+	if n == 0 || k <= 0 {
+		return nil
+	}
+
+	points := make([]point, n)
+	for i := range points {
+		points[i] = point{float64(pixels[i*3]), float64(pixels[i*3+1]), float64(pixels[i*3+2])}
+	}
+
+	centroids := medianCut(points, min(k, n))
+
+	assignment := make([]int, n)
+	counts := make([]int, len(centroids))
+
+	for it := 0; it < maxIterations; it++ {
+		changed := false
+
+		for i, p := range points {
+			best, bestDist := 0, p.dist(centroids[0])
+			for c := 1; c < len(centroids); c++ {
+				if d := p.dist(centroids[c]); d < bestDist {
+					best, bestDist = c, d
+				}
+			}
+
+			if it == 0 || assignment[i] != best {
+				assignment[i] = best
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+
+		sums := make([]point, len(centroids))
+		clear(counts)
+
+		for i, p := range points {
+			c := assignment[i]
+			counts[c]++
+			for ch := 0; ch < 3; ch++ {
+				sums[c][ch] += p[ch]
+			}
+		}
+
+		// Empty clusters keep their centroids
+		for c := range centroids {
+			if counts[c] > 0 {
+				for ch := 0; ch < 3; ch++ {
+					centroids[c][ch] = sums[c][ch] / float64(counts[c])
+				}
+			}
+		}
+	}
+
+	swatches := make([]Swatch, 0, len(centroids))
+
+	for c, cp := range centroids {
+		if counts[c] == 0 {
+			continue
+		}
+
+		swatches = append(swatches, Swatch{
+			R:          uint8(cp[0] + 0.5),
+			G:          uint8(cp[1] + 0.5),
+			B:          uint8(cp[2] + 0.5),
+			Proportion: float64(counts[c]) / float64(n),
+		})
+	}
+
+	sort.SliceStable(swatches, func(i, j int) bool {
+		return swatches[i].Proportion > swatches[j].Proportion
+	})
+
+	return swatches
+}
+
+// medianCut splits the points into k boxes, splitting the box with the widest
+// channel range at the median every time. It returns the mean colours of the boxes
+func medianCut(points []point, k int) []point {
+	boxes := [][]point{append([]point(nil), points...)}
+
+	for len(boxes) < k {
+		split, splitCh := -1, 0
+		var splitRange float64
+
+		for b, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+
+			for ch := 0; ch < 3; ch++ {
+				lo, hi := box[0][ch], box[0][ch]
+				for _, p := range box[1:] {
+					lo, hi = min(lo, p[ch]), max(hi, p[ch])
+				}
+
+				if hi-lo > splitRange {
+					split, splitCh, splitRange = b, ch, hi-lo
+				}
+			}
+		}
+
+		// All the boxes are of a single colour
+		if split < 0 {
+			break
+		}
+
+		box := boxes[split]
+		sort.Slice(box, func(i, j int) bool { return box[i][splitCh] < box[j][splitCh] })
+
+		// Don't split a run of the same value, so both halves are not empty
+		mid := len(box) / 2
+		for mid > 1 && box[mid-1][splitCh] == box[mid][splitCh] {
+			mid--
+		}
+		for mid < len(box)-1 && box[mid-1][splitCh] == box[mid][splitCh] {
+			mid++
+		}
+
+		boxes[split] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	centroids := make([]point, len(boxes))
+
+	for b, box := range boxes {
+		for _, p := range box {
+			for ch := 0; ch < 3; ch++ {
+				centroids[b][ch] += p[ch]
+			}
+		}
+		for ch := 0; ch < 3; ch++ {
+			centroids[b][ch] /= float64(len(box))
+		}
+	}
+
+	return centroids
+}
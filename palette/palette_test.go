@@ -0,0 +1,49 @@
+package palette
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	// 3/4 red, 1/4 blue
+	pixels := make([]byte, 0, 64*3)
+	for i := 0; i < 64; i++ {
+		if i%4 == 0 {
+			pixels = append(pixels, 0, 0, 255)
+		} else {
+			pixels = append(pixels, 255, 0, 0)
+		}
+	}
+
+	swatches := Extract(pixels, 5)
+
+	require.Equal(t, []Swatch{
+		{R: 255, G: 0, B: 0, Proportion: 0.75},
+		{R: 0, G: 0, B: 255, Proportion: 0.25},
+	}, swatches)
+	require.Equal(t, "#ff0000", swatches[0].Hex())
+}
+
+func TestExtractClusters(t *testing.T) {
+	// Shades of green and grey should be grouped into two swatches
+	var pixels []byte
+	for i := 0; i < 30; i++ {
+		pixels = append(pixels, 20, byte(180+i%5), 20)
+	}
+	for i := 0; i < 10; i++ {
+		pixels = append(pixels, byte(120+i%3), byte(120+i%3), byte(120+i%3))
+	}
+
+	swatches := Extract(pixels, 2)
+
+	require.Len(t, swatches, 2)
+	require.InDelta(t, 0.75, swatches[0].Proportion, 1e-9)
+	require.Greater(t, swatches[0].G, uint8(175))
+	require.InDelta(t, 121, float64(swatches[1].R), 1)
+}
+
+func TestExtractEmpty(t *testing.T) {
+	require.Nil(t, Extract(nil, 5))
+}
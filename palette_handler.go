@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/errorreport"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/metrics"
+	"github.com/imgproxy/imgproxy/v3/metrics/stats"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/palette"
+	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+const (
+	// Size of the render the palette is extracted from
+	paletteRenderSize = 64
+
+	defaultPaletteColors = 5
+	maxPaletteColors     = 16
+)
+
+type paletteSwatch struct {
+	Color      string  `json:"color"`
+	Proportion float64 `json:"proportion"`
+}
+
+type paletteResponse struct {
+	Dominant string          `json:"dominant"`
+	Palette  []paletteSwatch `json:"palette"`
+}
+
+func newPaletteResponse(swatches []palette.Swatch) paletteResponse {
+	resp := paletteResponse{Palette: make([]paletteSwatch, len(swatches))}
+
+	for i, s := range swatches {
+		resp.Palette[i] = paletteSwatch{
+			Color:      s.Hex(),
+			Proportion: math.Round(s.Proportion*1000) / 1000,
+		}
+	}
+
+	if len(swatches) > 0 {
+		resp.Dominant = swatches[0].Hex()
+	}
+
+	return resp
+}
+
+// GET /palette/{path}[?colors=5]
+func handlePalette(reqID string, rw http.ResponseWriter, r *http.Request) {
+	stats.IncRequestsInProgress()
+	defer stats.DecRequestsInProgress()
+
+	ctx := r.Context()
+
+	path := strings.TrimPrefix(r.URL.Path, config.PathPrefix+"/palette/")
+
+	qs := maps.Clone(r.URL.Query())
+	if qs == nil {
+		qs = make(url.Values)
+	}
+
+	colors := defaultPaletteColors
+	if c := qs.Get("colors"); len(c) > 0 {
+		var err error
+		if colors, err = strconv.Atoi(c); err != nil || colors < 1 || colors > maxPaletteColors {
+			sendErrAndPanic(ctx, "path_parsing", newInvalidURLErrorf(http.StatusBadRequest, "Invalid palette colors: %s", c))
+		}
+	}
+
+	// The palette is extracted from a small render, so presets (e.g. crops) apply
+	qs.Set("fit", "1")
+
+	po, imageURL, err := options.ParsePathIPC(fmt.Sprintf("%dx%d/%s", paletteRenderSize, paletteRenderSize, path), qs, r.Header)
+	checkErr(ctx, "path_parsing", err)
+
+	po.Watermark.Enabled = false
+
+	errorreport.SetMetadata(r, "Source Image URL", imageURL)
+	errorreport.SetMetadata(r, "Processing Options", po)
+
+	metrics.SetMetadata(ctx, "imgproxy.source_image_url", imageURL)
+	metrics.SetMetadata(ctx, "imgproxy.processing_options", po)
+
+	err = security.VerifySourceURL(imageURL)
+	checkErr(ctx, "security", err)
+
+	if queueSem != nil {
+		acquired := queueSem.TryAcquire(1)
+		if !acquired {
+			panic(newTooManyRequestsError())
+		}
+		defer queueSem.Release(1)
+	}
+
+	func() {
+		defer metrics.StartQueueSegment(ctx)()
+
+		err = processingSem.Acquire(ctx, 1)
+		if err != nil {
+			checkErr(ctx, "queue", router.CheckTimeout(ctx))
+			sendErrAndPanic(ctx, "queue", err)
+		}
+	}()
+	defer processingSem.Release(1)
+
+	stats.IncImagesInProgress()
+	defer stats.DecImagesInProgress()
+
+	masterData, err := func() (*imagedata.ImageData, error) {
+		defer metrics.StartDownloadingSegment(ctx)()
+		return downloadMasterOrOriginal(ctx, imageURL, po)
+	}()
+	checkErr(ctx, "download", err)
+	defer masterData.Close()
+
+	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
+
+	swatches, err := func() ([]palette.Swatch, error) {
+		defer metrics.StartProcessingSegment(ctx)()
+		return processing.ExtractPalette(ctx, masterData, po, colors)
+	}()
+	checkErr(ctx, "processing", err)
+
+	setCacheControl(rw, po, http.StatusOK, masterData.Headers)
+	setLastModified(rw, masterData.Headers)
+	setCacheTags(rw, po, imageURL, masterData.Headers)
+
+	writeJSON(rw, http.StatusOK, newPaletteResponse(swatches))
+
+	router.LogResponse(reqID, r, http.StatusOK, nil)
+}
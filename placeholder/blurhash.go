@@ -0,0 +1,119 @@
+package placeholder
+
+import (
+	"math"
+	"strings"
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+func encodeBase83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		sb.WriteByte(base83Chars[digit])
+	}
+}
+
+func srgbToLinear(v byte) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// BlurHash encodes 8-bit RGB pixels to a BlurHash string with xComponents
+// by yComponents DCT components. Components should be in the [1, 9] range
+func BlurHash(pixels []byte, width, height, xComponents, yComponents int) string {
+	if width <= 0 || height <= 0 || len(pixels) < width*height*3 {
+		return ""
+	}
+
+	xComponents = max(1, min(9, xComponents))
+	yComponents = max(1, min(9, yComponents))
+
+	linear := make([][3]float64, width*height)
+	for i := range linear {
+		for c := 0; c < 3; c++ {
+			linear[i][c] = srgbToLinear(pixels[i*3+c])
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var f [3]float64
+
+			for y := 0; y < height; y++ {
+				cy := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) * cy
+
+					for c := 0; c < 3; c++ {
+						f[c] += basis * linear[y*width+x][c]
+					}
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			for c := 0; c < 3; c++ {
+				f[c] *= scale
+			}
+
+			factors = append(factors, f)
+		}
+	}
+
+	var sb strings.Builder
+
+	encodeBase83(&sb, (xComponents-1)+(yComponents-1)*9, 1)
+
+	maxValue := 1.0
+
+	if ac := factors[1:]; len(ac) > 0 {
+		var actualMax float64
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+
+		quantisedMax := max(0, min(82, int(math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+
+		encodeBase83(&sb, quantisedMax, 1)
+	} else {
+		encodeBase83(&sb, 0, 1)
+	}
+
+	dc := factors[0]
+	encodeBase83(&sb, linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+
+	for _, f := range factors[1:] {
+		var q [3]int
+		for c := 0; c < 3; c++ {
+			q[c] = max(0, min(18, int(math.Floor(signPow(f[c]/maxValue, 0.5)*9+9.5))))
+		}
+
+		encodeBase83(&sb, q[0]*19*19+q[1]*19+q[2], 2)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,59 @@
+package placeholder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func solidImage(width, height int, r, g, b byte) []byte {
+	img := make([]byte, 0, width*height*3)
+	for i := 0; i < width*height; i++ {
+		img = append(img, r, g, b)
+	}
+	return img
+}
+
+func gradientImage(width, height int) []byte {
+	img := make([]byte, 0, width*height*3)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img = append(img, byte(x*255/width), byte(y*255/height), 128)
+		}
+	}
+	return img
+}
+
+func TestBlurHashSolid(t *testing.T) {
+	hash := BlurHash(solidImage(32, 24, 255, 0, 0), 32, 24, 4, 3)
+
+	require.Len(t, hash, 4+2*4*3)
+	// Size flag of 4x3 components
+	require.Equal(t, "L", hash[:1])
+	// Pure red DC
+	require.Equal(t, "TI:j", hash[2:6])
+}
+
+func TestBlurHashGradient(t *testing.T) {
+	hash := BlurHash(gradientImage(32, 24), 32, 24, 4, 3)
+
+	require.Len(t, hash, 4+2*4*3)
+	require.NotEqual(t, BlurHash(solidImage(32, 24, 128, 128, 128), 32, 24, 4, 3), hash)
+}
+
+func TestBlurHashInvalid(t *testing.T) {
+	require.Empty(t, BlurHash(nil, 32, 24, 4, 3))
+}
+
+func TestThumbHash(t *testing.T) {
+	// 5 header bytes and 37 AC nibbles of a square image
+	require.Len(t, ThumbHash(gradientImage(32, 32), 32, 32), 24)
+
+	// Luminance DC is stored in the lowest 6 bits
+	require.Equal(t, byte(0), ThumbHash(solidImage(32, 32, 0, 0, 0), 32, 32)[0]&63)
+	require.Equal(t, byte(63), ThumbHash(solidImage(32, 32, 255, 255, 255), 32, 32)[0]&63)
+}
+
+func TestThumbHashTooLarge(t *testing.T) {
+	require.Nil(t, ThumbHash(solidImage(128, 32, 0, 0, 0), 128, 32))
+}
@@ -0,0 +1,121 @@
+package placeholder
+
+import "math"
+
+// ThumbHash images should not be larger than this
+const ThumbHashMaxSize = 100
+
+// thumbHashChannel holds the DCT of a single channel
+type thumbHashChannel struct {
+	dc    float64
+	ac    []float64
+	scale float64
+}
+
+func encodeThumbHashChannel(channel []float64, width, height, nx, ny int) thumbHashChannel {
+	var ch thumbHashChannel
+
+	fx := make([]float64, width)
+
+	for cy := 0; cy < ny; cy++ {
+		for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+			for x := 0; x < width; x++ {
+				fx[x] = math.Cos(math.Pi / float64(width) * float64(cx) * (float64(x) + 0.5))
+			}
+
+			var f float64
+
+			for y := 0; y < height; y++ {
+				fy := math.Cos(math.Pi / float64(height) * float64(cy) * (float64(y) + 0.5))
+				for x := 0; x < width; x++ {
+					f += channel[x+y*width] * fx[x] * fy
+				}
+			}
+
+			f /= float64(width * height)
+
+			if cx > 0 || cy > 0 {
+				ch.ac = append(ch.ac, f)
+				ch.scale = math.Max(ch.scale, math.Abs(f))
+			} else {
+				ch.dc = f
+			}
+		}
+	}
+
+	if ch.scale > 0 {
+		for i := range ch.ac {
+			ch.ac[i] = 0.5 + 0.5/ch.scale*ch.ac[i]
+		}
+	}
+
+	return ch
+}
+
+// ThumbHash encodes 8-bit RGB pixels to a ThumbHash. The image should not be
+// larger than ThumbHashMaxSize in both dimensions. Alpha is not supported
+func ThumbHash(pixels []byte, width, height int) []byte {
+	if width <= 0 || height <= 0 || width > ThumbHashMaxSize || height > ThumbHashMaxSize || len(pixels) < width*height*3 {
+		return nil
+	}
+
+	// Luminance and the yellow-blue and red-green chroma channels
+	l := make([]float64, width*height)
+	p := make([]float64, width*height)
+	q := make([]float64, width*height)
+
+	for i := range l {
+		r := float64(pixels[i*3]) / 255
+		g := float64(pixels[i*3+1]) / 255
+		b := float64(pixels[i*3+2]) / 255
+
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+	}
+
+	const lLimit = 7
+
+	maxSize := float64(max(width, height))
+	lx := max(1, int(math.Round(lLimit*float64(width)/maxSize)))
+	ly := max(1, int(math.Round(lLimit*float64(height)/maxSize)))
+
+	lch := encodeThumbHashChannel(l, width, height, max(3, lx), max(3, ly))
+	pch := encodeThumbHashChannel(p, width, height, 3, 3)
+	qch := encodeThumbHashChannel(q, width, height, 3, 3)
+
+	isLandscape := width > height
+
+	header24 := int(math.Round(63*lch.dc)) |
+		int(math.Round(31.5+31.5*pch.dc))<<6 |
+		int(math.Round(31.5+31.5*qch.dc))<<12 |
+		int(math.Round(31*lch.scale))<<18
+
+	header16 := int(math.Round(63*pch.scale))<<3 | int(math.Round(63*qch.scale))<<9
+	if isLandscape {
+		header16 |= ly | 1<<15
+	} else {
+		header16 |= lx
+	}
+
+	hash := []byte{
+		byte(header24), byte(header24 >> 8), byte(header24 >> 16),
+		byte(header16), byte(header16 >> 8),
+	}
+
+	// AC components are packed as nibbles
+	const acStart = 5
+	acIndex := 0
+
+	for _, ac := range [][]float64{lch.ac, pch.ac, qch.ac} {
+		for _, f := range ac {
+			if acIndex%2 == 0 {
+				hash = append(hash, 0)
+			}
+			hash[acStart+acIndex/2] |= byte(int(math.Round(15*f)) << ((acIndex & 1) << 2))
+			acIndex++
+		}
+	}
+
+	return hash
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/diskcache"
+	"github.com/imgproxy/imgproxy/v3/errorreport"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/metrics"
+	"github.com/imgproxy/imgproxy/v3/metrics/stats"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+// S3 limits the user-defined metadata to 2KB, so larger previews are not stored in it
+const maxPlaceholderMetadataSize = 1024
+
+// Placeholders are WebP unless AVIF is requested
+var placeholderFormats = []imagetype.Type{imagetype.WEBP, imagetype.AVIF}
+
+type placeholderResponse struct {
+	BlurHash  string `json:"blurhash"`
+	ThumbHash string `json:"thumbhash"`
+	// LQIP is the preview image as a data URI
+	LQIP   string `json:"lqip"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func placeholderCacheKey(imageURL string, format imagetype.Type) string {
+	return masterCacheKey(masterObjectURI(imageURL, 0)) + "#placeholder." + format.String()
+}
+
+func placeholderRequestedFormat(po *options.ProcessingOptions) imagetype.Type {
+	if po.Format == imagetype.AVIF {
+		return imagetype.AVIF
+	}
+	return imagetype.WEBP
+}
+
+// placeholderOptions builds the options of the placeholder render.
+// The image is fit into IMGPROXY_PLACEHOLDER_SIZE, only the format and presets are taken
+// from the query and the request headers are ignored, so the render depends on nothing
+// but the placeholder cache key and the presets
+func placeholderOptions(path string, qs url.Values) (*options.ProcessingOptions, string, error) {
+	pqs := url.Values{"fit": {"1"}}
+	for _, k := range []string{"fmt", "pr"} {
+		if v, ok := qs[k]; ok {
+			pqs[k] = v
+		}
+	}
+
+	po, imageURL, err := options.ParsePathIPC(
+		fmt.Sprintf("%dx%d/%s", config.PlaceholderSize, config.PlaceholderSize, path), pqs, nil,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	po.Watermark.Enabled = false
+	po.Quality = config.PlaceholderQuality
+
+	return po, imageURL, nil
+}
+
+// placeholderCacheable reports whether the placeholder can be stored in the disk cache.
+// Placeholders with presets are rendered on every request since their cache entries
+// couldn't be dropped when the master is replaced
+func placeholderCacheable(po *options.ProcessingOptions) bool {
+	return len(po.UsedPresets) == 0
+}
+
+// placeholderMetadataHeader builds the S3 metadata headers of the master with the placeholder
+func placeholderMetadataHeader(data *imagedata.ImageData) http.Header {
+	header := http.Header{
+		"X-Amz-Meta-Blurhash":  {data.Headers[processing.PlaceholderBlurHashHeader]},
+		"X-Amz-Meta-Thumbhash": {data.Headers[processing.PlaceholderThumbHashHeader]},
+	}
+
+	if lqip := base64.StdEncoding.EncodeToString(data.Data); len(lqip) <= maxPlaceholderMetadataSize {
+		header.Set("X-Amz-Meta-Lqip", lqip)
+	}
+
+	return header
+}
+
+// createMasterPlaceholder renders the placeholder of the new master from its smallest pyramid level.
+// Placeholders are optional, so errors are only logged
+func createMasterPlaceholder(ctx context.Context, imageURL string, masterData *imagedata.ImageData, levels map[int]*imagedata.ImageData) *imagedata.ImageData {
+	if !config.PlaceholderMasterMetadata {
+		return nil
+	}
+
+	po, _, err := placeholderOptions(imageURL, nil)
+	if err != nil {
+		log.Warningf("Can't create placeholder of %s: %s", imageURL, err)
+		return nil
+	}
+
+	src := masterData
+	for _, l := range config.MasterPyramidLevels {
+		if data, ok := levels[l]; ok {
+			src = data
+			break
+		}
+	}
+
+	data, err := processing.ProcessPlaceholder(ctx, src, po)
+	if err != nil {
+		log.Warningf("Can't create placeholder of %s: %s", imageURL, err)
+		return nil
+	}
+
+	return data
+}
+
+// cachePlaceholder stores the placeholder in the disk cache along with the master headers
+func cachePlaceholder(key string, data *imagedata.ImageData, masterHeaders map[string]string) {
+	for _, h := range []string{"ETag", "Last-Modified"} {
+		if v, ok := masterHeaders[h]; ok {
+			data.Headers[h] = v
+		}
+	}
+
+	diskcache.Set(key, data)
+}
+
+func renderPlaceholder(ctx context.Context, imageURL string, po *options.ProcessingOptions) *imagedata.ImageData {
+	if queueSem != nil {
+		acquired := queueSem.TryAcquire(1)
+		if !acquired {
+			panic(newTooManyRequestsError())
+		}
+		defer queueSem.Release(1)
+	}
+
+	func() {
+		defer metrics.StartQueueSegment(ctx)()
+
+		err := processingSem.Acquire(ctx, 1)
+		if err != nil {
+			checkErr(ctx, "queue", router.CheckTimeout(ctx))
+			sendErrAndPanic(ctx, "queue", err)
+		}
+	}()
+	defer processingSem.Release(1)
+
+	stats.IncImagesInProgress()
+	defer stats.DecImagesInProgress()
+
+	masterData, err := func() (*imagedata.ImageData, error) {
+		defer metrics.StartDownloadingSegment(ctx)()
+		return downloadMasterOrOriginal(ctx, imageURL, po)
+	}()
+	checkErr(ctx, "download", err)
+	defer masterData.Close()
+
+	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
+
+	data, err := func() (*imagedata.ImageData, error) {
+		defer metrics.StartProcessingSegment(ctx)()
+		return processing.ProcessPlaceholder(ctx, masterData, po)
+	}()
+	checkErr(ctx, "processing", err)
+
+	if placeholderCacheable(po) {
+		cachePlaceholder(placeholderCacheKey(imageURL, placeholderRequestedFormat(po)), data, masterData.Headers)
+	}
+
+	return data
+}
+
+// GET /placeholder/{path}[?fmt=avif][&pr=preset]
+func handlePlaceholder(reqID string, rw http.ResponseWriter, r *http.Request) {
+	stats.IncRequestsInProgress()
+	defer stats.DecRequestsInProgress()
+
+	ctx := r.Context()
+
+	path := strings.TrimPrefix(r.URL.Path, config.PathPrefix+"/placeholder/")
+
+	po, imageURL, err := placeholderOptions(path, r.URL.Query())
+	checkErr(ctx, "path_parsing", err)
+
+	errorreport.SetMetadata(r, "Source Image URL", imageURL)
+	errorreport.SetMetadata(r, "Processing Options", po)
+
+	metrics.SetMetadata(ctx, "imgproxy.source_image_url", imageURL)
+	metrics.SetMetadata(ctx, "imgproxy.processing_options", po)
+
+	err = security.VerifySourceURL(imageURL)
+	checkErr(ctx, "security", err)
+
+	var (
+		data *imagedata.ImageData
+		ok   bool
+	)
+	if placeholderCacheable(po) {
+		data, ok = diskcache.Get(placeholderCacheKey(imageURL, placeholderRequestedFormat(po)), "cached placeholder", po.SecurityOptions)
+	}
+	if !ok {
+		data = renderPlaceholder(ctx, imageURL, po)
+	}
+	defer data.Close()
+
+	resp := placeholderResponse{
+		BlurHash:  data.Headers[processing.PlaceholderBlurHashHeader],
+		ThumbHash: data.Headers[processing.PlaceholderThumbHashHeader],
+		LQIP:      "data:" + data.Type.Mime() + ";base64," + base64.StdEncoding.EncodeToString(data.Data),
+	}
+	resp.Width, _ = strconv.Atoi(data.Headers["X-Result-Width"])
+	resp.Height, _ = strconv.Atoi(data.Headers["X-Result-Height"])
+
+	setCacheControl(rw, po, http.StatusOK, data.Headers)
+	setLastModified(rw, data.Headers)
+	setCacheTags(rw, po, imageURL, data.Headers)
+
+	writeJSON(rw, http.StatusOK, resp)
+
+	router.LogResponse(reqID, r, http.StatusOK, nil)
+}
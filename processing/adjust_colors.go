@@ -0,0 +1,55 @@
+package processing
+
+import (
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+func adjustColors(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	ca := &po.ColorAdjust
+
+	if !ca.Enabled() {
+		return nil
+	}
+
+	if err := img.RgbColourspace(); err != nil {
+		return err
+	}
+
+	// Levels are stretched first, so the other adjustments work on the full range
+	if ca.AutoLevel {
+		if err := img.CopyMemory(); err != nil {
+			return err
+		}
+
+		if err := img.AutoLevel(); err != nil {
+			return err
+		}
+	}
+
+	if ca.Brightness != 0 || ca.Contrast != 1 || ca.Gamma != 1 {
+		if err := img.AdjustTone(ca.Brightness, ca.Contrast, ca.Gamma); err != nil {
+			return err
+		}
+	}
+
+	saturation := ca.Saturation
+	if ca.Grayscale {
+		saturation = 0
+	}
+
+	if saturation != 1 {
+		if err := img.AdjustSaturation(saturation); err != nil {
+			return err
+		}
+	}
+
+	if ca.Duotone.Enabled {
+		if err := img.Duotone(ca.Duotone.Shadow, ca.Duotone.Highlight, ca.Duotone.Intensity); err != nil {
+			return err
+		}
+	}
+
+	return img.CopyMemory()
+}
@@ -0,0 +1,171 @@
+package processing
+
+import (
+	"math"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/security"
+	"github.com/imgproxy/imgproxy/v3/similarity"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// Browsers slow down frames with too short delays,
+// so speeding up doesn't make delays shorter than this
+const minFrameDelay = 20
+
+// selectAnimationFrames returns the indexes of the frames to keep and their delays.
+// A kept frame is shown for the whole duration of the frames skipped after it
+func selectAnimationFrames(delay []int, opts options.AnimationOptions) ([]int, []int) {
+	frames := make([]int, 0, len(delay)/opts.Stride+1)
+	delays := make([]int, 0, cap(frames))
+
+	duration := 0
+
+	for i := 0; i < len(delay); i += opts.Stride {
+		d := 0
+		for _, fd := range delay[i:imath.Min(i+opts.Stride, len(delay))] {
+			d += fd
+		}
+
+		if opts.Speed != 1 {
+			d = imath.Max(int(math.Round(float64(d)/opts.Speed)), minFrameDelay)
+		}
+
+		if opts.MaxDuration > 0 && duration+d > opts.MaxDuration && len(frames) > 0 {
+			break
+		}
+
+		frames = append(frames, i)
+		delays = append(delays, d)
+		duration += d
+	}
+
+	return frames, delays
+}
+
+// dropAnimationFrames drops every other frame of the animation. Delays of
+// the dropped frames are added to the kept ones, so the duration stays the same.
+// It returns false if the animation has too few frames to drop
+func dropAnimationFrames(img *vips.Image) (bool, error) {
+	frameHeight, err := img.GetInt("page-height")
+	if err != nil {
+		return false, err
+	}
+
+	framesCount := img.Height() / frameHeight
+	if framesCount < 3 {
+		return false, nil
+	}
+
+	delay, err := img.GetIntSliceDefault("delay", nil)
+	if err != nil {
+		return false, err
+	}
+
+	if len(delay) > framesCount {
+		delay = delay[:framesCount]
+	}
+	// Frames without delays are shown for 40ms
+	for len(delay) < framesCount {
+		delay = append(delay, 40)
+	}
+
+	loop, err := img.GetIntDefault("loop", 0)
+	if err != nil {
+		return false, err
+	}
+
+	selected, delay := selectAnimationFrames(delay, options.AnimationOptions{Stride: 2, Speed: 1})
+
+	frames := make([]*vips.Image, 0, len(selected))
+	defer func() {
+		for _, frame := range frames {
+			frame.Clear()
+		}
+	}()
+
+	for _, i := range selected {
+		frame := new(vips.Image)
+
+		if err = img.Extract(frame, 0, i*frameHeight, img.Width(), frameHeight); err != nil {
+			return false, err
+		}
+
+		frames = append(frames, frame)
+	}
+
+	if err = img.Arrayjoin(frames); err != nil {
+		return false, err
+	}
+
+	img.SetInt("imgproxy-is-animated", 1)
+	img.SetInt("page-height", frameHeight)
+	img.SetIntSlice("delay", delay)
+	img.SetInt("loop", loop)
+	img.SetInt("n-pages", len(frames))
+
+	return true, nil
+}
+
+// bestAnimationFrame returns the index of the most representative frame
+func bestAnimationFrame(img *vips.Image, frameHeight, framesCount int) (int, error) {
+	pixels, err := img.Pixels(true)
+	if err != nil {
+		return 0, err
+	}
+
+	frameSize := img.Width() * frameHeight
+
+	frames := make([][]byte, framesCount)
+	for i := range frames {
+		frames[i] = pixels[i*frameSize : (i+1)*frameSize]
+	}
+
+	return similarity.MostRepresentativeFrame(frames), nil
+}
+
+// extractPosterFrame replaces the animation with a single frame of it
+func extractPosterFrame(img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	framesCount := imath.Min(img.Pages(), po.SecurityOptions.MaxAnimationFrames)
+
+	frameHeight, err := img.GetInt("page-height")
+	if err != nil {
+		return err
+	}
+
+	if err = security.CheckDimensions(img.Width(), frameHeight, framesCount, po.SecurityOptions); err != nil {
+		return err
+	}
+
+	if img.Pages() > framesCount {
+		// Load only the frames we can choose from
+		if err = img.Load(imgdata, 1, 1.0, framesCount); err != nil {
+			return err
+		}
+	}
+
+	index := imath.Min(po.Animation.Frame, framesCount-1)
+
+	if po.Animation.Frame == options.BestFrame {
+		if index, err = bestAnimationFrame(img, frameHeight, framesCount); err != nil {
+			return err
+		}
+	}
+
+	frame := new(vips.Image)
+	defer frame.Clear()
+
+	if err = img.Extract(frame, 0, index*frameHeight, img.Width(), frameHeight); err != nil {
+		return err
+	}
+
+	img.Swap(frame)
+
+	// The frame is not an animation anymore
+	img.SetInt("n-pages", 1)
+	img.SetInt("page-height", frameHeight)
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package processing
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// CollageLayout describes the grid of a collage
+type CollageLayout struct {
+	Width   int
+	Height  int
+	Columns int
+	Rows    int
+	// Gutter between the cells in pixels
+	Gutter int
+	// Background fills the gutters, the empty cells, and the transparent parts of the cells
+	Background vips.Color
+}
+
+// CellSize returns the size of a grid cell. If the collage size is not divisible
+// evenly, the grid is centered and the rest is filled with the background
+func (l CollageLayout) CellSize() (int, int) {
+	return (l.Width - l.Gutter*(l.Columns-1)) / l.Columns,
+		(l.Height - l.Gutter*(l.Rows-1)) / l.Rows
+}
+
+// collageFormat chooses the collage format when it's not set explicitly.
+// Collages are flattened, so they never need alpha
+func collageFormat(po *options.ProcessingOptions) imagetype.Type {
+	switch {
+	case po.Format != imagetype.Unknown:
+		return po.Format
+	case po.PreferAvif && vips.SupportsSave(imagetype.AVIF):
+		return imagetype.AVIF
+	case po.PreferWebP && vips.SupportsSave(imagetype.WEBP):
+		return imagetype.WEBP
+	default:
+		return imagetype.JPEG
+	}
+}
+
+// ProcessCollage renders every cell with its own processing options and joins
+// the cells into a grid. po sets the output format, quality, and watermark
+func ProcessCollage(ctx context.Context, cells []*imagedata.ImageData, cellsPO []*options.ProcessingOptions, po *options.ProcessingOptions, layout CollageLayout) (*imagedata.ImageData, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	cellWidth, cellHeight := layout.CellSize()
+
+	images := make([]*vips.Image, 0, len(cells))
+	defer func() {
+		for _, img := range images {
+			img.Clear()
+		}
+	}()
+
+	for i, imgdata := range cells {
+		img, err := renderFrame(ctx, imgdata, cellsPO[i], cellWidth, cellHeight)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, img)
+
+		// Gutters and empty cells should be transparent until the collage is flattened
+		if !img.HasAlpha() {
+			if err = img.AddAlpha(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = router.CheckTimeout(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	img := new(vips.Image)
+	defer img.Clear()
+
+	if err := img.ArrayjoinAcross(images, layout.Columns, layout.Gutter); err != nil {
+		return nil, err
+	}
+
+	if img.Width() != layout.Width || img.Height() != layout.Height {
+		offX := (layout.Width - img.Width()) / 2
+		offY := (layout.Height - img.Height()) / 2
+
+		if err := img.Embed(layout.Width, layout.Height, offX, offY); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := img.Flatten(layout.Background); err != nil {
+		return nil, err
+	}
+
+	po.Format = collageFormat(po)
+
+	if !vips.SupportsSave(po.Format) {
+		return nil, newSaveFormatError(po.Format)
+	}
+
+	if err := finalizePipeline.Run(ctx, img, po, nil); err != nil {
+		return nil, err
+	}
+
+	outData, err := img.Save(po.Format, po.GetQuality(), po.SaveOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if outData.Headers == nil {
+		outData.Headers = make(map[string]string)
+	}
+	outData.Headers["X-Result-Width"] = strconv.Itoa(img.Width())
+	outData.Headers["X-Result-Height"] = strconv.Itoa(img.Height())
+
+	return outData, nil
+}
@@ -9,7 +9,12 @@ import (
 )
 
 type (
-	SaveFormatError string
+	SaveFormatError     string
+	MaxBytesError       string
+	SpinResolutionError string
+	UnknownMaskError    string
+
+	UnknownMetadataPolicyError string
 )
 
 func newSaveFormatError(format imagetype.Type) error {
@@ -23,3 +28,51 @@ func newSaveFormatError(format imagetype.Type) error {
 }
 
 func (e SaveFormatError) Error() string { return string(e) }
+
+func newMaxBytesError(maxBytes int) error {
+	return ierrors.Wrap(
+		MaxBytesError(fmt.Sprintf("Can't fit the image into %d bytes", maxBytes)),
+		1,
+		ierrors.WithStatusCode(http.StatusUnprocessableEntity),
+		ierrors.WithPublicMessage("Can't fit the image into max_bytes"),
+		ierrors.WithShouldReport(false),
+	)
+}
+
+func (e MaxBytesError) Error() string { return string(e) }
+
+func newSpinResolutionError(width, height, framesCount int) error {
+	return ierrors.Wrap(
+		SpinResolutionError(fmt.Sprintf("Spin of %d frames of %dx%d exceeds the max resolution", framesCount, width, height)),
+		1,
+		ierrors.WithStatusCode(http.StatusUnprocessableEntity),
+		ierrors.WithPublicMessage("Spin resolution is too big"),
+		ierrors.WithShouldReport(false),
+	)
+}
+
+func (e SpinResolutionError) Error() string { return string(e) }
+
+func newUnknownMaskError(name string) error {
+	return ierrors.Wrap(
+		UnknownMaskError(fmt.Sprintf("Unknown mask image: %s", name)),
+		1,
+		ierrors.WithStatusCode(http.StatusUnprocessableEntity),
+		ierrors.WithPublicMessage("Invalid URL"),
+		ierrors.WithShouldReport(false),
+	)
+}
+
+func (e UnknownMaskError) Error() string { return string(e) }
+
+func newUnknownMetadataPolicyError(name string) error {
+	return ierrors.Wrap(
+		UnknownMetadataPolicyError(fmt.Sprintf("Unknown metadata policy: %s", name)),
+		1,
+		ierrors.WithStatusCode(http.StatusUnprocessableEntity),
+		ierrors.WithPublicMessage("Invalid URL"),
+		ierrors.WithShouldReport(false),
+	)
+}
+
+func (e UnknownMetadataPolicyError) Error() string { return string(e) }
@@ -32,9 +32,54 @@ func extendImage(img *vips.Image, resultWidth, resultHeight int, opts *options.E
 	}
 
 	offX, offY := calcPosition(resultWidth, resultHeight, img.Width(), img.Height(), &opts.Gravity, offsetScale, false)
+
+	if opts.Blur {
+		return embedBlurred(img, resultWidth, resultHeight, offX, offY, opts, offsetScale)
+	}
+
 	return img.Embed(resultWidth, resultHeight, offX, offY)
 }
 
+// embedBlurred places the image over a blurred and darkened copy of itself
+// that is scaled up to cover the result
+func embedBlurred(img *vips.Image, resultWidth, resultHeight, offX, offY int, opts *options.ExtendOptions, blurScale float64) error {
+	// Crop the center with the result aspect ratio first, so the copy can be
+	// resized to the exact result size
+	cropWidth, cropHeight := img.Width(), img.Height()
+	if float64(img.Width())/float64(img.Height()) > float64(resultWidth)/float64(resultHeight) {
+		cropWidth = imath.Max(imath.Scale(img.Height(), float64(resultWidth)/float64(resultHeight)), 1)
+	} else {
+		cropHeight = imath.Max(imath.Scale(img.Width(), float64(resultHeight)/float64(resultWidth)), 1)
+	}
+
+	bg := new(vips.Image)
+	defer bg.Clear()
+
+	if err := img.Extract(bg, (img.Width()-cropWidth)/2, (img.Height()-cropHeight)/2, cropWidth, cropHeight); err != nil {
+		return err
+	}
+
+	if err := bg.Resize(float64(resultWidth)/float64(cropWidth), float64(resultHeight)/float64(cropHeight)); err != nil {
+		return err
+	}
+
+	if err := bg.ApplyFilters(opts.BlurSigma*float32(blurScale), 0, 0); err != nil {
+		return err
+	}
+
+	if err := bg.Dim(opts.BlurBrightness); err != nil {
+		return err
+	}
+
+	if err := bg.ApplyWatermark(img, offX, offY, 1); err != nil {
+		return err
+	}
+
+	img.Swap(bg)
+
+	return nil
+}
+
 func extend(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
 	resultWidth, resultHeight := resultSize(po, pctx.dprScale)
 	return extendImage(img, resultWidth, resultHeight, &po.Extend, pctx.dprScale, false)
@@ -0,0 +1,49 @@
+package processing
+
+import (
+	"runtime"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// ImageInfo holds the image info that requires loading the image with libvips
+type ImageInfo struct {
+	Frames     int    `json:"frames"`
+	ColorSpace string `json:"color_space"`
+	HasAlpha   bool   `json:"has_alpha"`
+	HasICC     bool   `json:"icc"`
+	// Perceptual hashes as 16-digit hex strings
+	PHash string `json:"phash"`
+	DHash string `json:"dhash"`
+}
+
+// LoadImageInfo loads the image with libvips and calculates its perceptual hashes
+func LoadImageInfo(imgdata *imagedata.ImageData) (*ImageInfo, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	img := new(vips.Image)
+	defer img.Clear()
+
+	if err := img.Load(imgdata, 1, 1.0, 1); err != nil {
+		return nil, err
+	}
+
+	info := ImageInfo{
+		Frames:     img.Pages(),
+		ColorSpace: img.Interpretation(),
+		HasAlpha:   img.HasAlpha(),
+		HasICC:     img.HasColourProfile(),
+	}
+
+	hashes, err := imageHashes(img)
+	if err != nil {
+		return nil, err
+	}
+	info.PHash, info.DHash = hashes.Strings()
+
+	return &info, nil
+}
@@ -0,0 +1,90 @@
+package processing
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// shapeMaskSVG draws the shape mask of the image size
+func shapeMaskSVG(width, height int, opts *options.MaskOptions, radiusScale float64) []byte {
+	var shape string
+
+	switch opts.Type {
+	case options.MaskRound:
+		r := opts.Radius * radiusScale
+		if opts.Radius < 1 {
+			r = opts.Radius * float64(min(width, height))
+		}
+		r = math.Min(r, float64(min(width, height))/2)
+
+		shape = fmt.Sprintf(`<rect width="%d" height="%d" rx="%g" ry="%g"/>`, width, height, r, r)
+	case options.MaskCircle:
+		shape = fmt.Sprintf(
+			`<circle cx="%g" cy="%g" r="%g"/>`,
+			float64(width)/2, float64(height)/2, float64(min(width, height))/2,
+		)
+	default:
+		shape = fmt.Sprintf(
+			`<ellipse cx="%g" cy="%g" rx="%g" ry="%g"/>`,
+			float64(width)/2, float64(height)/2, float64(width)/2, float64(height)/2,
+		)
+	}
+
+	return []byte(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d"><g fill="#fff">%s</g></svg>`,
+		width, height, shape,
+	))
+}
+
+func loadMask(mask *vips.Image, width, height int, opts *options.MaskOptions, radiusScale float64) error {
+	var maskData *imagedata.ImageData
+
+	if opts.Type == options.MaskImage {
+		var ok bool
+		if maskData, ok = imagedata.MaskMap[opts.Image]; !ok {
+			return newUnknownMaskError(opts.Image)
+		}
+	} else {
+		maskData = &imagedata.ImageData{
+			Type: imagetype.SVG,
+			Data: shapeMaskSVG(width, height, opts, radiusScale),
+		}
+	}
+
+	if err := mask.Load(maskData, 1, 1.0, 1); err != nil {
+		return err
+	}
+
+	// Mask images are stretched to the image size
+	if mask.Width() != width || mask.Height() != height {
+		return mask.Resize(float64(width)/float64(mask.Width()), float64(height)/float64(mask.Height()))
+	}
+
+	return nil
+}
+
+// applyMask makes the image transparent outside the mask shape.
+// It goes after padding, so the padded area is masked as well
+func applyMask(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	if !po.Mask.Enabled() {
+		return nil
+	}
+
+	mask := new(vips.Image)
+	defer mask.Clear()
+
+	if err := loadMask(mask, img.Width(), img.Height(), &po.Mask, pctx.dprScale); err != nil {
+		return err
+	}
+
+	if err := img.RgbColourspace(); err != nil {
+		return err
+	}
+
+	return img.ApplyMask(mask)
+}
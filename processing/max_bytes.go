@@ -0,0 +1,231 @@
+package processing
+
+import (
+	"context"
+	"math"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+const (
+	// The image is never downscaled below this dimension to fit max_bytes
+	maxBytesMinDimension = 16
+	// Bounds of a single downscaling step
+	maxBytesMinDownscale = 0.5
+	maxBytesMaxDownscale = 0.9
+)
+
+// maxBytesFormats returns the formats the image may be saved to to fit max_bytes.
+// The current format goes first. Other formats are tried only if the format
+// wasn't requested explicitly and the client accepts them
+func maxBytesFormats(po *options.ProcessingOptions, img *vips.Image, formatAuto bool) []imagetype.Type {
+	formats := []imagetype.Type{po.Format}
+
+	if !formatAuto || !config.MaxBytesFormatFallback || img.IsAnimated() {
+		return formats
+	}
+
+	maxDim := max(img.Width(), img.Height())
+	minDim := min(img.Width(), img.Height())
+
+	candidates := []struct {
+		format imagetype.Type
+		ok     bool
+	}{
+		{imagetype.AVIF, po.PreferAvif && minDim >= 16 && maxDim <= heifMaxDimension},
+		{imagetype.WEBP, po.PreferWebP && maxDim <= webpMaxDimension},
+		{imagetype.JPEG, !img.HasAlpha()},
+	}
+
+	for _, c := range candidates {
+		if c.ok && c.format != po.Format && vips.SupportsSave(c.format) {
+			formats = append(formats, c.format)
+		}
+	}
+
+	return formats
+}
+
+// saveImageToFitBytesWithFormat binary-searches the highest quality that fits max_bytes.
+// If even the min quality doesn't fit, it returns the min quality result and false
+func saveImageToFitBytesWithFormat(
+	ctx context.Context, po *options.ProcessingOptions, img *vips.Image,
+	format imagetype.Type, quality int,
+) (*imagedata.ImageData, bool, error) {
+	imgdata, err := img.Save(format, quality, po.SaveOptions)
+	if err != nil || len(imgdata.Data) <= po.MaxBytes || quality <= config.MaxBytesMinQuality {
+		return imgdata, err == nil && len(imgdata.Data) <= po.MaxBytes, err
+	}
+	imgdata.Close()
+
+	if err = router.CheckTimeout(ctx); err != nil {
+		return nil, false, err
+	}
+
+	best, err := img.Save(format, config.MaxBytesMinQuality, po.SaveOptions)
+	if err != nil || len(best.Data) > po.MaxBytes {
+		return best, false, err
+	}
+
+	lo, hi := config.MaxBytesMinQuality+1, quality-1
+
+	for lo <= hi {
+		if err = router.CheckTimeout(ctx); err != nil {
+			best.Close()
+			return nil, false, err
+		}
+
+		mid := (lo + hi) / 2
+
+		imgdata, err = img.Save(format, mid, po.SaveOptions)
+		if err != nil {
+			best.Close()
+			return nil, false, err
+		}
+
+		if len(imgdata.Data) <= po.MaxBytes {
+			best.Close()
+			best = imgdata
+			lo = mid + 1
+		} else {
+			imgdata.Close()
+			hi = mid - 1
+		}
+	}
+
+	return best, true, nil
+}
+
+// saveImageToFitBytes saves the image so it fits max_bytes.
+// It lowers the quality first, then tries other formats, and if nothing fits,
+// downscales the image and tries again
+func saveImageToFitBytes(ctx context.Context, po *options.ProcessingOptions, img *vips.Image, quality int, formatAuto bool) (*imagedata.ImageData, error) {
+	if err := img.CopyMemory(); err != nil {
+		return nil, err
+	}
+
+	origFormat := po.Format
+	formats := maxBytesFormats(po, img, formatAuto)
+
+	for step := 0; ; step++ {
+		var (
+			smallest       *imagedata.ImageData
+			smallestFormat imagetype.Type
+		)
+
+		for _, format := range formats {
+			q := quality
+			if format != origFormat {
+				q = po.GetFormatQuality(format)
+			}
+
+			imgdata, fits, err := saveImageToFitBytesWithFormat(ctx, po, img, format, q)
+			if err != nil {
+				if smallest != nil {
+					smallest.Close()
+				}
+				return nil, err
+			}
+
+			if fits {
+				if smallest != nil {
+					smallest.Close()
+				}
+
+				if format != origFormat {
+					log.Debugf("Format is changed from %s to %s to fit max_bytes", origFormat, format)
+				}
+
+				po.Format = format
+				return imgdata, nil
+			}
+
+			if smallest == nil || len(imgdata.Data) < len(smallest.Data) {
+				if smallest != nil {
+					smallest.Close()
+				}
+				smallest, smallestFormat = imgdata, format
+			} else {
+				imgdata.Close()
+			}
+		}
+
+		if step >= config.MaxBytesMaxDownscales {
+			return maxBytesExceeded(po, smallest, smallestFormat)
+		}
+
+		if err := router.CheckTimeout(ctx); err != nil {
+			smallest.Close()
+			return nil, err
+		}
+
+		if img.IsAnimated() {
+			// Animation frames can't be resized separately here,
+			// so we drop every other frame instead
+			dropped, err := dropAnimationFrames(img)
+			if err != nil {
+				smallest.Close()
+				return nil, err
+			}
+
+			if !dropped {
+				return maxBytesExceeded(po, smallest, smallestFormat)
+			}
+
+			log.Debugf("Animation is reduced to %d frames to fit max_bytes", img.Pages())
+		} else {
+			// Quality alone can't meet the budget, so we step down the resolution.
+			// The file size is roughly proportional to the pixels count
+			scale := math.Sqrt(float64(po.MaxBytes) / float64(len(smallest.Data)))
+			scale = math.Max(maxBytesMinDownscale, math.Min(scale, maxBytesMaxDownscale))
+
+			if int(float64(min(img.Width(), img.Height()))*scale) < maxBytesMinDimension {
+				return maxBytesExceeded(po, smallest, smallestFormat)
+			}
+
+			if err := img.Resize(scale, scale); err != nil {
+				smallest.Close()
+				return nil, err
+			}
+
+			log.Debugf("Image is downscaled to %dx%d to fit max_bytes", img.Width(), img.Height())
+		}
+
+		smallest.Close()
+
+		if err := img.CopyMemory(); err != nil {
+			return nil, err
+		}
+
+		// The format that produced the smallest result is the most promising one
+		formats = []imagetype.Type{smallestFormat}
+	}
+}
+
+// maxBytesExceeded handles the result that doesn't fit max_bytes.
+// In the strict mode it's an error. Otherwise, the smallest result is returned
+// and marked with the X-Max-Bytes-Exceeded header
+func maxBytesExceeded(po *options.ProcessingOptions, smallest *imagedata.ImageData, format imagetype.Type) (*imagedata.ImageData, error) {
+	if po.MaxBytesStrict {
+		smallest.Close()
+		return nil, newMaxBytesError(po.MaxBytes)
+	}
+
+	log.Debugf("Can't fit the image into %d bytes, the smallest result is %d bytes", po.MaxBytes, len(smallest.Data))
+
+	if smallest.Headers == nil {
+		smallest.Headers = make(map[string]string)
+	}
+	smallest.Headers["X-Max-Bytes-Exceeded"] = "1"
+
+	po.Format = format
+
+	return smallest, nil
+}
@@ -0,0 +1,77 @@
+package processing
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/palette"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+const (
+	// Max side of the sample the palette is extracted from
+	paletteSampleSize = 64
+	// Number of colours the dominant one is chosen from
+	dominantColorPaletteSize = 5
+)
+
+// imagePalette extracts the palette of the image from its downscaled sRGB sample
+func imagePalette(img *vips.Image, colors int) ([]palette.Swatch, error) {
+	sample := new(vips.Image)
+	defer sample.Clear()
+
+	if err := img.Extract(sample, 0, 0, img.Width(), img.Height()); err != nil {
+		return nil, err
+	}
+
+	if side := max(sample.Width(), sample.Height()); side > paletteSampleSize {
+		scale := float64(paletteSampleSize) / float64(side)
+		if err := sample.Resize(scale, scale); err != nil {
+			return nil, err
+		}
+	}
+
+	pixels, err := sample.Pixels(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return palette.Extract(pixels, colors), nil
+}
+
+// autoBackground replaces the background with the dominant colour of the image
+func autoBackground(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	if !po.BackgroundAuto {
+		return nil
+	}
+
+	swatches, err := imagePalette(img, dominantColorPaletteSize)
+	if err != nil {
+		return err
+	}
+
+	if len(swatches) > 0 {
+		po.Background = vips.Color{R: swatches[0].R, G: swatches[0].G, B: swatches[0].B}
+	}
+
+	return nil
+}
+
+// ExtractPalette renders the image through the main pipeline and extracts its palette.
+// The first swatch is the dominant colour
+func ExtractPalette(ctx context.Context, imgdata *imagedata.ImageData, po *options.ProcessingOptions, colors int) ([]palette.Swatch, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	img, err := renderFrame(ctx, imgdata, po, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Clear()
+
+	return imagePalette(img, colors)
+}
@@ -0,0 +1,81 @@
+package processing
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/similarity"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// PerceptualHashes holds the perceptual hashes of an image
+type PerceptualHashes struct {
+	PHash uint64
+	DHash uint64
+}
+
+// Strings returns the hashes as 16-digit hex strings
+func (h PerceptualHashes) Strings() (string, string) {
+	return fmt.Sprintf("%016x", h.PHash), fmt.Sprintf("%016x", h.DHash)
+}
+
+// grayscaleSample downscales the image to exactly width x height ignoring the aspect ratio
+// and returns its grayscale pixels
+func grayscaleSample(img *vips.Image, width, height int) ([]byte, error) {
+	sample := new(vips.Image)
+	defer sample.Clear()
+
+	if err := img.Extract(sample, 0, 0, img.Width(), img.Height()); err != nil {
+		return nil, err
+	}
+
+	if err := sample.Resize(float64(width)/float64(img.Width()), float64(height)/float64(img.Height())); err != nil {
+		return nil, err
+	}
+
+	// Resizing may be off by a pixel
+	if sample.Width() != width || sample.Height() != height {
+		if err := sample.Embed(width, height, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return sample.Pixels(true)
+}
+
+// imageHashes calculates the perceptual hashes of the loaded image
+func imageHashes(img *vips.Image) (PerceptualHashes, error) {
+	var hashes PerceptualHashes
+
+	pixels, err := grayscaleSample(img, similarity.PHashSize, similarity.PHashSize)
+	if err != nil {
+		return hashes, err
+	}
+	hashes.PHash = similarity.PHash(pixels)
+
+	if pixels, err = grayscaleSample(img, similarity.DHashWidth, similarity.DHashHeight); err != nil {
+		return hashes, err
+	}
+	hashes.DHash = similarity.DHash(pixels)
+
+	return hashes, nil
+}
+
+// ImageHashes calculates the perceptual hashes of the image. The image is hashed as is,
+// without the EXIF orientation applied. Only the first frame of animations is hashed
+func ImageHashes(imgdata *imagedata.ImageData) (PerceptualHashes, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	img := new(vips.Image)
+	defer img.Clear()
+
+	if err := img.Load(imgdata, 1, 1.0, 1); err != nil {
+		return PerceptualHashes{}, err
+	}
+
+	return imageHashes(img)
+}
@@ -0,0 +1,82 @@
+package processing
+
+import (
+	"context"
+	"encoding/base64"
+	"runtime"
+	"strconv"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/placeholder"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// Headers of the placeholder image data that hold the hashes
+const (
+	PlaceholderBlurHashHeader  = "X-Placeholder-Blurhash"
+	PlaceholderThumbHashHeader = "X-Placeholder-Thumbhash"
+)
+
+// placeholderFormat chooses the placeholder format. Placeholders are WebP
+// unless AVIF is requested explicitly. AVIF can't encode images smaller than 16px
+func placeholderFormat(po *options.ProcessingOptions, width, height int) imagetype.Type {
+	if po.Format == imagetype.AVIF && vips.SupportsSave(imagetype.AVIF) && width >= 16 && height >= 16 {
+		return imagetype.AVIF
+	}
+
+	return imagetype.WEBP
+}
+
+// ProcessPlaceholder renders a tiny preview of the image through the main pipeline.
+// The preview is encoded to WebP or AVIF, its BlurHash and base64 ThumbHash
+// are stored in the headers of the result
+func ProcessPlaceholder(ctx context.Context, imgdata *imagedata.ImageData, po *options.ProcessingOptions) (*imagedata.ImageData, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	img, err := renderFrame(ctx, imgdata, po, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Clear()
+
+	pixels, err := img.Pixels(false)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := img.Width(), img.Height()
+
+	// 4x3 components are enough for a placeholder, more components are for the longer side
+	xComponents, yComponents := 4, 3
+	if height > width {
+		xComponents, yComponents = 3, 4
+	}
+
+	blurHash := placeholder.BlurHash(pixels, width, height, xComponents, yComponents)
+	thumbHash := placeholder.ThumbHash(pixels, width, height)
+
+	po.Format = placeholderFormat(po, width, height)
+
+	if err = finalizePipeline.Run(ctx, img, po, nil); err != nil {
+		return nil, err
+	}
+
+	outData, err := img.Save(po.Format, po.GetQuality(), po.SaveOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	outData.Headers = map[string]string{
+		"X-Result-Width":           strconv.Itoa(width),
+		"X-Result-Height":          strconv.Itoa(height),
+		PlaceholderBlurHashHeader:  blurHash,
+		PlaceholderThumbHashHeader: base64.StdEncoding.EncodeToString(thumbHash),
+	}
+
+	return outData, nil
+}
@@ -26,11 +26,15 @@ var mainPipeline = pipeline{
 	crop,
 	scale,
 	rotateAndFlip,
+	rotateAngle,
 	cropToResult,
 	applyFilters,
+	adjustColors,
+	autoBackground,
 	extend,
 	extendAspectRatio,
 	padding,
+	applyMask,
 	fixSize,
 	flatten,
 	watermark,
@@ -52,9 +56,52 @@ func isImageTypePreferred(imgtype imagetype.Type) bool {
 	return false
 }
 
-func findBestFormat(srcType imagetype.Type, animated, expectAlpha bool) imagetype.Type {
+// Formats that can store animations sorted by the typical result size
+var animatedFormats = []imagetype.Type{imagetype.AVIF, imagetype.WEBP, imagetype.GIF}
+
+// supportsAnimationSave checks if we can save an animation to the format.
+// Libvips writes the frames of AVIF as an image sequence only if it's built
+// with the sequences support, so animated AVIF should be enabled explicitly
+func supportsAnimationSave(t imagetype.Type) bool {
+	return t.SupportsAnimationSave() || (t == imagetype.AVIF && config.AvifAnimation)
+}
+
+// avifAnimationAllowed checks if the animation fits the animated AVIF limits.
+// Animated AVIF encoding is slow, so large animations are saved to other formats
+func avifAnimationAllowed(img *vips.Image) bool {
+	return img.Pages() <= config.AvifAnimationMaxFrames &&
+		(config.AvifAnimationMaxResolution == 0 ||
+			img.Width()*img.Height() <= config.AvifAnimationMaxResolution)
+}
+
+// findBestAnimatedFormat returns the smallest animated format the client accepts.
+// GIF is accepted by everyone, so it's the last resort
+func findBestAnimatedFormat(po *options.ProcessingOptions, allowAvif bool) imagetype.Type {
+	for _, t := range animatedFormats {
+		if !supportsAnimationSave(t) || !vips.SupportsSave(t) {
+			continue
+		}
+
+		switch t {
+		case imagetype.AVIF:
+			if !allowAvif || !(po.PreferAvif || po.EnforceAvif) {
+				continue
+			}
+		case imagetype.WEBP:
+			if !(po.PreferWebP || po.EnforceWebP || isImageTypePreferred(imagetype.WEBP)) {
+				continue
+			}
+		}
+
+		return t
+	}
+
+	return imagetype.GIF
+}
+
+func findBestFormat(srcType imagetype.Type, animated, expectAlpha, requireAlpha bool) imagetype.Type {
 	for _, t := range config.PreferredFormats {
-		if animated && !t.SupportsAnimationSave() {
+		if animated && !supportsAnimationSave(t) {
 			continue
 		}
 
@@ -65,6 +112,12 @@ func findBestFormat(srcType imagetype.Type, animated, expectAlpha bool) imagetyp
 		return t
 	}
 
+	// Masked images are transparent by design, they can't lose alpha
+	// even if none of the preferred formats supports it
+	if requireAlpha {
+		return imagetype.PNG
+	}
+
 	return config.PreferredFormats[0]
 }
 
@@ -129,16 +182,30 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 		return err
 	}
 
+	if len(delay) > framesCount {
+		delay = delay[:framesCount]
+	}
+	// Frames without delays are shown for 40ms
+	for len(delay) < framesCount {
+		delay = append(delay, 40)
+	}
+
 	loop, err := img.GetIntDefault("loop", 0)
 	if err != nil {
 		return err
 	}
 
+	if po.Animation.Loop >= 0 {
+		loop = po.Animation.Loop
+	}
+
+	selected, delay := selectAnimationFrames(delay, po.Animation)
+
 	watermarkEnabled := po.Watermark.Enabled
 	po.Watermark.Enabled = false
 	defer func() { po.Watermark.Enabled = watermarkEnabled }()
 
-	frames := make([]*vips.Image, 0, framesCount)
+	frames := make([]*vips.Image, 0, len(selected))
 	defer func() {
 		for _, frame := range frames {
 			if frame != nil {
@@ -147,7 +214,7 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 		}
 	}()
 
-	for i := 0; i < framesCount; i++ {
+	for _, i := range selected {
 		frame := new(vips.Image)
 
 		if err = img.Extract(frame, 0, i*frameHeight, imgWidth, frameHeight); err != nil {
@@ -181,7 +248,7 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 			dprScale = 1.0
 		}
 
-		if err = applyWatermark(img, imagedata.Watermark, &po.Watermark, dprScale, framesCount); err != nil {
+		if err = applyWatermark(img, imagedata.Watermark, &po.Watermark, dprScale, len(frames)); err != nil {
 			return err
 		}
 	}
@@ -190,15 +257,6 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 		return err
 	}
 
-	if len(delay) == 0 {
-		delay = make([]int, framesCount)
-		for i := range delay {
-			delay[i] = 40
-		}
-	} else if len(delay) > framesCount {
-		delay = delay[:framesCount]
-	}
-
 	img.SetInt("imgproxy-is-animated", 1)
 	img.SetInt("page-height", frames[0].Height())
 	img.SetIntSlice("delay", delay)
@@ -208,48 +266,18 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 	return nil
 }
 
-func saveImageToFitBytes(ctx context.Context, po *options.ProcessingOptions, img *vips.Image) (*imagedata.ImageData, error) {
-	var diff float64
-	quality := po.GetQuality()
-
-	if err := img.CopyMemory(); err != nil {
-		return nil, err
-	}
-
-	for {
-		imgdata, err := img.Save(po.Format, quality)
-		if err != nil || len(imgdata.Data) <= po.MaxBytes || quality <= 10 {
-			return imgdata, err
-		}
-		imgdata.Close()
-
-		if err := router.CheckTimeout(ctx); err != nil {
-			return nil, err
-		}
-
-		delta := float64(len(imgdata.Data)) / float64(po.MaxBytes)
-		switch {
-		case delta > 3:
-			diff = 0.25
-		case delta > 1.5:
-			diff = 0.5
-		default:
-			diff = 0.75
-		}
-		quality = int(float64(quality) * diff)
-	}
-}
-
 func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options.ProcessingOptions) (*imagedata.ImageData, error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
 	defer vips.Cleanup()
 
+	poster := po.Animation.Poster() && imgdata.Type.SupportsAnimationLoad()
+
 	animationSupport :=
 		po.SecurityOptions.MaxAnimationFrames > 1 &&
 			imgdata.Type.SupportsAnimationLoad() &&
-			(po.Format == imagetype.Unknown || po.Format.SupportsAnimationSave())
+			(poster || po.Format == imagetype.Unknown || supportsAnimationSave(po.Format))
 
 	pages := 1
 	if animationSupport {
@@ -275,26 +303,42 @@ func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options
 
 	originWidth, originHeight := getImageSize(img)
 
+	// Frames extracted from animations can't be scaled on load,
+	// so the pipeline shouldn't get the source data
+	pipelineData := imgdata
+
+	if poster && img.IsAnimated() {
+		if err := extractPosterFrame(img, po, imgdata); err != nil {
+			return nil, err
+		}
+		pipelineData = nil
+	}
+
 	animated := img.IsAnimated()
-	expectAlpha := !po.Flatten && (img.HasAlpha() || po.Padding.Enabled || po.Extend.Enabled)
+	// Format may be changed to fit max_bytes only if it wasn't requested explicitly
+	formatAuto := po.Format == imagetype.Unknown
+	requireAlpha := !po.Flatten && po.Mask.Enabled()
+	expectAlpha := requireAlpha || (!po.Flatten && (img.HasAlpha() || po.Padding.Enabled || po.Extend.Enabled || po.RotateAngle.Transparent()))
 
 	switch {
 	case po.Format == imagetype.Unknown:
 		switch {
-		case po.PreferAvif && !animated:
+		case animated:
+			po.Format = findBestAnimatedFormat(po, true)
+		case po.PreferAvif:
 			po.Format = imagetype.AVIF
 		case po.PreferJxl && !animated:
 			po.Format = imagetype.JXL
 		case po.PreferWebP:
 			po.Format = imagetype.WEBP
-		case isImageTypePreferred(imgdata.Type):
+		case isImageTypePreferred(imgdata.Type) && (!requireAlpha || imgdata.Type.SupportsAlpha()):
 			po.Format = imgdata.Type
 		default:
-			po.Format = findBestFormat(imgdata.Type, animated, expectAlpha)
+			po.Format = findBestFormat(imgdata.Type, animated, expectAlpha, requireAlpha)
 		}
 	case po.EnforceJxl && !animated:
 		po.Format = imagetype.JXL
-	case po.EnforceAvif && !animated:
+	case po.EnforceAvif && (!animated || supportsAnimationSave(imagetype.AVIF)):
 		po.Format = imagetype.AVIF
 	case po.EnforceWebP:
 		po.Format = imagetype.WEBP
@@ -304,10 +348,19 @@ func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options
 		return nil, newSaveFormatError(po.Format)
 	}
 
-	if po.Format.SupportsAnimationSave() && animated {
+	if supportsAnimationSave(po.Format) && animated {
 		if err := transformAnimated(ctx, img, po, imgdata); err != nil {
 			return nil, err
 		}
+
+		if po.Format == imagetype.AVIF && !avifAnimationAllowed(img) {
+			po.Format = findBestAnimatedFormat(po, false)
+
+			log.Debugf(
+				"Animation with %d frames of %dx%d exceeds the animated AVIF limits. Animation will be saved as %s",
+				img.Pages(), img.Width(), img.Height()/img.Pages(), po.Format,
+			)
+		}
 	} else {
 		if animated {
 			// We loaded animated image but the resulting format doesn't support
@@ -317,7 +370,7 @@ func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options
 			}
 		}
 
-		if err := mainPipeline.Run(ctx, img, po, imgdata); err != nil {
+		if err := mainPipeline.Run(ctx, img, po, pipelineData); err != nil {
 			return nil, err
 		}
 	}
@@ -327,7 +380,9 @@ func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options
 	}
 
 	if po.Format == imagetype.AVIF && (img.Width() < 16 || img.Height() < 16) {
-		if img.HasAlpha() {
+		if img.IsAnimated() {
+			po.Format = findBestAnimatedFormat(po, false)
+		} else if img.HasAlpha() {
 			po.Format = imagetype.PNG
 		} else {
 			po.Format = imagetype.JPEG
@@ -344,10 +399,20 @@ func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options
 		err     error
 	)
 
-	if po.MaxBytes > 0 && po.Format.SupportsQuality() {
-		outData, err = saveImageToFitBytes(ctx, po, img)
-	} else {
-		outData, err = img.Save(po.Format, po.GetQuality())
+	quality := po.GetQuality()
+
+	switch {
+	case po.TargetQuality.Enabled() && po.Format.SupportsQuality() && !po.SaveOptions.Lossless && !img.IsAnimated():
+		outData, quality, err = saveImageToTargetQuality(ctx, po, img)
+		// The target quality result doesn't fit the byte budget, so we sacrifice the quality
+		if err == nil && po.MaxBytes > 0 && len(outData.Data) > po.MaxBytes {
+			outData.Close()
+			outData, err = saveImageToFitBytes(ctx, po, img, quality, formatAuto)
+		}
+	case po.MaxBytes > 0 && po.Format.SupportsQuality():
+		outData, err = saveImageToFitBytes(ctx, po, img, quality, formatAuto)
+	default:
+		outData, err = img.Save(po.Format, quality, po.SaveOptions)
 	}
 
 	if err == nil {
@@ -0,0 +1,52 @@
+package processing
+
+import (
+	"math"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// rotateAngleScale calculates the scale of the rotated image that keeps its size.
+// With auto-crop, the largest rectangle without corners is scaled up to the size.
+// Otherwise, the rotated image is scaled down to fit the size
+func rotateAngleScale(width, height int, angle float64, autoCrop bool) float64 {
+	rad := angle * math.Pi / 180
+	cos := math.Abs(math.Cos(rad))
+	sin := math.Abs(math.Sin(rad))
+
+	w, h := float64(width), float64(height)
+
+	if autoCrop {
+		inscribed := math.Min(w/(w*cos+h*sin), h/(w*sin+h*cos))
+		// A pixel margin hides the antialiased edges
+		return (1 + 2/math.Min(w, h)) / inscribed
+	}
+
+	return math.Min(w/(w*cos+h*sin), h/(w*sin+h*cos))
+}
+
+// rotateAngle rotates the image by an arbitrary angle. The image size is kept,
+// so the rest of the pipeline isn't affected
+func rotateAngle(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	ro := &po.RotateAngle
+
+	if !ro.Enabled() {
+		return nil
+	}
+
+	width, height := img.Width(), img.Height()
+
+	if err := img.CopyMemory(); err != nil {
+		return err
+	}
+
+	if err := img.RgbColourspace(); err != nil {
+		return err
+	}
+
+	scale := rotateAngleScale(width, height, ro.Angle, ro.AutoCrop)
+
+	return img.RotateFree(ro.Angle, scale, width, height, ro.Background, !ro.AutoCrop && !ro.Fill)
+}
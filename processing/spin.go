@@ -0,0 +1,262 @@
+package processing
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"strconv"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// SpinOptions describe how the frames of a spin set are assembled
+type SpinOptions struct {
+	// Sprite makes a sprite sheet instead of an animation
+	Sprite bool
+	// Columns of the sprite sheet, 0 makes the sheet as square as possible
+	Columns int
+	// Delay between the animation frames in milliseconds
+	Delay int
+	// Loop count of the animation, 0 is infinite
+	Loop int
+}
+
+type SpriteFrame struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// SpriteMap describes the frames positions in the sprite sheet
+type SpriteMap struct {
+	Width       int           `json:"width"`
+	Height      int           `json:"height"`
+	FrameWidth  int           `json:"frame_width"`
+	FrameHeight int           `json:"frame_height"`
+	Columns     int           `json:"columns"`
+	Rows        int           `json:"rows"`
+	Frames      []SpriteFrame `json:"frames"`
+}
+
+func spriteColumns(framesCount, columns int) int {
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(framesCount))))
+	}
+
+	return min(columns, framesCount)
+}
+
+func newSpriteMap(frameWidth, frameHeight, framesCount, columns int) *SpriteMap {
+	columns = spriteColumns(framesCount, columns)
+	rows := (framesCount + columns - 1) / columns
+
+	m := SpriteMap{
+		Width:       frameWidth * columns,
+		Height:      frameHeight * rows,
+		FrameWidth:  frameWidth,
+		FrameHeight: frameHeight,
+		Columns:     columns,
+		Rows:        rows,
+		Frames:      make([]SpriteFrame, framesCount),
+	}
+
+	for i := range m.Frames {
+		m.Frames[i] = SpriteFrame{
+			X: (i % columns) * frameWidth,
+			Y: (i / columns) * frameHeight,
+		}
+	}
+
+	return &m
+}
+
+// renderFrame loads the image and runs the main pipeline on it.
+// If the size is set, the result is fit to it
+func renderFrame(ctx context.Context, imgdata *imagedata.ImageData, po *options.ProcessingOptions, width, height int) (*vips.Image, error) {
+	img := new(vips.Image)
+
+	err := func() error {
+		if err := img.Load(imgdata, 1, 1.0, 1); err != nil {
+			return err
+		}
+
+		if err := mainPipeline.Run(ctx, img, po, imgdata); err != nil {
+			return err
+		}
+
+		// Frames of a spin set or collage cells are expected to have the requested size,
+		// but we can't be sure
+		if width > 0 && (img.Width() != width || img.Height() != height) {
+			if err := img.Resize(float64(width)/float64(img.Width()), float64(height)/float64(img.Height())); err != nil {
+				return err
+			}
+
+			// Resizing may be off by a pixel
+			if err := img.Embed(width, height, 0, 0); err != nil {
+				return err
+			}
+		}
+
+		if err := img.CastUchar(); err != nil {
+			return err
+		}
+
+		return img.CopyMemory()
+	}()
+
+	if err != nil {
+		img.Clear()
+		return nil, err
+	}
+
+	return img, nil
+}
+
+func checkSpinResolution(width, height, framesCount int) error {
+	if config.SpinMaxResolution > 0 && width*height*framesCount > config.SpinMaxResolution {
+		return newSpinResolutionError(width, height, framesCount)
+	}
+
+	return nil
+}
+
+// spriteFormat chooses the sprite sheet format. Sprite sheets are large,
+// so WebP and AVIF are used only if they can store the sheet
+func spriteFormat(po *options.ProcessingOptions, width, height int, hasAlpha bool) imagetype.Type {
+	maxDim := max(width, height)
+
+	switch {
+	case po.Format != imagetype.Unknown:
+		return po.Format
+	case po.PreferAvif && maxDim <= heifMaxDimension:
+		return imagetype.AVIF
+	case po.PreferWebP && maxDim <= webpMaxDimension:
+		return imagetype.WEBP
+	case hasAlpha:
+		return imagetype.PNG
+	default:
+		return imagetype.JPEG
+	}
+}
+
+// SpinSpriteMap calculates the sprite sheet map using the first frame of the spin set.
+// It also checks the spin resolution, so it's cheap to call before the rest of the frames
+// are downloaded
+func SpinSpriteMap(ctx context.Context, first *imagedata.ImageData, framesCount int, po *options.ProcessingOptions, so SpinOptions) (*SpriteMap, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	img, err := renderFrame(ctx, first, po, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Clear()
+
+	if err := checkSpinResolution(img.Width(), img.Height(), framesCount); err != nil {
+		return nil, err
+	}
+
+	return newSpriteMap(img.Width(), img.Height(), framesCount, so.Columns), nil
+}
+
+// ProcessSpin resizes the frames of a spin set and assembles them
+// into an animation or a sprite sheet
+func ProcessSpin(ctx context.Context, frames []*imagedata.ImageData, po *options.ProcessingOptions, so SpinOptions) (*imagedata.ImageData, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	images := make([]*vips.Image, 0, len(frames))
+	defer func() {
+		for _, img := range images {
+			img.Clear()
+		}
+	}()
+
+	var width, height int
+
+	for _, imgdata := range frames {
+		img, err := renderFrame(ctx, imgdata, po, width, height)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, img)
+
+		if width == 0 {
+			width, height = img.Width(), img.Height()
+
+			if err = checkSpinResolution(width, height, len(frames)); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = router.CheckTimeout(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	hasAlpha := images[0].HasAlpha()
+
+	img := new(vips.Image)
+	defer img.Clear()
+
+	if so.Sprite {
+		if err := img.ArrayjoinAcross(images, spriteColumns(len(images), so.Columns), 0); err != nil {
+			return nil, err
+		}
+
+		po.Format = spriteFormat(po, img.Width(), img.Height(), hasAlpha)
+	} else {
+		if err := img.Arrayjoin(images); err != nil {
+			return nil, err
+		}
+
+		delay := make([]int, len(images))
+		for i := range delay {
+			delay[i] = so.Delay
+		}
+
+		img.SetInt("imgproxy-is-animated", 1)
+		img.SetInt("page-height", height)
+		img.SetIntSlice("delay", delay)
+		img.SetInt("loop", so.Loop)
+		img.SetInt("n-pages", len(images))
+
+		if !supportsAnimationSave(po.Format) {
+			po.Format = findBestAnimatedFormat(po, true)
+		}
+
+		if po.Format == imagetype.AVIF && !avifAnimationAllowed(img) {
+			po.Format = findBestAnimatedFormat(po, false)
+		}
+	}
+
+	if !vips.SupportsSave(po.Format) {
+		return nil, newSaveFormatError(po.Format)
+	}
+
+	if err := finalizePipeline.Run(ctx, img, po, nil); err != nil {
+		return nil, err
+	}
+
+	outData, err := img.Save(po.Format, po.GetQuality(), po.SaveOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if outData.Headers == nil {
+		outData.Headers = make(map[string]string)
+	}
+	outData.Headers["X-Result-Width"] = strconv.Itoa(img.Width())
+	outData.Headers["X-Result-Height"] = strconv.Itoa(img.Height())
+
+	return outData, nil
+}
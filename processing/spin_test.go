@@ -0,0 +1,65 @@
+package processing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSpriteMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		frames   int
+		columns  int
+		expected SpriteMap
+	}{
+		{
+			name:   "square",
+			frames: 4,
+			expected: SpriteMap{
+				Width: 20, Height: 10, FrameWidth: 10, FrameHeight: 5, Columns: 2, Rows: 2,
+				Frames: []SpriteFrame{{0, 0}, {10, 0}, {0, 5}, {10, 5}},
+			},
+		},
+		{
+			name:   "last row is not full",
+			frames: 5,
+			expected: SpriteMap{
+				Width: 30, Height: 10, FrameWidth: 10, FrameHeight: 5, Columns: 3, Rows: 2,
+				Frames: []SpriteFrame{{0, 0}, {10, 0}, {20, 0}, {0, 5}, {10, 5}},
+			},
+		},
+		{
+			name:    "explicit columns",
+			frames:  3,
+			columns: 1,
+			expected: SpriteMap{
+				Width: 10, Height: 15, FrameWidth: 10, FrameHeight: 5, Columns: 1, Rows: 3,
+				Frames: []SpriteFrame{{0, 0}, {0, 5}, {0, 10}},
+			},
+		},
+		{
+			name:    "more columns than frames",
+			frames:  2,
+			columns: 4,
+			expected: SpriteMap{
+				Width: 20, Height: 5, FrameWidth: 10, FrameHeight: 5, Columns: 2, Rows: 1,
+				Frames: []SpriteFrame{{0, 0}, {10, 0}},
+			},
+		},
+		{
+			name:   "single frame",
+			frames: 1,
+			expected: SpriteMap{
+				Width: 10, Height: 5, FrameWidth: 10, FrameHeight: 5, Columns: 1, Rows: 1,
+				Frames: []SpriteFrame{{0, 0}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, &tc.expected, newSpriteMap(10, 5, tc.frames, tc.columns))
+		})
+	}
+}
@@ -2,17 +2,46 @@ package processing
 
 import (
 	"bytes"
+	"strings"
 
 	"github.com/trimmer-io/go-xmp/xmp"
 
 	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/imagemeta/iptc"
 	"github.com/imgproxy/imgproxy/v3/imagemeta/photoshop"
 	"github.com/imgproxy/imgproxy/v3/options"
 	"github.com/imgproxy/imgproxy/v3/vips"
 )
 
-func stripPS3(img *vips.Image) []byte {
+// copyrightMetadataPolicy keeps the copyright fields of IPTC and XMP when `keep_copyright` is set
+var copyrightMetadataPolicy = &imagemeta.MetadataPolicy{
+	Iptc: []string{"Byline", "Credit", "CopyrightNotice"},
+	XMP:  []string{"dc:rights", "dc:contributor", "dc:creator", "dc:publisher", "xmpRights:*", "cc:*"},
+}
+
+// exifVipsFields converts the EXIF fields of the policy to the libvips field names.
+// libvips names EXIF fields as `exif-ifd{N}-{Name}`: IFD0 holds the image tags,
+// IFD2 holds the Exif sub-IFD tags, and IFD3 holds the GPS tags
+func exifVipsFields(policy *imagemeta.MetadataPolicy) []string {
+	if len(policy.Exif) == 0 {
+		return nil
+	}
+
+	fields := []string{"exif-data"}
+
+	for _, name := range policy.Exif {
+		if strings.HasPrefix(name, "GPS") {
+			fields = append(fields, "exif-ifd3-"+name)
+		} else {
+			fields = append(fields, "exif-ifd0-"+name, "exif-ifd2-"+name)
+		}
+	}
+
+	return fields
+}
+
+func stripPS3(img *vips.Image, policy *imagemeta.MetadataPolicy) []byte {
 	ps3Data, err := img.GetBlob("iptc-data")
 	if err != nil || len(ps3Data) == 0 {
 		return nil
@@ -32,11 +61,7 @@ func stripPS3(img *vips.Image) []byte {
 		return nil
 	}
 
-	for key := range iptcMap {
-		if key.RecordID == 2 && key.TagID != 80 && key.TagID != 110 && key.TagID != 116 {
-			delete(iptcMap, key)
-		}
-	}
+	policy.FilterIptc(iptcMap)
 
 	if len(iptcMap) == 0 {
 		return nil
@@ -49,7 +74,7 @@ func stripPS3(img *vips.Image) []byte {
 	return ps3Map.Dump()
 }
 
-func stripXMP(img *vips.Image) []byte {
+func stripXMP(img *vips.Image, policy *imagemeta.MetadataPolicy) []byte {
 	xmpData, err := img.GetBlob("xmp-data")
 	if err != nil || len(xmpData) == 0 {
 		return nil
@@ -60,39 +85,34 @@ func stripXMP(img *vips.Image) []byte {
 		return nil
 	}
 
-	namespaces := xmpDoc.Namespaces()
-	filteredNs := namespaces[:0]
+	var emptyNs []string
 
-	for _, ns := range namespaces {
-		if ns.Name == "dc" || ns.Name == "xmpRights" || ns.Name == "cc" {
-			filteredNs = append(filteredNs, ns)
-		}
-	}
-	xmpDoc.FilterNamespaces(filteredNs)
-
-	nodes := xmpDoc.Nodes()
-	for _, n := range nodes {
-		if n.Name() == "dc" {
-			filteredNodes := n.Nodes[:0]
-			for _, nn := range n.Nodes {
-				name := nn.Name()
-				if name == "rights" || name == "contributor" || name == "creator" || name == "publisher" {
-					filteredNodes = append(filteredNodes, nn)
-				}
+	for _, n := range xmpDoc.Nodes() {
+		filteredNodes := n.Nodes[:0]
+		for _, nn := range n.Nodes {
+			if policy.KeepXMP(nn.FullName()) {
+				filteredNodes = append(filteredNodes, nn)
 			}
-			n.Nodes = filteredNodes
-
-			filteredAttrs := n.Attr[:0]
-			for _, a := range n.Attr {
-				name := a.Name.Local
-				if name == "dc:rights" || name == "dc:contributor" || name == "dc:creator" || name == "dc:publisher" {
-					filteredAttrs = append(filteredAttrs, a)
-				}
+		}
+		n.Nodes = filteredNodes
+
+		filteredAttrs := n.Attr[:0]
+		for _, a := range n.Attr {
+			if policy.KeepXMP(a.Name.Local) {
+				filteredAttrs = append(filteredAttrs, a)
 			}
-			n.Attr = filteredAttrs
+		}
+		n.Attr = filteredAttrs
+
+		if len(n.Nodes) == 0 && len(n.Attr) == 0 {
+			emptyNs = append(emptyNs, n.Name())
 		}
 	}
 
+	for _, ns := range emptyNs {
+		xmpDoc.RemoveNamespaceByName(ns)
+	}
+
 	if len(xmpDoc.Nodes()) == 0 {
 		return nil
 	}
@@ -105,30 +125,44 @@ func stripXMP(img *vips.Image) []byte {
 	return xmpData
 }
 
+// stripMetadata removes the metadata. If the metadata policy is set, the fields
+// it allows are kept even if `strip_metadata` is disabled
 func stripMetadata(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
-	if !po.StripMetadata {
+	var policy *imagemeta.MetadataPolicy
+
+	switch {
+	case len(po.MetadataPolicy) > 0:
+		var ok bool
+		if policy, ok = imagemeta.GetMetadataPolicy(po.MetadataPolicy); !ok {
+			return newUnknownMetadataPolicyError(po.MetadataPolicy)
+		}
+	case !po.StripMetadata:
 		return nil
+	case po.KeepCopyright:
+		policy = copyrightMetadataPolicy
 	}
 
-	var ps3Data, xmpData []byte
-
-	if po.KeepCopyright {
-		ps3Data = stripPS3(img)
-		xmpData = stripXMP(img)
+	if policy == nil {
+		return img.Strip(false)
 	}
 
-	if err := img.Strip(po.KeepCopyright); err != nil {
+	ps3Data := stripPS3(img, policy)
+	xmpData := stripXMP(img, policy)
+
+	// The EXIF copyright is kept only for `keep_copyright`, a metadata policy
+	// has to list it explicitly
+	keepExifCopyright := policy == copyrightMetadataPolicy
+
+	if err := img.Strip(keepExifCopyright, exifVipsFields(policy)...); err != nil {
 		return err
 	}
 
-	if po.KeepCopyright {
-		if len(ps3Data) > 0 {
-			img.SetBlob("iptc-data", ps3Data)
-		}
+	if len(ps3Data) > 0 {
+		img.SetBlob("iptc-data", ps3Data)
+	}
 
-		if len(xmpData) > 0 {
-			img.SetBlob("xmp-data", xmpData)
-		}
+	if len(xmpData) > 0 {
+		img.SetBlob("xmp-data", xmpData)
 	}
 
 	return nil
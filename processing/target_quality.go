@@ -0,0 +1,107 @@
+package processing
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/similarity"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// encodedSSIM decodes the encoded image and compares it with the reference pixels
+func encodedSSIM(imgdata *imagedata.ImageData, ref []byte, width, height int) (float64, error) {
+	decoded := new(vips.Image)
+	defer decoded.Clear()
+
+	if err := decoded.Load(imgdata, 1, 1.0, 1); err != nil {
+		return 0, err
+	}
+
+	// The encoder didn't keep the size, so we can't compare the images.
+	// Consider them different
+	if decoded.Width() != width || decoded.Height() != height {
+		return 0, nil
+	}
+
+	pixels, err := decoded.Pixels(true)
+	if err != nil {
+		return 0, err
+	}
+
+	return similarity.SSIM(ref, pixels, width, height), nil
+}
+
+// saveImageToTargetQuality binary-searches the lowest quality that keeps
+// the SSIM of the result not less than the target one.
+// If none of the tried qualities is good enough, the image is saved with the max quality.
+// It returns the result and the quality it was saved with
+func saveImageToTargetQuality(ctx context.Context, po *options.ProcessingOptions, img *vips.Image) (*imagedata.ImageData, int, error) {
+	if err := img.CopyMemory(); err != nil {
+		return nil, 0, err
+	}
+
+	ref, err := img.Pixels(true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		best        *imagedata.ImageData
+		bestQuality int
+	)
+
+	lo, hi := po.TargetQuality.MinQuality, po.TargetQuality.MaxQuality
+
+	for i := 0; i < config.TargetQualityMaxIterations && lo <= hi; i++ {
+		if err := router.CheckTimeout(ctx); err != nil {
+			if best != nil {
+				best.Close()
+			}
+			return nil, 0, err
+		}
+
+		quality := (lo + hi) / 2
+
+		imgdata, err := img.Save(po.Format, quality, po.SaveOptions)
+		if err != nil {
+			if best != nil {
+				best.Close()
+			}
+			return nil, 0, err
+		}
+
+		ssim, err := encodedSSIM(imgdata, ref, img.Width(), img.Height())
+		if err != nil {
+			imgdata.Close()
+			if best != nil {
+				best.Close()
+			}
+			return nil, 0, err
+		}
+
+		log.Debugf("Target quality: quality %d, SSIM %f", quality, ssim)
+
+		if ssim >= po.TargetQuality.SSIM {
+			if best != nil {
+				best.Close()
+			}
+			best, bestQuality = imgdata, quality
+			hi = quality - 1
+		} else {
+			imgdata.Close()
+			lo = quality + 1
+		}
+	}
+
+	if best != nil {
+		return best, bestQuality, nil
+	}
+
+	imgdata, err := img.Save(po.Format, po.TargetQuality.MaxQuality, po.SaveOptions)
+	return imgdata, po.TargetQuality.MaxQuality, err
+}
@@ -4,27 +4,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"slices"
 	"strconv"
 	"strings"
-	"time"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/semaphore"
 
+	"github.com/imgproxy/imgproxy/v3/cachetags"
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/cookies"
+	"github.com/imgproxy/imgproxy/v3/derivatives"
+	"github.com/imgproxy/imgproxy/v3/diskcache"
 	"github.com/imgproxy/imgproxy/v3/errorreport"
 	"github.com/imgproxy/imgproxy/v3/etag"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
-	"github.com/imgproxy/imgproxy/v3/imath"
 	"github.com/imgproxy/imgproxy/v3/metrics"
 	"github.com/imgproxy/imgproxy/v3/metrics/stats"
 	"github.com/imgproxy/imgproxy/v3/options"
 	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/resultcache"
 	"github.com/imgproxy/imgproxy/v3/router"
 	"github.com/imgproxy/imgproxy/v3/security"
 	"github.com/imgproxy/imgproxy/v3/svg"
@@ -64,41 +67,6 @@ func initProcessingHandler() {
 	headerVaryValue = strings.Join(vary, ", ")
 }
 
-func setCacheControl(rw http.ResponseWriter, force *time.Time, originHeaders map[string]string) {
-	ttl := -1
-
-	if _, ok := originHeaders["Fallback-Image"]; ok && config.FallbackImageTTL > 0 {
-		ttl = config.FallbackImageTTL
-	}
-
-	if force != nil && (ttl < 0 || force.Before(time.Now().Add(time.Duration(ttl)*time.Second))) {
-		ttl = imath.Min(config.TTL, imath.Max(0, int(time.Until(*force).Seconds())))
-	}
-
-	if config.CacheControlPassthrough && ttl < 0 && originHeaders != nil {
-		if val, ok := originHeaders["Cache-Control"]; ok && len(val) > 0 {
-			rw.Header().Set("Cache-Control", val)
-			return
-		}
-
-		if val, ok := originHeaders["Expires"]; ok && len(val) > 0 {
-			if t, err := time.Parse(http.TimeFormat, val); err == nil {
-				ttl = imath.Max(0, int(time.Until(t).Seconds()))
-			}
-		}
-	}
-
-	if ttl < 0 {
-		ttl = config.TTL
-	}
-
-	if ttl > 0 {
-		rw.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public", ttl))
-	} else {
-		rw.Header().Set("Cache-Control", "no-cache")
-	}
-}
-
 func setLastModified(rw http.ResponseWriter, originHeaders map[string]string) {
 	if config.LastModifiedEnabled {
 		if val, ok := originHeaders["Last-Modified"]; ok && len(val) != 0 {
@@ -122,25 +90,99 @@ func setCanonical(rw http.ResponseWriter, originURL string) {
 	}
 }
 
+func setCacheTags(rw http.ResponseWriter, po *options.ProcessingOptions, originURL string, originHeaders map[string]string) {
+	if !cachetags.Enabled() {
+		return
+	}
+
+	var watermark string
+	if po.Watermark.Enabled {
+		watermark = po.Watermark.Type
+	}
+
+	tags := cachetags.Tags(originURL, po.UsedPresets, watermark, originHeaders["ETag"])
+	cachetags.SetHeaders(rw.Header(), tags)
+}
+
+func masterCacheKey(masterObjectURI string) string {
+	return "master/" + masterObjectURI
+}
+
+func resultCacheKey(key string) string {
+	return "result/" + key
+}
+
 func respondWithImage(reqID string, r *http.Request, rw http.ResponseWriter, statusCode int, resultData *imagedata.ImageData, po *options.ProcessingOptions, originURL string, originData *imagedata.ImageData) {
-	rw.Header().Set("Content-Type", resultData.Type.Mime())
+	var originHeaders map[string]string
+	if originData != nil {
+		originHeaders = originData.Headers
+	}
 
-	// cache for 365 days
-	rw.Header().Set("Cache-Control", "max-age: 31536000, public")
-	rw.Header().Set("Last-Modified", time.Now().Format(http.TimeFormat))
-	rw.Header().Set("Expires", time.Now().AddDate(1, 0, 0).Format(http.TimeFormat))
+	rw.Header().Set("Content-Type", resultData.Type.Mime())
 
+	setCacheControl(rw, po, statusCode, originHeaders)
+	setLastModified(rw, originHeaders)
 	setVary(rw)
 	setCanonical(rw, originURL)
+	setCacheTags(rw, po, originURL, originHeaders)
+	setMaxBytesExceeded(rw, resultData)
 
 	if config.EnableDebugHeaders {
-		rw.Header().Set("X-Origin-Content-Length", strconv.Itoa(len(originData.Data)))
-		rw.Header().Set("X-Origin-Width", resultData.Headers["X-Origin-Width"])
-		rw.Header().Set("X-Origin-Height", resultData.Headers["X-Origin-Height"])
-		rw.Header().Set("X-Result-Width", resultData.Headers["X-Result-Width"])
-		rw.Header().Set("X-Result-Height", resultData.Headers["X-Result-Height"])
+		// Results served from the memory cache have no origin data
+		if originData != nil && originData.Data != nil {
+			rw.Header().Set("X-Origin-Content-Length", strconv.Itoa(len(originData.Data)))
+		}
+		setDebugSizeHeaders(rw, resultData)
 	}
 
+	writeImage(reqID, r, rw, statusCode, resultData, po, originURL)
+}
+
+// respondWithComposedImage responds with an image composed of several sources.
+// It's tagged with all of them, so purging any source invalidates it
+func respondWithComposedImage(reqID string, r *http.Request, rw http.ResponseWriter, resultData *imagedata.ImageData, po *options.ProcessingOptions, sourceURLs []string) {
+	rw.Header().Set("Content-Type", resultData.Type.Mime())
+
+	setCacheControl(rw, po, http.StatusOK, nil)
+	setVary(rw)
+	setMaxBytesExceeded(rw, resultData)
+
+	if cachetags.Enabled() {
+		var watermark string
+		if po.Watermark.Enabled {
+			watermark = po.Watermark.Type
+		}
+
+		tags := cachetags.Tags(sourceURLs[0], po.UsedPresets, watermark, "")
+		for _, u := range sourceURLs[1:] {
+			tags = append(tags, cachetags.ObjectTag(u))
+		}
+
+		cachetags.SetHeaders(rw.Header(), tags)
+	}
+
+	if config.EnableDebugHeaders {
+		setDebugSizeHeaders(rw, resultData)
+	}
+
+	writeImage(reqID, r, rw, http.StatusOK, resultData, po, strings.Join(sourceURLs, ","))
+}
+
+// setMaxBytesExceeded marks the results that don't fit max_bytes
+func setMaxBytesExceeded(rw http.ResponseWriter, resultData *imagedata.ImageData) {
+	if val := resultData.Headers["X-Max-Bytes-Exceeded"]; len(val) > 0 {
+		rw.Header().Set("X-Max-Bytes-Exceeded", val)
+	}
+}
+
+func setDebugSizeHeaders(rw http.ResponseWriter, resultData *imagedata.ImageData) {
+	rw.Header().Set("X-Origin-Width", resultData.Headers["X-Origin-Width"])
+	rw.Header().Set("X-Origin-Height", resultData.Headers["X-Origin-Height"])
+	rw.Header().Set("X-Result-Width", resultData.Headers["X-Result-Width"])
+	rw.Header().Set("X-Result-Height", resultData.Headers["X-Result-Height"])
+}
+
+func writeImage(reqID string, r *http.Request, rw http.ResponseWriter, statusCode int, resultData *imagedata.ImageData, po *options.ProcessingOptions, originURL string) {
 	rw.WriteHeader(statusCode)
 	_, err := rw.Write(resultData.Data)
 
@@ -164,7 +206,9 @@ func respondWithImage(reqID string, r *http.Request, rw http.ResponseWriter, sta
 }
 
 func respondWithNotModified(reqID string, r *http.Request, rw http.ResponseWriter, po *options.ProcessingOptions, originURL string, originHeaders map[string]string) {
-	setCacheControl(rw, po.Expires, originHeaders)
+	// 304 revalidates the regular response, so it should have the same caching directives
+	setCacheControl(rw, po, http.StatusOK, originHeaders)
+	setLastModified(rw, originHeaders)
 	setVary(rw)
 
 	rw.WriteHeader(304)
@@ -261,6 +305,29 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Result caches are keyed by the processing options hash, so we need it
+	// even if ETags are disabled
+	if !config.ETagEnabled && (resultcache.Enabled() || diskcache.DerivativesEnabled() || derivatives.Enabled()) {
+		etagHandler.SetActualProcessingOptions(po)
+	}
+
+	// Serve repeated requests from the result cache without waiting for a worker
+	if resultcache.Enabled() {
+		if entry, ok := resultcache.Lookup(imageURL, masterPyramidLevel(po), etagHandler.ProcessingOptionsHash(), po.Format); ok {
+			if config.ETagEnabled && len(entry.ETag) > 0 {
+				rw.Header().Set("ETag", entry.ETag)
+
+				if r.Header.Get("If-None-Match") == entry.ETag {
+					respondWithNotModified(reqID, r, rw, po, imageURL, entry.OriginHeaders)
+					return
+				}
+			}
+
+			respondWithImage(reqID, r, rw, http.StatusOK, entry.ImageData(), po, imageURL, entry.OriginData())
+			return
+		}
+	}
+
 	if queueSem != nil {
 		acquired := queueSem.TryAcquire(1)
 		if !acquired {
@@ -291,8 +358,6 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 
 	statusCode := http.StatusOK
 
-	masterObjectURI := "s3://" + masterBucket + "/" + imageURL
-
 	originData, err := func() (*imagedata.ImageData, error) {
 		defer metrics.StartDownloadingSegment(ctx)()
 
@@ -306,7 +371,7 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 			checkErr(ctx, "download", err)
 		}
 
-		return imagedata.Download(ctx, masterObjectURI, "source image", downloadOpts, po.SecurityOptions)
+		return downloadMaster(ctx, imageURL, downloadOpts, po)
 	}()
 
 	if err != nil {
@@ -429,24 +494,68 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	resultData, err := func() (*imagedata.ImageData, error) {
-		defer metrics.StartProcessingSegment(ctx)()
-		return processing.ProcessImage(ctx, originData, po)
-	}()
-	checkErr(ctx, "processing", err)
+	// Results can be cached only when we know the master version
+	var resultKey string
+	if masterETag := originData.Headers["ETag"]; statusCode == http.StatusOK && len(masterETag) > 0 {
+		resultKey = resultcache.Key(etagHandler.ProcessingOptionsHash(), masterETag, po.Format)
+	}
+
+	var (
+		resultData *imagedata.ImageData
+		resultHit  bool
+	)
+
+	if len(resultKey) > 0 && diskcache.DerivativesEnabled() {
+		resultData, resultHit = diskcache.Get(resultCacheKey(resultKey), "cached result image", po.SecurityOptions)
+	}
+
+	var derivativeURI string
+
+	if !resultHit && len(resultKey) > 0 && derivatives.Enabled() && po.DerivativeStore.Enabled {
+		derivativeURI = derivatives.ObjectURI(imageURL, etagHandler.ProcessingOptionsHash(), originData.Headers["ETag"], po.Format)
+
+		if resultData, resultHit = derivatives.Get(ctx, derivativeURI, po.DerivativeStore.TTL, po.SecurityOptions); resultHit {
+			diskcache.Set(resultCacheKey(resultKey), resultData)
+		}
+	}
+
+	if !resultHit {
+		resultData, err = func() (*imagedata.ImageData, error) {
+			defer metrics.StartProcessingSegment(ctx)()
+			return processing.ProcessImage(ctx, originData, po)
+		}()
+		checkErr(ctx, "processing", err)
+
+		if len(resultKey) > 0 && diskcache.DerivativesEnabled() {
+			diskcache.Set(resultCacheKey(resultKey), resultData)
+		}
+
+		// The derivative store doesn't keep the headers, so results that don't fit
+		// max_bytes would lose the mark
+		if len(derivativeURI) > 0 && len(resultData.Headers["X-Max-Bytes-Exceeded"]) == 0 {
+			derivatives.Put(derivativeURI, resultData, po.DerivativeStore.TTL)
+		}
+	}
 
 	defer resultData.Close()
 
 	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
 
+	if len(resultKey) > 0 && resultcache.Enabled() {
+		resultcache.SetMasterVersion(imageURL, masterPyramidLevel(po), originData.Headers["ETag"])
+		resultcache.Set(resultKey, resultData, originData.Headers, rw.Header().Get("ETag"))
+	}
+
 	respondWithImage(reqID, r, rw, statusCode, resultData, po, imageURL, originData)
 }
 
-func getAndCreateMasterImageData(ctx context.Context, imageURL string, imgRequestHeader http.Header) (*imagedata.ImageData, error) {
-
-	masterHeaders := http.Header{
+func masterRequestHeader() http.Header {
+	return http.Header{
 		"Accept": []string{"image/avif"},
 	}
+}
+
+func getAndCreateMasterImageData(ctx context.Context, imageURL string, imgRequestHeader http.Header) (*imagedata.ImageData, error) {
 
 	// Normalize the imageURL by removing the first path segment and prepending "0x0/"
 	if segments := strings.SplitN(imageURL, "/", 2); len(segments) == 2 {
@@ -454,12 +563,15 @@ func getAndCreateMasterImageData(ctx context.Context, imageURL string, imgReques
 	}
 
 	// Parse processing options
-	po, imageURL, err := options.ParsePathIPC(imageURL, nil, masterHeaders)
+	po, imageURL, err := options.ParsePathIPC(imageURL, nil, masterRequestHeader())
 	checkErr(ctx, "path_parsing", err)
 
+	applyMasterOptions(po)
+
 	originalObjectURI := "s3://" + originalBucket + "/" + imageURL
-	masterObjectURI := "s3://" + masterBucket + "/" + imageURL
 
+	// Masters are always created from the original. The disk cache may still hold
+	// the previous master when it's being refreshed
 	originData, err := func() (*imagedata.ImageData, error) {
 		defer metrics.StartDownloadingSegment(ctx)()
 
@@ -479,17 +591,126 @@ func getAndCreateMasterImageData(ctx context.Context, imageURL string, imgReques
 		return originData, nil
 	}
 
-	defer originData.Close()
+	edits, err := downloadMasterEdits(ctx, imageURL)
+	if err == nil {
+		err = po.ApplyEdits(edits)
+	}
+
+	if err != nil {
+		originData.Close()
+		return nil, err
+	}
+
+	masterData := originData
+
+	// Web-safe originals are stored as is, so derivatives are encoded only once.
+	// Edited originals are always processed
+	if len(edits) > 0 || !slices.Contains(config.MasterPassthroughFormats, originData.Type) {
+		defer originData.Close()
+
+		masterData, err = func() (*imagedata.ImageData, error) {
+			defer metrics.StartProcessingSegment(ctx)()
+			return processing.ProcessImage(ctx, originData, po)
+		}()
 
-	resultData, err := func() (*imagedata.ImageData, error) {
+		checkErr(ctx, "processing", err)
+	}
+
+	levels, err := func() (map[int]*imagedata.ImageData, error) {
 		defer metrics.StartProcessingSegment(ctx)()
-		return processing.ProcessImage(ctx, originData, po)
+		return createMasterLevels(ctx, imageURL, originData, masterData, edits)
 	}()
 
-	checkErr(ctx, "processing", err)
+	if err == nil {
+		defer closeMasterLevels(levels)
+
+		metadata := make(http.Header)
+
+		placeholderData := createMasterPlaceholder(ctx, imageURL, masterData, levels)
+		if placeholderData != nil {
+			defer placeholderData.Close()
+			maps.Copy(metadata, placeholderMetadataHeader(placeholderData))
+		}
+
+		maps.Copy(metadata, createMasterHashesHeader(imageURL, masterData, levels))
 
-	err = imagedata.Upload(ctx, masterObjectURI, "master image", resultData)
+		err = uploadMaster(ctx, imageURL, masterData, levels, metadata)
+
+		if err == nil && placeholderData != nil {
+			cachePlaceholder(placeholderCacheKey(imageURL, placeholderData.Type), placeholderData, masterData.Headers)
+		}
+	}
+
+	if err != nil {
+		masterData.Close()
+		return nil, err
+	}
+
+	return masterData, nil
+
+}
+
+// applyMasterOptions sets up the master encoding
+func applyMasterOptions(po *options.ProcessingOptions) {
+	if config.MasterFormat != imagetype.Unknown {
+		po.Format = config.MasterFormat
+	}
+
+	po.Quality = config.MasterQuality
+	po.SaveOptions.Lossless = config.MasterLossless
+	// The value is validated by config
+	po.SaveOptions.ChromaSubsampling, _ = vips.ParseChromaSubsampling(config.MasterChromaSubsampling)
+
+	if config.MasterKeepColorProfile {
+		po.StripColorProfile = false
+	}
+
+	if len(config.MasterMetadataPolicy) > 0 {
+		po.MetadataPolicy = config.MasterMetadataPolicy
+	}
+}
+
+// uploadMaster uploads the master along with its pyramid levels.
+// Levels go first, so the new master is never served with stale levels.
+// metadata is added to the headers of the full master only
+func uploadMaster(ctx context.Context, imageURL string, masterData *imagedata.ImageData, levels map[int]*imagedata.ImageData, metadata http.Header) error {
+	upload := func(level int, data *imagedata.ImageData) error {
+		uri := masterObjectURI(imageURL, level)
+
+		uploadOpts := imagedata.UploadOptions{
+			Header: http.Header{"Content-Type": {data.Type.Mime()}},
+		}
+
+		if level == 0 {
+			maps.Copy(uploadOpts.Header, metadata)
+		}
+
+		if err := imagedata.Upload(ctx, uri, "master image", data, uploadOpts); err != nil {
+			return err
+		}
+
+		diskcache.Delete(masterCacheKey(uri))
+		missingMasterLevels.Delete(uri)
+
+		return nil
+	}
+
+	for l, data := range levels {
+		if err := upload(l, data); err != nil {
+			return err
+		}
+	}
+
+	if err := upload(0, masterData); err != nil {
+		return err
+	}
+
+	for _, f := range placeholderFormats {
+		diskcache.Delete(placeholderCacheKey(imageURL, f))
+	}
 
-	return resultData, err
+	resultcache.ForgetMaster(imageURL)
+	scheduleWarmup(imageURL, masterData, levels)
 
+	return nil
 }
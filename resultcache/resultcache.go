@@ -0,0 +1,172 @@
+package resultcache
+
+import (
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/lru"
+	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
+)
+
+const (
+	metricsName = "result"
+
+	// Rough memory overhead of a single entry besides the image data
+	entryOverhead = 512
+
+	// Max number of remembered master versions
+	maxMasterVersions = 65536
+)
+
+// Entry is a processed image stored in the cache along with the ETag
+// that was sent with it and the headers of its master
+type Entry struct {
+	Type          imagetype.Type
+	Data          []byte
+	Headers       map[string]string
+	OriginHeaders map[string]string
+	ETag          string
+}
+
+// ImageData returns the cached result. The returned image data shares its buffer
+// with the cache, so it should never be modified
+func (e *Entry) ImageData() *imagedata.ImageData {
+	return &imagedata.ImageData{Type: e.Type, Data: e.Data, Headers: e.Headers}
+}
+
+// OriginData returns the image data carrying only the master headers
+func (e *Entry) OriginData() *imagedata.ImageData {
+	return &imagedata.ImageData{Headers: e.OriginHeaders}
+}
+
+var (
+	results  *lru.Cache[*Entry]
+	versions *lru.Cache[string]
+)
+
+func Init() {
+	if config.ResultCacheSize <= 0 {
+		return
+	}
+
+	results = lru.New(int64(config.ResultCacheSize), func(string, *Entry) {
+		prometheus.IncrementCacheEvictions(metricsName)
+	})
+	versions = lru.New[string](maxMasterVersions, nil)
+
+	prometheus.AddGaugeFunc(
+		"result_cache_bytes",
+		"A gauge of the result cache size in bytes.",
+		func() float64 { return float64(results.Cost()) },
+	)
+	prometheus.AddGaugeFunc(
+		"result_cache_entries",
+		"A gauge of the number of entries in the result cache.",
+		func() float64 { return float64(results.Len()) },
+	)
+}
+
+func Enabled() bool {
+	return results != nil
+}
+
+// Key builds a cache key from the processing options hash, the master ETag,
+// and the requested format
+func Key(poHash, masterETag string, format imagetype.Type) string {
+	return strings.Join([]string{poHash, masterETag, format.String()}, "/")
+}
+
+// Get returns the cached entry
+func Get(key string) (*Entry, bool) {
+	if !Enabled() {
+		return nil, false
+	}
+
+	e, ok := results.Get(key)
+	if !ok {
+		prometheus.IncrementCacheMisses(metricsName)
+		return nil, false
+	}
+
+	prometheus.IncrementCacheHits(metricsName)
+
+	return e, true
+}
+
+// Lookup returns the cached result for the latest known version of the master
+// image. Unknown master versions are counted as misses too, since such requests
+// are never served from the cache
+func Lookup(imageURL string, level int, poHash string, format imagetype.Type) (*Entry, bool) {
+	if !Enabled() {
+		return nil, false
+	}
+
+	masterETag, ok := MasterVersion(imageURL, level)
+	if !ok {
+		prometheus.IncrementCacheMisses(metricsName)
+		return nil, false
+	}
+
+	return Get(Key(poHash, masterETag, format))
+}
+
+// Set stores a copy of the result data so the original buffer can be
+// returned to the pool
+func Set(key string, data *imagedata.ImageData, originHeaders map[string]string, etag string) {
+	if !Enabled() {
+		return
+	}
+
+	e := &Entry{
+		Type:          data.Type,
+		Data:          append([]byte(nil), data.Data...),
+		Headers:       maps.Clone(data.Headers),
+		OriginHeaders: maps.Clone(originHeaders),
+		ETag:          etag,
+	}
+
+	results.Set(key, e, int64(len(e.Data)+entryOverhead), 0)
+}
+
+func versionKey(imageURL string, level int) string {
+	return imageURL + "#" + strconv.Itoa(level)
+}
+
+// MasterVersion returns the last seen ETag of the master image used for the
+// master pyramid level (0 means the full master).
+// Versions expire after IMGPROXY_RESULT_CACHE_TTL so masters updated by
+// other instances are picked up eventually
+func MasterVersion(imageURL string, level int) (string, bool) {
+	if !Enabled() {
+		return "", false
+	}
+
+	return versions.Get(versionKey(imageURL, level))
+}
+
+func SetMasterVersion(imageURL string, level int, etag string) {
+	if !Enabled() || len(etag) == 0 {
+		return
+	}
+
+	versions.Set(versionKey(imageURL, level), etag, 1, time.Duration(config.ResultCacheTTL)*time.Second)
+}
+
+// ForgetMaster drops the remembered master versions so the next request
+// fetches the master and caches the results under the new ETag
+func ForgetMaster(imageURL string) {
+	if !Enabled() {
+		return
+	}
+
+	versions.Delete(versionKey(imageURL, 0))
+
+	for _, l := range config.MasterPyramidLevels {
+		versions.Delete(versionKey(imageURL, l))
+	}
+}
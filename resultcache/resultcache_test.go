@@ -0,0 +1,195 @@
+package resultcache
+
+import (
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
+)
+
+// Room for testCacheEntries entries of testDataSize bytes
+const (
+	testDataSize     = 1024
+	testCacheEntries = 3
+)
+
+type ResultCacheTestSuite struct {
+	suite.Suite
+}
+
+func (s *ResultCacheTestSuite) SetupSuite() {
+	config.Reset()
+
+	// Prometheus metrics can be registered only once, so the cache is initialized
+	// once too and every test uses its own image URLs
+	config.PrometheusBind = ":0"
+	prometheus.Init()
+
+	config.ResultCacheSize = testCacheEntries * (testDataSize + entryOverhead)
+	Init()
+}
+
+func (s *ResultCacheTestSuite) TearDownSuite() {
+	config.Reset()
+}
+
+// counter returns the value of the result cache counter
+func (s *ResultCacheTestSuite) counter(name string) float64 {
+	mfs, err := prom.DefaultGatherer.Gather()
+	s.Require().NoError(err)
+
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "cache" && l.GetValue() == metricsName {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+func (s *ResultCacheTestSuite) set(imageURL, poHash, masterETag string) []byte {
+	data := make([]byte, testDataSize)
+	copy(data, imageURL+poHash+masterETag)
+
+	Set(
+		Key(poHash, masterETag, imagetype.WEBP),
+		&imagedata.ImageData{Type: imagetype.WEBP, Data: data, Headers: map[string]string{"Content-Type": "image/webp"}},
+		map[string]string{"ETag": masterETag},
+		`"result"`,
+	)
+
+	return data
+}
+
+func (s *ResultCacheTestSuite) TestHit() {
+	SetMasterVersion("hit.jpg", 0, "v1")
+	data := s.set("hit.jpg", "po", "v1")
+
+	expected := append([]byte(nil), data...)
+
+	// The cache keeps a copy, so the buffer can go back to the pool
+	data[0] = 0
+
+	hits := s.counter("cache_hits_total")
+
+	e, ok := Lookup("hit.jpg", 0, "po", imagetype.WEBP)
+	s.Require().True(ok)
+
+	s.Require().Equal(expected, e.ImageData().Data)
+	s.Require().Equal(imagetype.WEBP, e.ImageData().Type)
+	s.Require().Equal(map[string]string{"Content-Type": "image/webp"}, e.ImageData().Headers)
+	s.Require().Equal(map[string]string{"ETag": "v1"}, e.OriginData().Headers)
+	s.Require().Equal(`"result"`, e.ETag)
+
+	s.Require().Equal(hits+1, s.counter("cache_hits_total"))
+}
+
+func (s *ResultCacheTestSuite) TestMiss() {
+	SetMasterVersion("miss.jpg", 0, "v1")
+	s.set("miss.jpg", "po", "v1")
+
+	misses := s.counter("cache_misses_total")
+
+	// Another options hash
+	_, ok := Lookup("miss.jpg", 0, "other", imagetype.WEBP)
+	s.Require().False(ok)
+
+	// Another format
+	_, ok = Lookup("miss.jpg", 0, "po", imagetype.AVIF)
+	s.Require().False(ok)
+
+	// Another pyramid level with no known version
+	_, ok = Lookup("miss.jpg", 512, "po", imagetype.WEBP)
+	s.Require().False(ok)
+
+	s.Require().Equal(misses+3, s.counter("cache_misses_total"))
+}
+
+func (s *ResultCacheTestSuite) TestUnknownMasterVersionIsMiss() {
+	misses := s.counter("cache_misses_total")
+
+	_, ok := Lookup("unknown.jpg", 0, "po", imagetype.WEBP)
+	s.Require().False(ok)
+
+	s.Require().Equal(misses+1, s.counter("cache_misses_total"))
+}
+
+func (s *ResultCacheTestSuite) TestMasterVersionChange() {
+	SetMasterVersion("version.jpg", 0, "v1")
+	s.set("version.jpg", "po", "v1")
+
+	_, ok := Lookup("version.jpg", 0, "po", imagetype.WEBP)
+	s.Require().True(ok)
+
+	// The master is replaced, so the old results are never served again
+	SetMasterVersion("version.jpg", 0, "v2")
+
+	_, ok = Lookup("version.jpg", 0, "po", imagetype.WEBP)
+	s.Require().False(ok)
+
+	s.set("version.jpg", "po", "v2")
+
+	_, ok = Lookup("version.jpg", 0, "po", imagetype.WEBP)
+	s.Require().True(ok)
+}
+
+func (s *ResultCacheTestSuite) TestForgetMaster() {
+	config.MasterPyramidLevels = []int{512}
+	defer func() { config.MasterPyramidLevels = []int{} }()
+
+	SetMasterVersion("forget.jpg", 0, "v1")
+	SetMasterVersion("forget.jpg", 512, "v1-512")
+	SetMasterVersion("other.jpg", 0, "v1")
+	s.set("forget.jpg", "po", "v1")
+
+	ForgetMaster("forget.jpg")
+
+	_, ok := MasterVersion("forget.jpg", 0)
+	s.Require().False(ok)
+	_, ok = MasterVersion("forget.jpg", 512)
+	s.Require().False(ok)
+
+	_, ok = Lookup("forget.jpg", 0, "po", imagetype.WEBP)
+	s.Require().False(ok)
+
+	v, ok := MasterVersion("other.jpg", 0)
+	s.Require().True(ok)
+	s.Require().Equal("v1", v)
+}
+
+func (s *ResultCacheTestSuite) TestEviction() {
+	SetMasterVersion("evict.jpg", 0, "v1")
+
+	evictions := s.counter("cache_evictions_total")
+
+	for _, h := range []string{"a", "b", "c", "d"} {
+		s.set("evict.jpg", h, "v1")
+	}
+
+	s.Require().LessOrEqual(results.Cost(), int64(config.ResultCacheSize))
+	s.Require().Greater(s.counter("cache_evictions_total"), evictions)
+
+	// The least recently used entry is evicted first
+	_, ok := Lookup("evict.jpg", 0, "a", imagetype.WEBP)
+	s.Require().False(ok)
+
+	_, ok = Lookup("evict.jpg", 0, "d", imagetype.WEBP)
+	s.Require().True(ok)
+}
+
+func TestResultCache(t *testing.T) {
+	suite.Run(t, new(ResultCacheTestSuite))
+}
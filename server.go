@@ -34,6 +34,20 @@ func buildRouter() *router.Router {
 
 	r.POST("/master/refresh", withMetrics(withPanicHandler(withCORS(handleRefreshMaster))), false)
 
+	r.GET("/spin/", withMetrics(withPanicHandler(withCORS(withSecret(handleSpin)))), false)
+
+	r.GET("/collage/", withMetrics(withPanicHandler(withCORS(withSecret(handleCollage)))), false)
+
+	r.GET("/info/", withMetrics(withPanicHandler(withCORS(withSecret(handleInfo)))), false)
+
+	r.GET("/metadata/", withMetrics(withPanicHandler(withCORS(withSecret(handleMetadata)))), false)
+
+	r.GET("/placeholder/", withMetrics(withPanicHandler(withCORS(withSecret(handlePlaceholder)))), false)
+
+	r.GET("/palette/", withMetrics(withPanicHandler(withCORS(withSecret(handlePalette)))), false)
+
+	r.GET("/compare", withMetrics(withPanicHandler(withCORS(withSecret(handleCompare)))), true)
+
 	r.GET("/", withMetrics(withPanicHandler(withCORS(withSecret(handleProcessing)))), false)
 
 	r.HEAD("/", withCORS(handleHead), false)
@@ -162,6 +176,7 @@ func withPanicHandler(h router.RouteHandler) router.RouteHandler {
 				router.LogResponse(reqID, r, ierr.StatusCode(), ierr)
 
 				rw.Header().Set("Content-Type", "text/plain")
+				setErrorCacheControl(rw, ierr.StatusCode())
 				rw.WriteHeader(ierr.StatusCode())
 
 				if config.DevelopmentErrorsMode {
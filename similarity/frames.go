@@ -0,0 +1,43 @@
+package similarity
+
+import "math"
+
+// MostRepresentativeFrame returns the index of the frame that is the closest
+// to the mean frame. Frames are 8-bit grayscale images of the same size.
+// Intro/outro frames like blank screens or fades are far from the mean,
+// so they are rarely chosen
+func MostRepresentativeFrame(frames [][]byte) int {
+	if len(frames) < 2 {
+		return 0
+	}
+
+	size := len(frames[0])
+
+	mean := make([]float64, size)
+	for _, f := range frames {
+		for i := 0; i < size; i++ {
+			mean[i] += float64(f[i])
+		}
+	}
+
+	n := float64(len(frames))
+	for i := range mean {
+		mean[i] /= n
+	}
+
+	best := 0
+	bestDist := math.Inf(1)
+
+	for fi, f := range frames {
+		var dist float64
+		for i := 0; i < size; i++ {
+			dist += math.Abs(float64(f[i]) - mean[i])
+		}
+
+		if dist < bestDist {
+			best, bestDist = fi, dist
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,20 @@
+package similarity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMostRepresentativeFrame(t *testing.T) {
+	blank := make([]byte, 64*48)
+	img := testImage(64, 48)
+
+	shifted := testImage(64, 48)
+	for i := range shifted {
+		shifted[i] += 2
+	}
+
+	require.Equal(t, 2, MostRepresentativeFrame([][]byte{blank, shifted, img, shifted, blank}))
+	require.Equal(t, 0, MostRepresentativeFrame([][]byte{img}))
+}
@@ -0,0 +1,104 @@
+package similarity
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// DHashWidth and DHashHeight are the size of the grayscale image dHash is calculated from
+	DHashWidth  = 9
+	DHashHeight = 8
+
+	// PHashSize is the side of the grayscale image pHash is calculated from
+	PHashSize = 32
+
+	// Side of the low-frequency DCT block pHash bits are taken from
+	pHashLowFreqSize = 8
+)
+
+// pHashCos holds DCT-II cosines of the low frequencies: pHashCos[u][x] = cos((2x+1)uπ/2N)
+var pHashCos = func() (c [pHashLowFreqSize][PHashSize]float64) {
+	for u := 0; u < pHashLowFreqSize; u++ {
+		for x := 0; x < PHashSize; x++ {
+			c[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * PHashSize))
+		}
+	}
+	return
+}()
+
+// DHash calculates the difference hash of a DHashWidth x DHashHeight 8-bit grayscale image.
+// Every bit tells if a pixel is brighter than its right neighbour
+func DHash(pixels []byte) uint64 {
+	if len(pixels) < DHashWidth*DHashHeight {
+		return 0
+	}
+
+	var h uint64
+
+	for y := 0; y < DHashHeight; y++ {
+		row := pixels[y*DHashWidth : (y+1)*DHashWidth]
+
+		for x := 0; x < DHashWidth-1; x++ {
+			h <<= 1
+			if row[x] > row[x+1] {
+				h |= 1
+			}
+		}
+	}
+
+	return h
+}
+
+// PHash calculates the DCT hash of a PHashSize x PHashSize 8-bit grayscale image.
+// Every bit tells if a low-frequency DCT coefficient is greater than their median
+func PHash(pixels []byte) uint64 {
+	if len(pixels) < PHashSize*PHashSize {
+		return 0
+	}
+
+	// DCT is separable, so the columns are transformed first and the rows then
+	var cols [pHashLowFreqSize][PHashSize]float64
+
+	for v := 0; v < pHashLowFreqSize; v++ {
+		for y := 0; y < PHashSize; y++ {
+			c := pHashCos[v][y]
+			for x := 0; x < PHashSize; x++ {
+				cols[v][x] += float64(pixels[y*PHashSize+x]) * c
+			}
+		}
+	}
+
+	coeffs := make([]float64, 0, pHashLowFreqSize*pHashLowFreqSize)
+
+	for v := 0; v < pHashLowFreqSize; v++ {
+		for u := 0; u < pHashLowFreqSize; u++ {
+			var f float64
+			for x := 0; x < PHashSize; x++ {
+				f += cols[v][x] * pHashCos[u][x]
+			}
+			coeffs = append(coeffs, f)
+		}
+	}
+
+	sorted := append([]float64(nil), coeffs...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var h uint64
+
+	for _, f := range coeffs {
+		h <<= 1
+		if f > median {
+			h |= 1
+		}
+	}
+
+	return h
+}
+
+// HammingDistance returns the number of different bits of two hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
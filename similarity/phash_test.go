@@ -0,0 +1,53 @@
+package similarity
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// wavesImage renders a smooth test pattern
+func wavesImage(width, height int, brightness float64) []byte {
+	img := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 120 + 60*math.Sin(float64(x)/5)*math.Cos(float64(y)/7) + brightness
+			img[y*width+x] = byte(max(0, min(255, v)))
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	// Brightness grows to the right, so no pixel is brighter than its right neighbour
+	grows := make([]byte, DHashWidth*DHashHeight)
+	for i := range grows {
+		grows[i] = byte(i % DHashWidth * 20)
+	}
+	require.Equal(t, uint64(0), DHash(grows))
+
+	flipped := make([]byte, DHashWidth*DHashHeight)
+	for y := 0; y < DHashHeight; y++ {
+		for x := 0; x < DHashWidth; x++ {
+			flipped[y*DHashWidth+x] = byte(255 - x*20)
+		}
+	}
+	require.Equal(t, ^uint64(0), DHash(flipped))
+}
+
+func TestPHashSimilar(t *testing.T) {
+	img := wavesImage(PHashSize, PHashSize, 0)
+
+	// Uniform brightness changes affect only the DC coefficient
+	brighter := wavesImage(PHashSize, PHashSize, 10)
+	require.LessOrEqual(t, HammingDistance(PHash(img), PHash(brighter)), 2)
+
+	different := testImage(PHashSize, PHashSize)
+	require.Greater(t, HammingDistance(PHash(img), PHash(different)), 10)
+}
+
+func TestHammingDistance(t *testing.T) {
+	require.Equal(t, 0, HammingDistance(0xf0f0, 0xf0f0))
+	require.Equal(t, 4, HammingDistance(0xf0f0, 0xf0ff))
+}
@@ -0,0 +1,69 @@
+package similarity
+
+import "math"
+
+const (
+	// Size of the SSIM window
+	ssimWindow = 8
+	// Step between the windows. Windows overlap to not miss artifacts
+	// on the window borders
+	ssimStep = 4
+
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// SSIM calculates the mean structural similarity of two 8-bit grayscale images
+// of the same size. The result is in the [-1, 1] range, 1 means identical images.
+// Images smaller than the window are compared as a single window
+func SSIM(a, b []byte, width, height int) float64 {
+	if width <= 0 || height <= 0 || len(a) < width*height || len(b) < width*height {
+		return 0
+	}
+
+	winW := min(ssimWindow, width)
+	winH := min(ssimWindow, height)
+
+	var (
+		sum   float64
+		count int
+	)
+
+	for y := 0; y+winH <= height; y += ssimStep {
+		for x := 0; x+winW <= width; x += ssimStep {
+			sum += windowSSIM(a, b, width, x, y, winW, winH)
+			count++
+		}
+	}
+
+	return sum / float64(count)
+}
+
+func windowSSIM(a, b []byte, stride, x, y, w, h int) float64 {
+	var sumA, sumB, sumAA, sumBB, sumAB float64
+
+	for j := y; j < y+h; j++ {
+		row := j * stride
+		for i := x; i < x+w; i++ {
+			va := float64(a[row+i])
+			vb := float64(b[row+i])
+
+			sumA += va
+			sumB += vb
+			sumAA += va * va
+			sumBB += vb * vb
+			sumAB += va * vb
+		}
+	}
+
+	n := float64(w * h)
+
+	meanA := sumA / n
+	meanB := sumB / n
+	varA := math.Max(sumAA/n-meanA*meanA, 0)
+	varB := math.Max(sumBB/n-meanB*meanB, 0)
+	covar := sumAB/n - meanA*meanB
+
+	return ((2*meanA*meanB + ssimC1) * (2*covar + ssimC2)) /
+		((meanA*meanA + meanB*meanB + ssimC1) * (varA + varB + ssimC2))
+}
@@ -0,0 +1,46 @@
+package similarity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testImage(width, height int) []byte {
+	img := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img[y*width+x] = byte((x*7 + y*13) % 256)
+		}
+	}
+	return img
+}
+
+func TestSSIMIdentical(t *testing.T) {
+	img := testImage(64, 48)
+	require.InDelta(t, 1.0, SSIM(img, img, 64, 48), 1e-9)
+}
+
+func TestSSIMDistorted(t *testing.T) {
+	img := testImage(64, 48)
+
+	slight := append([]byte(nil), img...)
+	heavy := append([]byte(nil), img...)
+	for i := range img {
+		if i%2 == 0 {
+			slight[i] ^= 1
+			heavy[i] ^= 64
+		}
+	}
+
+	slightSSIM := SSIM(img, slight, 64, 48)
+	heavySSIM := SSIM(img, heavy, 64, 48)
+
+	require.Less(t, slightSSIM, 1.0)
+	require.Greater(t, slightSSIM, heavySSIM)
+}
+
+func TestSSIMSmallImage(t *testing.T) {
+	img := testImage(3, 2)
+	require.InDelta(t, 1.0, SSIM(img, img, 3, 2), 1e-9)
+}
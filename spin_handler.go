@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/errorreport"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/metrics"
+	"github.com/imgproxy/imgproxy/v3/metrics/stats"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+// Max number of spin frames downloaded at once
+const spinDownloadConcurrency = 8
+
+// Frame number placeholder of spin patterns: {n} or zero-padded {n:3}
+var spinPlaceholderRe = regexp.MustCompile(`\{n(?::(\d))?\}`)
+
+type spinPattern struct {
+	prefix string
+	suffix string
+	// Width of the zero-padded frame number
+	width int
+}
+
+func parseSpinPattern(pattern string) (spinPattern, error) {
+	locs := spinPlaceholderRe.FindAllStringSubmatchIndex(pattern, -1)
+	if len(locs) != 1 {
+		return spinPattern{}, newInvalidURLErrorf(http.StatusBadRequest, "Spin pattern should contain exactly one {n} placeholder: %s", pattern)
+	}
+
+	loc := locs[0]
+
+	p := spinPattern{
+		prefix: pattern[:loc[0]],
+		suffix: pattern[loc[1]:],
+	}
+
+	if loc[2] >= 0 {
+		p.width, _ = strconv.Atoi(pattern[loc[2]:loc[3]])
+	}
+
+	return p, nil
+}
+
+func (p spinPattern) key(n int) string {
+	return fmt.Sprintf("%s%0*d%s", p.prefix, p.width, n, p.suffix)
+}
+
+type spinRequest struct {
+	first int
+	count int
+	// Respond with the sprite map instead of the image
+	mapOnly bool
+
+	opts processing.SpinOptions
+}
+
+func parseSpinInt(qs url.Values, name string, def, min, max int) (int, error) {
+	s := qs.Get(name)
+	if len(s) == 0 {
+		return def, nil
+	}
+
+	if v, err := strconv.Atoi(s); err == nil && v >= min && v <= max {
+		return v, nil
+	}
+
+	return 0, newInvalidURLErrorf(http.StatusBadRequest, "Invalid spin %s: %s", name, s)
+}
+
+// parseSpinRequest parses the spin query:
+// count (required), first (default 1), out (anim, sprite, or map), cols, delay, and loop
+func parseSpinRequest(qs url.Values) (spinRequest, error) {
+	var (
+		req spinRequest
+		err error
+	)
+
+	if req.count, err = parseSpinInt(qs, "count", 0, 1, config.SpinMaxFrames); err != nil {
+		return req, err
+	}
+	if req.count == 0 {
+		return req, newInvalidURLErrorf(http.StatusBadRequest, "Spin frames count is required")
+	}
+
+	if req.first, err = parseSpinInt(qs, "first", 1, 0, 1<<30); err != nil {
+		return req, err
+	}
+
+	if req.opts.Columns, err = parseSpinInt(qs, "cols", 0, 0, req.count); err != nil {
+		return req, err
+	}
+
+	if req.opts.Delay, err = parseSpinInt(qs, "delay", config.SpinFrameDelay, 1, 60000); err != nil {
+		return req, err
+	}
+
+	if req.opts.Loop, err = parseSpinInt(qs, "loop", 0, 0, 65535); err != nil {
+		return req, err
+	}
+
+	switch out := qs.Get("out"); out {
+	case "", "anim":
+	case "sprite":
+		req.opts.Sprite = true
+	case "map":
+		req.opts.Sprite = true
+		req.mapOnly = true
+	default:
+		return req, newInvalidURLErrorf(http.StatusBadRequest, "Invalid spin output: %s", out)
+	}
+
+	return req, nil
+}
+
+func downloadSpinFrames(ctx context.Context, pattern spinPattern, first, count int, po *options.ProcessingOptions) ([]*imagedata.ImageData, error) {
+	frames := make([]*imagedata.ImageData, count)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(spinDownloadConcurrency)
+
+	for i := range frames {
+		g.Go(func() error {
+			imgdata, err := downloadMasterOrOriginal(gctx, pattern.key(first+i), po)
+			frames[i] = imgdata
+			return err
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		closeImagesData(frames)
+		return nil, err
+	}
+
+	return frames, nil
+}
+
+func closeImagesData(list []*imagedata.ImageData) {
+	for _, f := range list {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// GET /spin/{width}x{height}/{pattern}?count=36
+func handleSpin(reqID string, rw http.ResponseWriter, r *http.Request) {
+	stats.IncRequestsInProgress()
+	defer stats.DecRequestsInProgress()
+
+	ctx := r.Context()
+
+	qs := r.URL.Query()
+
+	po, patternURL, err := options.ParsePathIPC(strings.TrimPrefix(r.URL.Path, config.PathPrefix+"/spin/"), qs, r.Header)
+	checkErr(ctx, "path_parsing", err)
+
+	errorreport.SetMetadata(r, "Source Image URL", patternURL)
+	errorreport.SetMetadata(r, "Processing Options", po)
+
+	metrics.SetMetadata(ctx, "imgproxy.source_image_url", patternURL)
+	metrics.SetMetadata(ctx, "imgproxy.processing_options", po)
+
+	pattern, err := parseSpinPattern(patternURL)
+	checkErr(ctx, "path_parsing", err)
+
+	spinReq, err := parseSpinRequest(qs)
+	checkErr(ctx, "path_parsing", err)
+
+	err = security.VerifySourceURL(patternURL)
+	checkErr(ctx, "security", err)
+
+	if queueSem != nil {
+		acquired := queueSem.TryAcquire(1)
+		if !acquired {
+			panic(newTooManyRequestsError())
+		}
+		defer queueSem.Release(1)
+	}
+
+	// Spins are processed in a single worker like regular images
+	func() {
+		defer metrics.StartQueueSegment(ctx)()
+
+		err = processingSem.Acquire(ctx, 1)
+		if err != nil {
+			checkErr(ctx, "queue", router.CheckTimeout(ctx))
+			sendErrAndPanic(ctx, "queue", err)
+		}
+	}()
+	defer processingSem.Release(1)
+
+	stats.IncImagesInProgress()
+	defer stats.DecImagesInProgress()
+
+	// The first frame is downloaded and rendered alone, so the spin resolution
+	// is checked before the rest of the frames are downloaded
+	frames, err := func() ([]*imagedata.ImageData, error) {
+		defer metrics.StartDownloadingSegment(ctx)()
+		return downloadSpinFrames(ctx, pattern, spinReq.first, 1, po)
+	}()
+	checkErr(ctx, "download", err)
+	defer func() { closeImagesData(frames) }()
+
+	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
+
+	// The sprite map needs only the frame size
+	spriteMap, err := processing.SpinSpriteMap(ctx, frames[0], spinReq.count, po, spinReq.opts)
+	checkErr(ctx, "processing", err)
+
+	if spinReq.mapOnly {
+		setCacheControl(rw, po, http.StatusOK, nil)
+		writeJSON(rw, http.StatusOK, spriteMap)
+
+		router.LogResponse(reqID, r, http.StatusOK, nil)
+		return
+	}
+
+	rest, err := func() ([]*imagedata.ImageData, error) {
+		defer metrics.StartDownloadingSegment(ctx)()
+		return downloadSpinFrames(ctx, pattern, spinReq.first+1, spinReq.count-1, po)
+	}()
+	checkErr(ctx, "download", err)
+
+	frames = append(frames, rest...)
+
+	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
+
+	resultData, err := func() (*imagedata.ImageData, error) {
+		defer metrics.StartProcessingSegment(ctx)()
+		return processing.ProcessSpin(ctx, frames, po, spinReq.opts)
+	}()
+	checkErr(ctx, "processing", err)
+	defer resultData.Close()
+
+	checkErr(ctx, "timeout", router.CheckTimeout(ctx))
+
+	respondWithImage(reqID, r, rw, http.StatusOK, resultData, po, patternURL, nil)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/processing"
+)
+
+func TestParseSpinPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		keys    map[int]string
+		err     bool
+	}{
+		{
+			pattern: "cw/spin/123/frame-{n}.jpg",
+			keys:    map[int]string{1: "cw/spin/123/frame-1.jpg", 36: "cw/spin/123/frame-36.jpg"},
+		},
+		{
+			pattern: "cw/spin/123/frame-{n:3}.jpg",
+			keys:    map[int]string{1: "cw/spin/123/frame-001.jpg", 36: "cw/spin/123/frame-036.jpg", 1000: "cw/spin/123/frame-1000.jpg"},
+		},
+		{
+			pattern: "{n:2}.png",
+			keys:    map[int]string{7: "07.png"},
+		},
+		{pattern: "cw/spin/123/frame.jpg", err: true},
+		{pattern: "cw/spin/{n}/frame-{n}.jpg", err: true},
+		{pattern: "cw/spin/123/frame-{n:}.jpg", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pattern, func(t *testing.T) {
+			p, err := parseSpinPattern(tc.pattern)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			for n, key := range tc.keys {
+				require.Equal(t, key, p.key(n))
+			}
+		})
+	}
+}
+
+func TestParseSpinRequest(t *testing.T) {
+	config.Reset()
+	defer config.Reset()
+
+	config.SpinMaxFrames = 72
+
+	tests := []struct {
+		name     string
+		query    string
+		expected spinRequest
+		err      bool
+	}{
+		{
+			name:  "defaults",
+			query: "count=36",
+			expected: spinRequest{
+				first: 1,
+				count: 36,
+				opts:  processing.SpinOptions{Delay: config.SpinFrameDelay},
+			},
+		},
+		{
+			name:  "sprite",
+			query: "count=36&first=0&out=sprite&cols=6&delay=100&loop=2",
+			expected: spinRequest{
+				first: 0,
+				count: 36,
+				opts:  processing.SpinOptions{Sprite: true, Columns: 6, Delay: 100, Loop: 2},
+			},
+		},
+		{
+			name:  "map",
+			query: "count=4&out=map",
+			expected: spinRequest{
+				first:   1,
+				count:   4,
+				mapOnly: true,
+				opts:    processing.SpinOptions{Sprite: true, Delay: config.SpinFrameDelay},
+			},
+		},
+		{name: "anim", query: "count=4&out=anim", expected: spinRequest{first: 1, count: 4, opts: processing.SpinOptions{Delay: config.SpinFrameDelay}}},
+		{name: "no count", query: "", err: true},
+		{name: "zero count", query: "count=0", err: true},
+		{name: "too many frames", query: "count=73", err: true},
+		{name: "invalid count", query: "count=abc", err: true},
+		{name: "negative first", query: "count=4&first=-1", err: true},
+		{name: "more columns than frames", query: "count=4&cols=5", err: true},
+		{name: "zero delay", query: "count=4&delay=0", err: true},
+		{name: "invalid out", query: "count=4&out=gif", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			qs, err := url.ParseQuery(tc.query)
+			require.NoError(t, err)
+
+			req, err := parseSpinRequest(qs)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, req)
+		})
+	}
+}
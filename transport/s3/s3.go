@@ -35,6 +35,8 @@ var s3BufPool = sync.Pool{
     },
 }
 
+const metadataHeaderPrefix = "X-Amz-Meta-"
+
 type s3Client interface {
 	GetObject(ctx context.Context, input *s3.GetObjectInput, opts ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 	PutObject(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error)
@@ -272,20 +274,48 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 			ContentLength: &req.ContentLength,
 			Body:   bodyReader,
 		}
+
+		if contentType := req.Header.Get("Content-Type"); len(contentType) > 0 {
+			input.ContentType = aws.String(contentType)
+		}
+		if cacheControl := req.Header.Get("Cache-Control"); len(cacheControl) > 0 {
+			input.CacheControl = aws.String(cacheControl)
+		}
+		if expires := req.Header.Get("Expires"); len(expires) > 0 {
+			if t, err := time.Parse(http.TimeFormat, expires); err == nil {
+				input.Expires = &t
+			}
+		}
+
+		// Pass X-Amz-Meta-* headers as the object's user-defined metadata
+		for name, values := range req.Header {
+			if len(values) > 0 && len(name) > len(metadataHeaderPrefix) && strings.EqualFold(name[:len(metadataHeaderPrefix)], metadataHeaderPrefix) {
+				if input.Metadata == nil {
+					input.Metadata = make(map[string]string)
+				}
+				input.Metadata[strings.ToLower(name[len(metadataHeaderPrefix):])] = values[0]
+			}
+		}
 	
 		client := t.getBucketClient(bucket)
 	
-		_, err = client.PutObject(req.Context(), input)
+		output, err := client.PutObject(req.Context(), input)
 
 		if err != nil {
 			return handleError(req, err)
 		}
 
+		header := make(http.Header)
+		if output.ETag != nil {
+			header.Set("ETag", *output.ETag)
+		}
+
 		return &http.Response{
 			StatusCode:    http.StatusOK,
 			Proto:         "HTTP/1.0",
 			ProtoMajor:    1,
 			ProtoMinor:    0,
+			Header:        header,
 			Close:         true,
 			Request:       req,
 		}, nil
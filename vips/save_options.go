@@ -0,0 +1,79 @@
+package vips
+
+import (
+	"fmt"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// ChromaSubsampling values match VipsForeignSubsample
+type ChromaSubsampling int
+
+const (
+	ChromaSubsamplingAuto ChromaSubsampling = iota
+	ChromaSubsamplingOn
+	ChromaSubsamplingOff
+)
+
+var chromaSubsamplings = map[string]ChromaSubsampling{
+	"auto": ChromaSubsamplingAuto,
+	"on":   ChromaSubsamplingOn,
+	"off":  ChromaSubsamplingOff,
+}
+
+func ParseChromaSubsampling(s string) (ChromaSubsampling, error) {
+	if cs, ok := chromaSubsamplings[s]; ok {
+		return cs, nil
+	}
+
+	return ChromaSubsamplingAuto, fmt.Errorf("Invalid chroma subsampling: %s", s)
+}
+
+func (cs ChromaSubsampling) String() string {
+	for k, v := range chromaSubsamplings {
+		if v == cs {
+			return k
+		}
+	}
+	return ""
+}
+
+func (cs ChromaSubsampling) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%q", cs.String())), nil
+}
+
+// SaveOptions holds encoder settings that can be changed per image
+type SaveOptions struct {
+	// Lossless enables lossless compression for WebP, AVIF, and JPEG XL.
+	// Quality is ignored in this case
+	Lossless bool
+	// ChromaSubsampling is used by JPEG and AVIF. Lossless AVIF is never subsampled
+	ChromaSubsampling ChromaSubsampling
+
+	JpegProgressive  bool
+	JpegTrellisQuant bool
+
+	PngQuantize           bool
+	PngQuantizationColors int
+
+	WebpLossless     bool
+	WebpNearLossless bool
+	WebpMethod       int
+	WebpAlphaQuality int
+
+	AvifSpeed int
+}
+
+// DefaultSaveOptions returns the encoder settings from the config
+func DefaultSaveOptions() SaveOptions {
+	return SaveOptions{
+		ChromaSubsampling:     ChromaSubsamplingAuto,
+		JpegProgressive:       config.JpegProgressive,
+		JpegTrellisQuant:      config.JpegTrellisQuant,
+		PngQuantize:           config.PngQuantize,
+		PngQuantizationColors: config.PngQuantizationColors,
+		WebpMethod:            config.WebpMethod,
+		WebpAlphaQuality:      config.WebpAlphaQuality,
+		AvifSpeed:             config.AvifSpeed,
+	}
+}
@@ -432,6 +432,12 @@ vips_has_embedded_icc(VipsImage *in)
   return vips_image_get_typeof(in, VIPS_META_ICC_NAME) != 0;
 }
 
+const char *
+vips_interpretation_nick_go(VipsImage *in)
+{
+  return vips_enum_nick(VIPS_TYPE_INTERPRETATION, vips_image_guess_interpretation(in));
+}
+
 int
 vips_icc_backup(VipsImage *in, VipsImage **out)
 {
@@ -700,6 +706,46 @@ vips_flatten_go(VipsImage *in, VipsImage **out, double r, double g, double b)
   return res;
 }
 
+int
+vips_pixels_go(VipsImage *in, void **buf, size_t *len, int grayscale)
+{
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+
+  VipsInterpretation cs = grayscale ? VIPS_INTERPRETATION_B_W : VIPS_INTERPRETATION_sRGB;
+
+  if (vips_colourspace(in, &t[0], cs, NULL)) {
+    clear_image(&base);
+    return 1;
+  }
+
+  VipsImage *tmp = t[0];
+
+  if (vips_image_hasalpha(tmp)) {
+    VipsArrayDouble *bg = vips_array_double_newv(1, 255.0);
+    int res = vips_flatten(tmp, &t[1], "background", bg, NULL);
+    vips_area_unref((VipsArea *) bg);
+
+    if (res) {
+      clear_image(&base);
+      return 1;
+    }
+
+    tmp = t[1];
+  }
+
+  if (vips_cast(tmp, &t[2], VIPS_FORMAT_UCHAR, NULL)) {
+    clear_image(&base);
+    return 1;
+  }
+
+  *buf = vips_image_write_to_memory(t[2], len);
+
+  clear_image(&base);
+
+  return *buf == NULL ? 1 : 0;
+}
+
 int
 vips_extract_area_go(VipsImage *in, VipsImage **out, int left, int top, int width, int height)
 {
@@ -790,6 +836,288 @@ vips_trim(VipsImage *in, VipsImage **out, double threshold,
   return vips_extract_area(in, out, left, top, width, height, NULL);
 }
 
+/* Applies fn to the colour bands only, alpha is kept as is.
+ * The result has the format and the interpretation of the input */
+typedef int (*VipsColourFn)(VipsImage *in, VipsImage **out, void *data);
+
+static int
+vips_apply_to_colour(VipsImage *in, VipsImage **out, VipsColourFn fn, void *data)
+{
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 5);
+
+  VipsBandFormat format = in->BandFmt;
+  VipsInterpretation interpretation = in->Type;
+  int res;
+
+  if (vips_image_hasalpha(in)) {
+    res =
+        vips_extract_band(in, &t[0], 0, "n", in->Bands - 1, NULL) ||
+        vips_extract_band(in, &t[1], in->Bands - 1, "n", 1, NULL) ||
+        fn(t[0], &t[2], data) ||
+        vips_cast(t[2], &t[3], format, NULL) ||
+        vips_bandjoin2(t[3], t[1], &t[4], NULL) ||
+        vips_copy(t[4], out, "interpretation", interpretation, NULL);
+  }
+  else {
+    res =
+        fn(in, &t[0], data) ||
+        vips_cast(t[0], &t[1], format, NULL) ||
+        vips_copy(t[1], out, "interpretation", interpretation, NULL);
+  }
+
+  clear_image(&base);
+
+  return res;
+}
+
+static int
+vips_dim_fn(VipsImage *in, VipsImage **out, void *data)
+{
+  return vips_linear1(in, out, *(double *) data, 0, NULL);
+}
+
+int
+vips_dim_go(VipsImage *in, VipsImage **out, double factor)
+{
+  return vips_apply_to_colour(in, out, vips_dim_fn, &factor);
+}
+
+/* Stretches the levels so 0.5% of the pixels are black and 0.5% are white */
+static int
+vips_auto_level_fn(VipsImage *in, VipsImage **out, void *data)
+{
+  VipsImage *gray;
+  int low, high;
+
+  double max = vips_interpretation_max_alpha(in->Type);
+
+  if (vips_colourspace(in, &gray, VIPS_INTERPRETATION_B_W, NULL))
+    return 1;
+
+  if (vips_percent(gray, 0.5, &low, NULL) || vips_percent(gray, 99.5, &high, NULL)) {
+    clear_image(&gray);
+    return 1;
+  }
+
+  clear_image(&gray);
+
+  if (high <= low)
+    return vips_copy(in, out, NULL);
+
+  double a = max / (high - low);
+
+  return vips_linear1(in, out, a, -low * a, NULL);
+}
+
+int
+vips_auto_level_go(VipsImage *in, VipsImage **out)
+{
+  return vips_apply_to_colour(in, out, vips_auto_level_fn, NULL);
+}
+
+typedef struct {
+  double brightness;
+  double contrast;
+  double gamma;
+} VipsToneOptions;
+
+static int
+vips_tone_fn(VipsImage *in, VipsImage **out, void *data)
+{
+  VipsToneOptions *opts = (VipsToneOptions *) data;
+
+  double max = vips_interpretation_max_alpha(in->Type);
+
+  if (opts->gamma == 1)
+    return vips_linear1(in, out,
+        opts->contrast, max / 2 * (1 - opts->contrast) + opts->brightness * max / 255, NULL);
+
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 2);
+
+  /* vips_gamma normalises to the max of the input format, so the values
+   * should be brought back to the format first */
+  int res =
+      vips_linear1(in, &t[0],
+          opts->contrast, max / 2 * (1 - opts->contrast) + opts->brightness * max / 255, NULL) ||
+      vips_cast(t[0], &t[1], in->BandFmt, NULL) ||
+      vips_gamma(t[1], out, "exponent", opts->gamma, NULL);
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_tone_go(VipsImage *in, VipsImage **out, double brightness, double contrast, double gamma)
+{
+  VipsToneOptions opts = { brightness, contrast, gamma };
+  return vips_apply_to_colour(in, out, vips_tone_fn, &opts);
+}
+
+static int
+vips_saturation_fn(VipsImage *in, VipsImage **out, void *data)
+{
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 2);
+
+  double a[3] = { 1, *(double *) data, 1 };
+  double b[3] = { 0, 0, 0 };
+
+  int res =
+      vips_colourspace(in, &t[0], VIPS_INTERPRETATION_LCH, NULL) ||
+      vips_linear(t[0], &t[1], a, b, 3, NULL) ||
+      vips_colourspace(t[1], out, in->Type, NULL);
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_saturation_go(VipsImage *in, VipsImage **out, double saturation)
+{
+  return vips_apply_to_colour(in, out, vips_saturation_fn, &saturation);
+}
+
+typedef struct {
+  double shadow[3];
+  double highlight[3];
+  double intensity;
+} VipsDuotoneOptions;
+
+/* Maps the luminance to the gradient between the shadow and the highlight colours
+ * and mixes the result with the image */
+static int
+vips_duotone_fn(VipsImage *in, VipsImage **out, void *data)
+{
+  VipsDuotoneOptions *opts = (VipsDuotoneOptions *) data;
+
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 4);
+
+  double max = vips_interpretation_max_alpha(in->Type);
+  double a[3], b[3];
+
+  for (int i = 0; i < 3; i++) {
+    a[i] = (opts->highlight[i] - opts->shadow[i]) / 255;
+    b[i] = opts->shadow[i] * max / 255;
+  }
+
+  int res =
+      vips_colourspace(in, &t[0], VIPS_INTERPRETATION_B_W, NULL) ||
+      vips_linear(t[0], &t[1], a, b, 3, NULL) ||
+      vips_linear1(t[1], &t[2], opts->intensity, 0, NULL) ||
+      vips_linear1(in, &t[3], 1 - opts->intensity, 0, NULL) ||
+      vips_add(t[3], t[2], out, NULL);
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_duotone_go(VipsImage *in, VipsImage **out, double sr, double sg, double sb,
+    double hr, double hg, double hb, double intensity)
+{
+  VipsDuotoneOptions opts = { { sr, sg, sb }, { hr, hg, hb }, intensity };
+  return vips_apply_to_colour(in, out, vips_duotone_fn, &opts);
+}
+
+/* Multiplies the alpha of the image by the mask. Masks with alpha are applied
+ * by their alpha, the other ones by their luminance.
+ * The mask should have the same size as the image */
+int
+vips_apply_mask_go(VipsImage *in, VipsImage *mask, VipsImage **out)
+{
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 7);
+
+  VipsBandFormat format = in->BandFmt;
+  double max = vips_interpretation_max_alpha(in->Type);
+  double mask_max = vips_interpretation_max_alpha(mask->Type);
+
+  if (vips_image_hasalpha(mask)) {
+    if (vips_extract_band(mask, &t[0], mask->Bands - 1, "n", 1, NULL)) {
+      clear_image(&base);
+      return 1;
+    }
+  }
+  else if (vips_colourspace(mask, &t[0], VIPS_INTERPRETATION_B_W, NULL)) {
+    clear_image(&base);
+    return 1;
+  }
+
+  int res;
+
+  if (vips_image_hasalpha(in)) {
+    res =
+        vips_extract_band(in, &t[1], 0, "n", in->Bands - 1, NULL) ||
+        vips_extract_band(in, &t[2], in->Bands - 1, "n", 1, NULL) ||
+        vips_multiply(t[2], t[0], &t[3], NULL) ||
+        vips_linear1(t[3], &t[4], 1.0 / mask_max, 0, NULL) ||
+        vips_bandjoin2(t[1], t[4], &t[5], NULL) ||
+        vips_cast(t[5], out, format, NULL);
+  }
+  else {
+    res =
+        vips_linear1(t[0], &t[1], max / mask_max, 0, NULL) ||
+        vips_bandjoin2(in, t[1], &t[2], NULL) ||
+        vips_cast(t[2], out, format, NULL);
+  }
+
+  clear_image(&base);
+
+  return res;
+}
+
+/* Rotates the image by an arbitrary angle around its center, scales it,
+ * and crops or extends the result to the size.
+ * If transparent is set, the corners are transparent instead of the background */
+int
+vips_rotate_free_go(VipsImage *in, VipsImage **out, double angle, double scale,
+    int width, int height, double r, double g, double b, int transparent)
+{
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 2);
+
+  if (transparent && !vips_image_hasalpha(in)) {
+    if (vips_addalpha(in, &t[0], NULL)) {
+      clear_image(&base);
+      return 1;
+    }
+
+    in = t[0];
+  }
+
+  double max = vips_interpretation_max_alpha(in->Type);
+  double colour[3] = { r * max / 255, g * max / 255, b * max / 255 };
+  double bg[4] = { 0, 0, 0, 0 };
+
+  int colour_bands = vips_image_hasalpha(in) ? in->Bands - 1 : in->Bands;
+
+  if (!transparent) {
+    for (int i = 0; i < colour_bands && i < 3; i++)
+      bg[i] = colour[i];
+
+    if (colour_bands < in->Bands)
+      bg[colour_bands] = max;
+  }
+
+  VipsArrayDouble *bga = vips_array_double_new(bg, VIPS_MIN(in->Bands, 4));
+
+  int res =
+      vips_similarity(in, &t[1], "angle", angle, "scale", scale, "background", bga, NULL) ||
+      vips_gravity(t[1], out, VIPS_COMPASS_DIRECTION_CENTRE, width, height,
+          "extend", VIPS_EXTEND_BACKGROUND, "background", bga, NULL);
+
+  clear_image(&base);
+  vips_area_unref((VipsArea *) bga);
+
+  return res;
+}
+
 int
 vips_replicate_go(VipsImage *in, VipsImage **out, int width, int height, int centered)
 {
@@ -902,17 +1230,32 @@ vips_linecache_seq(VipsImage *in, VipsImage **out, int tile_height)
 }
 
 int
-vips_arrayjoin_go(VipsImage **in, VipsImage **out, int n)
+vips_arrayjoin_go(VipsImage **in, VipsImage **out, int n, int across, int shim)
 {
-  return vips_arrayjoin(in, out, n, "across", 1, NULL);
+  return vips_arrayjoin(in, out, n, "across", across, "shim", shim, NULL);
 }
 
 typedef struct {
   int strip_all;
   int keep_exif_copyright;
   int keep_animation;
+  const char **keep_fields;
+  int keep_fields_n;
 } VipsStripOptions;
 
+/* Fields ending with "*" match any field with the prefix
+ */
+static int
+vips_strip_field_match(const char *pattern, const char *name)
+{
+  size_t len = strlen(pattern);
+
+  if (len > 0 && pattern[len - 1] == '*')
+    return strncmp(pattern, name, len - 1) == 0;
+
+  return strcmp(pattern, name) == 0;
+}
+
 void *
 vips_strip_fn(VipsImage *in, const char *name, GValue *value, void *a)
 {
@@ -947,6 +1290,10 @@ vips_strip_fn(VipsImage *in, const char *name, GValue *value, void *a)
           (strcmp(name, "loop") == 0) ||
           (strcmp(name, "n-pages") == 0))
         return NULL;
+
+    for (int i = 0; i < opts->keep_fields_n; i++)
+      if (vips_strip_field_match(opts->keep_fields[i], name))
+        return NULL;
   }
 
   vips_image_remove(in, name);
@@ -955,7 +1302,8 @@ vips_strip_fn(VipsImage *in, const char *name, GValue *value, void *a)
 }
 
 int
-vips_strip(VipsImage *in, VipsImage **out, int keep_exif_copyright)
+vips_strip(VipsImage *in, VipsImage **out, int keep_exif_copyright,
+    const char **keep_fields, int keep_fields_n)
 {
   static double default_resolution = 72.0 / 25.4;
 
@@ -963,6 +1311,8 @@ vips_strip(VipsImage *in, VipsImage **out, int keep_exif_copyright)
     .strip_all = 0,
     .keep_exif_copyright = FALSE,
     .keep_animation = FALSE,
+    .keep_fields = keep_fields,
+    .keep_fields_n = keep_fields_n,
   };
 
   if (vips_image_get_typeof(in, "imgproxy-is-animated") &&
@@ -988,6 +1338,8 @@ vips_strip_all(VipsImage *in, VipsImage **out)
     .strip_all = TRUE,
     .keep_exif_copyright = FALSE,
     .keep_animation = FALSE,
+    .keep_fields = NULL,
+    .keep_fields_n = 0,
   };
 
   if (vips_copy(in, out, NULL))
@@ -1003,23 +1355,28 @@ vips_strip_all(VipsImage *in, VipsImage **out)
 }
 
 int
-vips_jpegsave_go(VipsImage *in, void **buf, size_t *len, int quality, int interlace)
+vips_jpegsave_go(VipsImage *in, void **buf, size_t *len, int quality, int interlace,
+    int subsample, int trellis_quant)
 {
   return vips_jpegsave_buffer(
       in, buf, len,
       "Q", quality,
       "optimize_coding", TRUE,
       "interlace", interlace,
+      "subsample_mode", subsample,
+      "trellis_quant", trellis_quant,
       NULL);
 }
 
 int
-vips_jxlsave_go(VipsImage *in, void **buf, size_t *len, int quality, int effort)
+vips_jxlsave_go(VipsImage *in, void **buf, size_t *len, int quality, int effort,
+    int lossless)
 {
   return vips_jxlsave_buffer(
       in, buf, len,
       "Q", quality,
       "effort", effort,
+      "lossless", lossless,
       NULL);
 }
 
@@ -1066,11 +1423,16 @@ vips_pngsave_go(VipsImage *in, void **buf, size_t *len, int interlace, int quant
 }
 
 int
-vips_webpsave_go(VipsImage *in, void **buf, size_t *len, int quality)
+vips_webpsave_go(VipsImage *in, void **buf, size_t *len, int quality, int lossless,
+    int near_lossless, int effort, int alpha_q)
 {
   return vips_webpsave_buffer(
       in, buf, len,
       "Q", quality,
+      "lossless", lossless,
+      "near_lossless", near_lossless,
+      "effort", effort,
+      "alpha_q", alpha_q,
       NULL);
 }
 
@@ -1100,13 +1462,21 @@ vips_heifsave_go(VipsImage *in, void **buf, size_t *len, int quality)
 }
 
 int
-vips_avifsave_go(VipsImage *in, void **buf, size_t *len, int quality, int speed)
+vips_avifsave_go(VipsImage *in, void **buf, size_t *len, int quality, int speed,
+    int lossless, int subsample)
 {
+  /* Lossless AVIF makes sense only with full chroma resolution
+   */
+  if (lossless)
+    subsample = VIPS_FOREIGN_SUBSAMPLE_OFF;
+
   return vips_heifsave_buffer(
       in, buf, len,
       "Q", quality,
       "compression", VIPS_FOREIGN_HEIF_COMPRESSION_AV1,
       "effort", 9 - speed,
+      "lossless", lossless,
+      "subsample_mode", subsample,
       NULL);
 }
 
@@ -45,14 +45,10 @@ var (
 )
 
 var vipsConf struct {
-	JpegProgressive       C.int
-	PngInterlaced         C.int
-	PngQuantize           C.int
-	PngQuantizationColors C.int
-	AvifSpeed             C.int
-	JxlEffort             C.int
-	PngUnlimited          C.int
-	SvgUnlimited          C.int
+	PngInterlaced C.int
+	JxlEffort     C.int
+	PngUnlimited  C.int
+	SvgUnlimited  C.int
 }
 
 var badImageErrRe = []*regexp.Regexp{
@@ -95,11 +91,7 @@ func Init() error {
 
 	gifResolutionLimit = int(C.gif_resolution_limit())
 
-	vipsConf.JpegProgressive = gbool(config.JpegProgressive)
 	vipsConf.PngInterlaced = gbool(config.PngInterlaced)
-	vipsConf.PngQuantize = gbool(config.PngQuantize)
-	vipsConf.PngQuantizationColors = C.int(config.PngQuantizationColors)
-	vipsConf.AvifSpeed = C.int(config.AvifSpeed)
 	vipsConf.JxlEffort = C.int(config.JxlEffort)
 	vipsConf.PngUnlimited = gbool(config.PngUnlimited)
 	vipsConf.SvgUnlimited = gbool(config.SvgUnlimited)
@@ -392,7 +384,7 @@ func (img *Image) LoadThumbnail(imgdata *imagedata.ImageData) error {
 	return nil
 }
 
-func (img *Image) Save(imgtype imagetype.Type, quality int) (*imagedata.ImageData, error) {
+func (img *Image) Save(imgtype imagetype.Type, quality int, opts SaveOptions) (*imagedata.ImageData, error) {
 	if imgtype == imagetype.ICO {
 		return img.saveAsIco()
 	}
@@ -409,21 +401,34 @@ func (img *Image) Save(imgtype imagetype.Type, quality int) (*imagedata.ImageDat
 	err := C.int(0)
 	imgsize := C.size_t(0)
 
+	lossless := gbool(opts.Lossless)
+	subsample := C.int(opts.ChromaSubsampling)
+
+	// Quantization is lossy, so it's disabled for lossless images
+	pngQuantize := gbool(opts.PngQuantize && !opts.Lossless)
+
 	switch imgtype {
 	case imagetype.JPEG:
-		err = C.vips_jpegsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality), vipsConf.JpegProgressive)
+		err = C.vips_jpegsave_go(
+			img.VipsImage, &ptr, &imgsize, C.int(quality),
+			gbool(opts.JpegProgressive), subsample, gbool(opts.JpegTrellisQuant),
+		)
 	case imagetype.JXL:
-		err = C.vips_jxlsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality), vipsConf.JxlEffort)
+		err = C.vips_jxlsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality), vipsConf.JxlEffort, lossless)
 	case imagetype.PNG:
-		err = C.vips_pngsave_go(img.VipsImage, &ptr, &imgsize, vipsConf.PngInterlaced, vipsConf.PngQuantize, vipsConf.PngQuantizationColors)
+		err = C.vips_pngsave_go(img.VipsImage, &ptr, &imgsize, vipsConf.PngInterlaced, pngQuantize, C.int(opts.PngQuantizationColors))
 	case imagetype.WEBP:
-		err = C.vips_webpsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality))
+		err = C.vips_webpsave_go(
+			img.VipsImage, &ptr, &imgsize, C.int(quality),
+			gbool(opts.Lossless || opts.WebpLossless), gbool(opts.WebpNearLossless),
+			C.int(opts.WebpMethod), C.int(opts.WebpAlphaQuality),
+		)
 	case imagetype.GIF:
 		err = C.vips_gifsave_go(img.VipsImage, &ptr, &imgsize)
 	case imagetype.HEIC:
 		err = C.vips_heifsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality))
 	case imagetype.AVIF:
-		err = C.vips_avifsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality), vipsConf.AvifSpeed)
+		err = C.vips_avifsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality), C.int(opts.AvifSpeed), lossless, subsample)
 	case imagetype.TIFF:
 		err = C.vips_tiffsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality))
 	default:
@@ -461,7 +466,14 @@ func (img *Image) LineCache(lines int) error {
 	return nil
 }
 
+// Arrayjoin joins the images vertically
 func (img *Image) Arrayjoin(in []*Image) error {
+	return img.ArrayjoinAcross(in, 1, 0)
+}
+
+// ArrayjoinAcross joins the images into a grid with the given number of columns.
+// Shim is the space between the images, it's filled with zeros
+func (img *Image) ArrayjoinAcross(in []*Image, across, shim int) error {
 	var tmp *C.VipsImage
 
 	arr := make([]*C.VipsImage, len(in))
@@ -469,7 +481,7 @@ func (img *Image) Arrayjoin(in []*Image) error {
 		arr[i] = im.VipsImage
 	}
 
-	if C.vips_arrayjoin_go(&arr[0], &tmp, C.int(len(arr))) != 0 {
+	if C.vips_arrayjoin_go(&arr[0], &tmp, C.int(len(arr)), C.int(across), C.int(shim)) != 0 {
 		return Error()
 	}
 
@@ -647,6 +659,23 @@ func (img *Image) Rotate(angle int) error {
 	return nil
 }
 
+// RotateFree rotates the image by an arbitrary angle clockwise, scales it, and crops
+// or extends the result to the size. The corners are filled with the background
+// or are transparent
+func (img *Image) RotateFree(angle, scale float64, width, height int, bg Color, transparent bool) error {
+	var tmp *C.VipsImage
+
+	if C.vips_rotate_free_go(
+		img.VipsImage, &tmp, C.double(angle), C.double(scale), C.int(width), C.int(height),
+		C.double(bg.R), C.double(bg.G), C.double(bg.B), gbool(transparent),
+	) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+	return nil
+}
+
 func (img *Image) Flip() error {
 	var tmp *C.VipsImage
 
@@ -704,6 +733,17 @@ func (img *Image) Trim(threshold float64, smart bool, color Color, equalHor bool
 	return nil
 }
 
+func (img *Image) AddAlpha() error {
+	var tmp *C.VipsImage
+
+	if C.vips_addalpha_go(img.VipsImage, &tmp) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
 func (img *Image) Flatten(bg Color) error {
 	var tmp *C.VipsImage
 
@@ -715,6 +755,72 @@ func (img *Image) Flatten(bg Color) error {
 	return nil
 }
 
+// Dim multiplies the colour channels by the factor. Alpha is kept as is
+func (img *Image) Dim(factor float64) error {
+	var tmp *C.VipsImage
+
+	if C.vips_dim_go(img.VipsImage, &tmp, C.double(factor)) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// AutoLevel stretches the levels so the darkest pixels become black and the lightest become white
+func (img *Image) AutoLevel() error {
+	var tmp *C.VipsImage
+
+	if C.vips_auto_level_go(img.VipsImage, &tmp) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// AdjustTone changes the brightness (-255..255), the contrast and the gamma (1 keeps them as is)
+func (img *Image) AdjustTone(brightness int, contrast, gamma float64) error {
+	var tmp *C.VipsImage
+
+	if C.vips_tone_go(img.VipsImage, &tmp, C.double(brightness), C.double(contrast), C.double(gamma)) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// AdjustSaturation multiplies the chroma. 0 makes the image grayscale
+func (img *Image) AdjustSaturation(saturation float64) error {
+	var tmp *C.VipsImage
+
+	if C.vips_saturation_go(img.VipsImage, &tmp, C.double(saturation)) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// Duotone maps the luminance to the gradient between the colours.
+// Intensity sets how much of the result is mixed with the image
+func (img *Image) Duotone(shadow, highlight Color, intensity float64) error {
+	var tmp *C.VipsImage
+
+	if C.vips_duotone_go(
+		img.VipsImage, &tmp,
+		C.double(shadow.R), C.double(shadow.G), C.double(shadow.B),
+		C.double(highlight.R), C.double(highlight.G), C.double(highlight.B),
+		C.double(intensity),
+	) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
 func (img *Image) ApplyFilters(blurSigma, sharpSigma float32, pixelatePixels int) error {
 	var tmp *C.VipsImage
 
@@ -785,6 +891,15 @@ func (img *Image) ImportColourProfile() error {
 	return nil
 }
 
+func (img *Image) HasColourProfile() bool {
+	return C.vips_has_embedded_icc(img.VipsImage) != 0
+}
+
+// Interpretation returns the name of the image colour space like `srgb`, `cmyk`, or `b-w`
+func (img *Image) Interpretation() string {
+	return C.GoString(C.vips_interpretation_nick_go(img.VipsImage))
+}
+
 func (img *Image) ColourProfileImported() bool {
 	imported, err := img.GetIntDefault("imgproxy-icc-imported", 0)
 	return imported > 0 && err == nil
@@ -885,6 +1000,20 @@ func (img *Image) CopyMemory() error {
 	return nil
 }
 
+// Pixels returns 8-bit sRGB or grayscale pixels of the image.
+// Alpha is flattened onto white
+func (img *Image) Pixels(grayscale bool) ([]byte, error) {
+	var ptr unsafe.Pointer
+	size := C.size_t(0)
+
+	if C.vips_pixels_go(img.VipsImage, &ptr, &size, gbool(grayscale)) != 0 {
+		return nil, Error()
+	}
+	defer C.g_free_go(&ptr)
+
+	return C.GoBytes(ptr, C.int(size)), nil
+}
+
 func (img *Image) Replicate(width, height int, centered bool) error {
 	var tmp *C.VipsImage
 
@@ -907,6 +1036,19 @@ func (img *Image) Embed(width, height int, offX, offY int) error {
 	return nil
 }
 
+// ApplyMask keeps the image where the mask is opaque, or white if the mask has no alpha.
+// The mask should have the same size as the image
+func (img *Image) ApplyMask(mask *Image) error {
+	var tmp *C.VipsImage
+
+	if C.vips_apply_mask_go(img.VipsImage, mask.VipsImage, &tmp) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
 func (img *Image) ApplyWatermark(wm *Image, left, top int, opacity float64) error {
 	var tmp *C.VipsImage
 
@@ -918,10 +1060,21 @@ func (img *Image) ApplyWatermark(wm *Image, left, top int, opacity float64) erro
 	return nil
 }
 
-func (img *Image) Strip(keepExifCopyright bool) error {
+// Strip removes the metadata. keepFields are the names of the metadata fields to keep,
+// names ending with `*` match any field with the prefix
+func (img *Image) Strip(keepExifCopyright bool, keepFields ...string) error {
 	var tmp *C.VipsImage
 
-	if C.vips_strip(img.VipsImage, &tmp, gbool(keepExifCopyright)) != 0 {
+	var cKeepFields **C.char
+	if len(keepFields) > 0 {
+		fields := make([]*C.char, len(keepFields))
+		for i, f := range keepFields {
+			fields[i] = cachedCString(f)
+		}
+		cKeepFields = &fields[0]
+	}
+
+	if C.vips_strip(img.VipsImage, &tmp, gbool(keepExifCopyright), cKeepFields, C.int(len(keepFields))) != 0 {
 		return Error()
 	}
 	C.swap_and_clear(&img.VipsImage, tmp)
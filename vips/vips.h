@@ -48,6 +48,7 @@ int vips_resize_go(VipsImage *in, VipsImage **out, double wscale, double hscale)
 
 int vips_icc_is_srgb_iec61966(VipsImage *in);
 int vips_has_embedded_icc(VipsImage *in);
+const char *vips_interpretation_nick_go(VipsImage *in);
 int vips_icc_backup(VipsImage *in, VipsImage **out);
 int vips_icc_restore(VipsImage *in, VipsImage **out);
 int vips_icc_import_go(VipsImage *in, VipsImage **out);
@@ -60,6 +61,7 @@ int vips_colourspace_go(VipsImage *in, VipsImage **out, VipsInterpretation cs);
 int vips_rot_go(VipsImage *in, VipsImage **out, VipsAngle angle);
 int vips_flip_horizontal_go(VipsImage *in, VipsImage **out);
 
+int vips_pixels_go(VipsImage *in, void **buf, size_t *len, int grayscale);
 int vips_extract_area_go(VipsImage *in, VipsImage **out, int left, int top, int width, int height);
 int vips_smartcrop_go(VipsImage *in, VipsImage **out, int width, int height);
 int vips_trim(VipsImage *in, VipsImage **out, double threshold, gboolean smart, double r, double g,
@@ -69,28 +71,42 @@ int vips_apply_filters(VipsImage *in, VipsImage **out, double blur_sigma, double
     int pixelate_pixels);
 
 int vips_flatten_go(VipsImage *in, VipsImage **out, double r, double g, double b);
+int vips_dim_go(VipsImage *in, VipsImage **out, double factor);
+int vips_auto_level_go(VipsImage *in, VipsImage **out);
+int vips_tone_go(VipsImage *in, VipsImage **out, double brightness, double contrast, double gamma);
+int vips_saturation_go(VipsImage *in, VipsImage **out, double saturation);
+int vips_duotone_go(VipsImage *in, VipsImage **out, double sr, double sg, double sb,
+    double hr, double hg, double hb, double intensity);
 
 int vips_replicate_go(VipsImage *in, VipsImage **out, int across, int down, int centered);
 int vips_embed_go(VipsImage *in, VipsImage **out, int x, int y, int width, int height);
+int vips_apply_mask_go(VipsImage *in, VipsImage *mask, VipsImage **out);
+int vips_rotate_free_go(VipsImage *in, VipsImage **out, double angle, double scale,
+    int width, int height, double r, double g, double b, int transparent);
 
 int vips_apply_watermark(VipsImage *in, VipsImage *watermark, VipsImage **out, int left, int top,
     double opacity);
 
 int vips_linecache_seq(VipsImage *in, VipsImage **out, int tile_height);
 
-int vips_arrayjoin_go(VipsImage **in, VipsImage **out, int n);
+int vips_arrayjoin_go(VipsImage **in, VipsImage **out, int n, int across, int shim);
 
-int vips_strip(VipsImage *in, VipsImage **out, int keep_exif_copyright);
+int vips_strip(VipsImage *in, VipsImage **out, int keep_exif_copyright,
+    const char **keep_fields, int keep_fields_n);
 int vips_strip_all(VipsImage *in, VipsImage **out);
 
-int vips_jpegsave_go(VipsImage *in, void **buf, size_t *len, int quality, int interlace);
-int vips_jxlsave_go(VipsImage *in, void **buf, size_t *len, int quality, int effort);
+int vips_jpegsave_go(VipsImage *in, void **buf, size_t *len, int quality, int interlace,
+    int subsample, int trellis_quant);
+int vips_jxlsave_go(VipsImage *in, void **buf, size_t *len, int quality, int effort,
+    int lossless);
 int vips_pngsave_go(VipsImage *in, void **buf, size_t *len, int interlace, int quantize,
     int colors);
-int vips_webpsave_go(VipsImage *in, void **buf, size_t *len, int quality);
+int vips_webpsave_go(VipsImage *in, void **buf, size_t *len, int quality, int lossless,
+    int near_lossless, int effort, int alpha_q);
 int vips_gifsave_go(VipsImage *in, void **buf, size_t *len);
 int vips_heifsave_go(VipsImage *in, void **buf, size_t *len, int quality);
-int vips_avifsave_go(VipsImage *in, void **buf, size_t *len, int quality, int speed);
+int vips_avifsave_go(VipsImage *in, void **buf, size_t *len, int quality, int speed,
+    int lossless, int subsample);
 int vips_tiffsave_go(VipsImage *in, void **buf, size_t *len, int quality);
 
 void vips_cleanup();
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/derivatives"
+	"github.com/imgproxy/imgproxy/v3/diskcache"
+	"github.com/imgproxy/imgproxy/v3/etag"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/resultcache"
+)
+
+// How long a warm-up worker waits before trying to get a free processing slot again
+const warmupRetryInterval = 100 * time.Millisecond
+
+// Warm-up variants emulate browser requests, so the rendered derivatives
+// have the same keys as the live ones. The format is set via the Accept header
+var warmupAccept = map[string]string{
+	"":     "",
+	"auto": "",
+	"avif": "image/avif,image/webp",
+	"webp": "image/webp",
+	"jxl":  "image/jxl",
+}
+
+type warmupVariant struct {
+	size   string
+	preset string
+	accept string
+}
+
+type warmupTask struct {
+	imageURL string
+	// Master pyramid levels, 0 is the full master
+	levels map[int]*imagedata.ImageData
+}
+
+var (
+	warmupVariants []warmupVariant
+	warmupQueue    chan warmupTask
+)
+
+// parseWarmupVariant parses variants in the `WIDTHxHEIGHT[:preset[:format]]` format
+func parseWarmupVariant(s string) (warmupVariant, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return warmupVariant{}, fmt.Errorf("Invalid warmup variant: %s", s)
+	}
+
+	v := warmupVariant{size: parts[0]}
+
+	if len(parts) > 1 {
+		v.preset = parts[1]
+	}
+
+	if len(parts) > 2 {
+		accept, ok := warmupAccept[strings.ToLower(parts[2])]
+		if !ok {
+			return warmupVariant{}, fmt.Errorf("Invalid warmup variant format: %s", s)
+		}
+		v.accept = accept
+	}
+
+	// Check that the variant produces valid processing options
+	if _, _, err := v.processingOptions("warmup.jpg"); err != nil {
+		return warmupVariant{}, fmt.Errorf("Invalid warmup variant %s: %s", s, err)
+	}
+
+	return v, nil
+}
+
+func (v warmupVariant) processingOptions(imageURL string) (*options.ProcessingOptions, string, error) {
+	qs := make(url.Values)
+	if len(v.preset) > 0 {
+		qs.Set("pr", v.preset)
+	}
+
+	header := make(http.Header)
+	if len(v.accept) > 0 {
+		header.Set("Accept", v.accept)
+	}
+
+	return options.ParsePathIPC(v.size+"/"+imageURL, qs, header)
+}
+
+func initWarmup() error {
+	if len(config.WarmupVariants) == 0 {
+		return nil
+	}
+
+	if !diskcache.DerivativesEnabled() && !derivatives.Enabled() {
+		log.Warning("Warmup variants are set but neither the disk cache for derivatives nor the derivative store is enabled. Warmup is disabled")
+		return nil
+	}
+
+	warmupVariants = make([]warmupVariant, 0, len(config.WarmupVariants))
+
+	for _, s := range config.WarmupVariants {
+		v, err := parseWarmupVariant(s)
+		if err != nil {
+			return err
+		}
+		warmupVariants = append(warmupVariants, v)
+	}
+
+	warmupQueue = make(chan warmupTask, config.WarmupQueueSize)
+
+	for i := 0; i < config.WarmupWorkers; i++ {
+		go runWarmupWorker()
+	}
+
+	return nil
+}
+
+// scheduleWarmup queues rendering of the warm-up variants of the new master.
+// The data is copied, so the caller is free to release the buffers.
+// If the queue is full, the warm-up is skipped
+func scheduleWarmup(imageURL string, master *imagedata.ImageData, levels map[int]*imagedata.ImageData) {
+	if warmupQueue == nil || len(master.Headers["ETag"]) == 0 {
+		return
+	}
+
+	task := warmupTask{
+		imageURL: imageURL,
+		levels:   make(map[int]*imagedata.ImageData, len(levels)+1),
+	}
+
+	task.levels[0] = master
+	for l, data := range levels {
+		task.levels[l] = data
+	}
+
+	for l, data := range task.levels {
+		task.levels[l] = &imagedata.ImageData{
+			Type:    data.Type,
+			Data:    append([]byte(nil), data.Data...),
+			Headers: maps.Clone(data.Headers),
+		}
+	}
+
+	select {
+	case warmupQueue <- task:
+	default:
+		log.Warningf("Warmup queue is full, skipping %s", imageURL)
+	}
+}
+
+func runWarmupWorker() {
+	for task := range warmupQueue {
+		for _, v := range warmupVariants {
+			acquireIdleWorker()
+
+			if err := renderWarmupVariant(task, v); err != nil {
+				log.Warningf("Can't warm up %s (%s): %s", task.imageURL, v.size, err)
+			}
+
+			processingSem.Release(1)
+		}
+	}
+}
+
+// acquireIdleWorker waits for a free processing slot. TryAcquire fails when
+// there are requests waiting for the semaphore, so live traffic always goes first
+func acquireIdleWorker() {
+	for !processingSem.TryAcquire(1) {
+		time.Sleep(warmupRetryInterval)
+	}
+}
+
+func renderWarmupVariant(task warmupTask, v warmupVariant) error {
+	po, imageURL, err := v.processingOptions(task.imageURL)
+	if err != nil {
+		return err
+	}
+
+	// Pick the master level the same way as live requests do
+	level := masterPyramidLevel(po)
+	for level > 0 {
+		data, ok := task.levels[level]
+		if !ok {
+			level = 0
+			break
+		}
+
+		next, ok := nextMasterLevel(po, level, data)
+		if ok {
+			break
+		}
+
+		level = next
+	}
+
+	master := task.levels[level]
+
+	var etagHandler etag.Handler
+	etagHandler.SetActualProcessingOptions(po)
+
+	masterETag := master.Headers["ETag"]
+	if len(masterETag) == 0 {
+		return nil
+	}
+	resultKey := resultcache.Key(etagHandler.ProcessingOptionsHash(), masterETag, po.Format)
+
+	storeDerivative := derivatives.Enabled() && po.DerivativeStore.Enabled
+	if !diskcache.DerivativesEnabled() && !storeDerivative {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
+	defer cancel()
+
+	resultData, err := processing.ProcessImage(ctx, master, po)
+	if err != nil {
+		return err
+	}
+	defer resultData.Close()
+
+	if diskcache.DerivativesEnabled() {
+		diskcache.Set(resultCacheKey(resultKey), resultData)
+	}
+
+	if storeDerivative && len(resultData.Headers["X-Max-Bytes-Exceeded"]) == 0 {
+		derivatives.Put(
+			derivatives.ObjectURI(imageURL, etagHandler.ProcessingOptionsHash(), masterETag, po.Format),
+			resultData, po.DerivativeStore.TTL,
+		)
+	}
+
+	return nil
+}